@@ -82,6 +82,10 @@ type (
 		Keys []string `validate:"required"`
 		// 用于跟踪用户的cookie
 		TrackKey string `validate:"required,ascii"`
+		// bearer token认证时access token的有效期
+		AccessTokenTTL time.Duration `default:"15m"`
+		// bearer token认证时refresh token的有效期
+		RefreshTokenTTL time.Duration `default:"168h"`
 	}
 	// RedisConfig redis配置
 	RedisConfig struct {
@@ -155,6 +159,58 @@ type (
 		SecretAccessKey string `validate:"required,min=6"`
 		SSL             bool
 	}
+	// StorageConfig 文件存储的配置信息
+	StorageConfig struct {
+		// 存储驱动：local、minio或ent
+		Driver string `validate:"required,oneof=local minio ent"`
+		// 本地存储的目录，仅local时使用
+		Path string `validate:"required_if=Driver local"`
+	}
+	// AccountConfig 账户相关配置，用于找回密码与邮箱验证
+	AccountConfig struct {
+		// 前端访问地址，用于生成邮件中的链接
+		URL string `validate:"required,url"`
+		// 找回密码链接的有效期
+		ResetPasswordTTL time.Duration `default:"30m"`
+		// 邮箱验证链接的有效期
+		VerifyEmailTTL time.Duration `default:"24h"`
+		// 统计周期内登录失败达到此次数则锁定账户
+		LockMaxFailures int `default:"10"`
+		// 登录失败次数的统计周期
+		LockWindow time.Duration `default:"1h"`
+		// 账户锁定时长
+		LockDuration time.Duration `default:"30m"`
+		// 申请注销后的等待期，等待期内可撤销，之后账户数据匿名化
+		DeletionGracePeriod time.Duration `default:"720h"`
+	}
+	// OIDCConfig OIDC单点登录相关配置，issuer为空则不启用
+	OIDCConfig struct {
+		// 认证服务地址，通过其/.well-known/openid-configuration获取相关配置
+		Issuer string `validate:"omitempty,url"`
+		// 客户端ID
+		ClientID string
+		// 客户端密钥
+		ClientSecret string
+		// 认证成功后的回调地址
+		RedirectURL string `validate:"omitempty,url"`
+		// 申请的授权范围
+		Scopes []string
+		// 用户分组对应的claim
+		GroupsClaim string `default:"groups"`
+		// 分组与角色的对应关系，配置为"分组:角色"的形式
+		RoleMappings map[string]string
+		// 邮箱无对应的用户时是否自动创建
+		AutoProvision bool
+		// 认证流程的有效期
+		StateTTL time.Duration `default:"10m"`
+		// 请求认证服务的超时
+		Timeout time.Duration `default:"5s"`
+	}
+	// FixtureConfig 测试数据的配置信息，仅开发与测试环境可配置
+	FixtureConfig struct {
+		// 测试数据文件，包括测试用户与图形验证码的万能值
+		Path string
+	}
 	// PyroscopeConfig pyroscope的配置信息
 	PyroscopeConfig struct {
 		Addr  string `validate:"omitempty,url"`
@@ -227,12 +283,14 @@ func MustGetBasicConfig() *BasicConfig {
 func MustGetSessionConfig() *SessionConfig {
 	prefix := "session."
 	sessConfig := &SessionConfig{
-		MaxAge:     defaultViperX.GetDurationFromENV(prefix + "maxAge"),
-		TTL:        defaultViperX.GetDurationFromENV(prefix + "ttl"),
-		Key:        defaultViperX.GetStringFromENV(prefix + "key"),
-		CookiePath: defaultViperX.GetStringFromENV(prefix + "path"),
-		Keys:       defaultViperX.GetStringSliceFromENV(prefix + "keys"),
-		TrackKey:   defaultViperX.GetStringFromENV(prefix + "trackKey"),
+		MaxAge:          defaultViperX.GetDurationFromENV(prefix + "maxAge"),
+		TTL:             defaultViperX.GetDurationFromENV(prefix + "ttl"),
+		Key:             defaultViperX.GetStringFromENV(prefix + "key"),
+		CookiePath:      defaultViperX.GetStringFromENV(prefix + "path"),
+		Keys:            defaultViperX.GetStringSliceFromENV(prefix + "keys"),
+		TrackKey:        defaultViperX.GetStringFromENV(prefix + "trackKey"),
+		AccessTokenTTL:  defaultViperX.GetDurationFromENV(prefix + "accessTokenTTL"),
+		RefreshTokenTTL: defaultViperX.GetDurationFromENV(prefix + "refreshTokenTTL"),
 	}
 	mustValidate(sessConfig)
 	return sessConfig
@@ -415,6 +473,70 @@ func MustGetMinioConfig() *MinioConfig {
 	return minioConfig
 }
 
+// MustGetStorageConfig 获取文件存储的配置
+func MustGetStorageConfig() *StorageConfig {
+	prefix := "storage."
+	storageConfig := &StorageConfig{
+		Driver: defaultViperX.GetStringFromENV(prefix + "driver"),
+		Path:   defaultViperX.GetStringFromENV(prefix + "path"),
+	}
+	mustValidate(storageConfig)
+	return storageConfig
+}
+
+// MustGetAccountConfig 获取账户相关配置
+func MustGetAccountConfig() *AccountConfig {
+	prefix := "account."
+	accountConfig := &AccountConfig{
+		URL:                 defaultViperX.GetStringFromENV(prefix + "url"),
+		ResetPasswordTTL:    defaultViperX.GetDurationFromENV(prefix + "resetPasswordTTL"),
+		VerifyEmailTTL:      defaultViperX.GetDurationFromENV(prefix + "verifyEmailTTL"),
+		LockMaxFailures:     defaultViperX.GetIntFromENV(prefix + "lockMaxFailures"),
+		LockWindow:          defaultViperX.GetDurationFromENV(prefix + "lockWindow"),
+		LockDuration:        defaultViperX.GetDurationFromENV(prefix + "lockDuration"),
+		DeletionGracePeriod: defaultViperX.GetDurationFromENV(prefix + "deletionGracePeriod"),
+	}
+	mustValidate(accountConfig)
+	return accountConfig
+}
+
+// MustGetOIDCConfig 获取OIDC单点登录的配置
+func MustGetOIDCConfig() *OIDCConfig {
+	prefix := "oidc."
+	roleMappings := make(map[string]string)
+	for _, item := range defaultViperX.GetStringSliceFromENV(prefix + "roleMappings") {
+		group, role, found := strings.Cut(item, ":")
+		if !found || group == "" || role == "" {
+			panic(fmt.Errorf("oidc role mapping is invalid, %s", item))
+		}
+		roleMappings[group] = role
+	}
+	oidcConfig := &OIDCConfig{
+		Issuer:        defaultViperX.GetStringFromENV(prefix + "issuer"),
+		ClientID:      defaultViperX.GetStringFromENV(prefix + "clientID"),
+		ClientSecret:  defaultViperX.GetStringFromENV(prefix + "clientSecret"),
+		RedirectURL:   defaultViperX.GetStringFromENV(prefix + "redirectURL"),
+		Scopes:        defaultViperX.GetStringSliceFromENV(prefix + "scopes"),
+		GroupsClaim:   defaultViperX.GetStringFromENV(prefix + "groupsClaim"),
+		RoleMappings:  roleMappings,
+		AutoProvision: defaultViperX.GetBoolFromENV(prefix + "autoProvision"),
+		StateTTL:      defaultViperX.GetDurationFromENV(prefix + "stateTTL"),
+		Timeout:       defaultViperX.GetDurationFromENV(prefix + "timeout"),
+	}
+	mustValidate(oidcConfig)
+	return oidcConfig
+}
+
+// MustGetFixtureConfig 获取测试数据的配置
+func MustGetFixtureConfig() *FixtureConfig {
+	prefix := "fixture."
+	fixtureConfig := &FixtureConfig{
+		Path: defaultViperX.GetStringFromENV(prefix + "path"),
+	}
+	mustValidate(fixtureConfig)
+	return fixtureConfig
+}
+
 // MustGetPyroscopeConfig 获取pyroscope的配置信息
 func MustGetPyroscopeConfig() *PyroscopeConfig {
 	prefix := "pyroscope."
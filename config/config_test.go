@@ -50,6 +50,8 @@ func TestSessionConfig(t *testing.T) {
 	assert.Equal("/", sessionConfig.CookiePath)
 	assert.Equal([]string{"cuttlefish", "secret"}, sessionConfig.Keys)
 	assert.Equal("jt", sessionConfig.TrackKey)
+	assert.Equal(15*time.Minute, sessionConfig.AccessTokenTTL)
+	assert.Equal(168*time.Hour, sessionConfig.RefreshTokenTTL)
 }
 
 func TestRedisConfig(t *testing.T) {
@@ -109,3 +111,44 @@ func TestMustGetMinioConfig(t *testing.T) {
 	assert.Equal("test123456", minioConfig.SecretAccessKey)
 	assert.False(minioConfig.SSL)
 }
+
+func TestMustGetAccountConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	accountConfig := MustGetAccountConfig()
+	assert.Equal("http://127.0.0.1:7001", accountConfig.URL)
+	assert.Equal(30*time.Minute, accountConfig.ResetPasswordTTL)
+	assert.Equal(24*time.Hour, accountConfig.VerifyEmailTTL)
+	assert.Equal(10, accountConfig.LockMaxFailures)
+	assert.Equal(time.Hour, accountConfig.LockWindow)
+	assert.Equal(30*time.Minute, accountConfig.LockDuration)
+	assert.Equal(30*24*time.Hour, accountConfig.DeletionGracePeriod)
+}
+
+func TestMustGetOIDCConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	oidcConfig := MustGetOIDCConfig()
+	assert.Empty(oidcConfig.Issuer)
+	assert.Equal([]string{"openid", "profile", "email"}, oidcConfig.Scopes)
+	assert.Equal("groups", oidcConfig.GroupsClaim)
+	assert.Empty(oidcConfig.RoleMappings)
+	assert.False(oidcConfig.AutoProvision)
+	assert.Equal(10*time.Minute, oidcConfig.StateTTL)
+	assert.Equal(5*time.Second, oidcConfig.Timeout)
+}
+
+func TestMustGetFixtureConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtureConfig := MustGetFixtureConfig()
+	assert.Equal("fixtures/dev.yml", fixtureConfig.Path)
+}
+
+func TestMustGetStorageConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	storageConfig := MustGetStorageConfig()
+	assert.Equal("local", storageConfig.Driver)
+	assert.NotEmpty(storageConfig.Path)
+}
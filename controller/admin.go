@@ -21,6 +21,7 @@ import (
 	"github.com/vicanso/forest/cs"
 	"github.com/vicanso/forest/helper"
 	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
 )
 
 type adminCtrl struct{}
@@ -44,21 +45,24 @@ type (
 
 func init() {
 	ctrl := adminCtrl{}
-	g := router.NewGroup("/@admin", loadUserSession, shouldBeAdmin)
+	g := router.NewGroup("/@admin", loadUserSession)
 
 	g.GET(
 		"/v1/caches",
+		requirePermission(schema.PermissionCacheRead),
 		ctrl.listCache,
 	)
 	// 查询缓存数据
 	g.GET(
 		"/v1/caches/{key}",
+		requirePermission(schema.PermissionCacheRead),
 		ctrl.findCacheByKey,
 	)
 	// 清空session数据
 	g.DELETE(
 		"/v1/caches/{key}",
 		newTrackerMiddleware(cs.ActionAdminCleanCache),
+		requirePermission(schema.PermissionCacheWrite),
 		ctrl.cleanCacheByKey,
 	)
 }
@@ -0,0 +1,253 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 个人API key相关管理，用于自动化账户调用接口，
+// 仅保存key的hash，key仅在创建时返回一次
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/apikey"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/log"
+	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/service"
+	"github.com/vicanso/forest/session"
+	"github.com/vicanso/hes"
+)
+
+type apiKeyCtrl struct{}
+
+// 响应相关定义
+type (
+	// apiKeyListResp API key列表响应
+	apiKeyListResp struct {
+		APIKeys []*ent.APIKey `json:"apiKeys"`
+	}
+	// apiKeyAddResp 创建API key响应，key仅返回一次
+	apiKeyAddResp struct {
+		*ent.APIKey
+		Key string `json:"key"`
+	}
+)
+
+// 参数相关定义
+type (
+	// apiKeyAddParams 创建API key参数
+	apiKeyAddParams struct {
+		Name string `json:"name" validate:"required,xAPIKeyName"`
+		// 为空时表示拥有用户的所有权限
+		Scopes    []string   `json:"scopes" validate:"omitempty,max=20,dive,xRolePermission"`
+		ExpiredAt *time.Time `json:"expiredAt"`
+	}
+)
+
+const (
+	errAPIKeyCategory = "apiKey"
+
+	// 每个用户可创建的API key上限
+	apiKeyMaxCount = 20
+)
+
+func init() {
+	g := router.NewGroup(
+		"/api-keys",
+		loadUserSession,
+	)
+	ctrl := apiKeyCtrl{}
+
+	// 查询当前用户的API key
+	g.GET(
+		"/v1",
+		shouldBeLogin,
+		ctrl.list,
+	)
+
+	// 创建API key
+	g.POST(
+		"/v1",
+		newTrackerMiddleware(cs.ActionAPIKeyAdd),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.add,
+	)
+
+	// 撤销API key
+	g.DELETE(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionAPIKeyDelete),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.delete,
+	)
+}
+
+func getAPIKeyClient() *ent.APIKeyClient {
+	return helper.EntGetClient().APIKey
+}
+
+// loadAPIKeySession 通过API key加载用户session，
+// 用户的状态及角色每次均从数据库中获取，因此调整后即时生效
+func loadAPIKeySession(c *elton.Context, key string) error {
+	ctx := c.Context()
+	errInvalid := hes.NewWithStatusCode("API key无效或已过期", http.StatusUnauthorized, errAPIKeyCategory)
+	result, err := getAPIKeyClient().Query().
+		Where(apikey.Hash(service.HashAPIKey(key))).
+		Only(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			return errInvalid
+		}
+		return err
+	}
+	if result.ExpiredAt != nil && result.ExpiredAt.Before(time.Now()) {
+		return errInvalid
+	}
+	u, err := getUserClient().Query().
+		Where(user.Account(result.Account)).
+		Only(ctx)
+	if err != nil {
+		return err
+	}
+	if u.Status != schema.StatusEnabled || service.IsAccountLocked(u) {
+		return hes.NewWithStatusCode("该账户不允许使用API key", http.StatusForbidden, errAPIKeyCategory)
+	}
+	ip := c.RealIP()
+	if service.ShouldRecordAPIKeyUsage(result.LastUsedAt, result.LastUsedIP, ip) {
+		// 记录失败不影响请求
+		_, err = result.Update().
+			SetLastUsedAt(time.Now()).
+			SetLastUsedIP(ip).
+			Save(ctx)
+		if err != nil {
+			log.Error(ctx).
+				Err(err).
+				Int("apiKey", result.ID).
+				Msg("record api key usage fail")
+		}
+	}
+	session.NewTokenUserSession(c, session.UserInfo{
+		Account:      u.Account,
+		ID:           u.ID,
+		Roles:        u.Roles,
+		Groups:       u.Groups,
+		TOTPVerified: result.TotpVerified && u.TotpEnabled,
+		APIKeyID:     result.ID,
+		Scopes:       result.Scopes,
+	})
+	return nil
+}
+
+// save 创建API key，返回保存的记录以及key
+func (params *apiKeyAddParams) save(ctx context.Context, info session.UserInfo) (*ent.APIKey, string, error) {
+	if params.ExpiredAt != nil && params.ExpiredAt.Before(time.Now()) {
+		return nil, "", hes.New("过期时间不能早于当前时间", errAPIKeyCategory)
+	}
+	// 仅允许分配自身拥有的权限
+	err := validatePermissions(getEffectiveRoles(info), params.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	count, err := getAPIKeyClient().Query().
+		Where(apikey.Account(info.Account)).
+		Count(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if count >= apiKeyMaxCount {
+		return nil, "", hes.New("API key数量已达上限", errAPIKeyCategory)
+	}
+	key, prefix, hash := service.GenerateAPIKey()
+	result, err := getAPIKeyClient().Create().
+		SetAccount(info.Account).
+		SetName(params.Name).
+		SetPrefix(prefix).
+		SetHash(hash).
+		SetScopes(params.Scopes).
+		SetTotpVerified(info.TOTPVerified).
+		SetNillableExpiredAt(params.ExpiredAt).
+		Save(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return result, key, nil
+}
+
+// list 查询当前用户的API key
+func (*apiKeyCtrl) list(c *elton.Context) error {
+	us := getUserSession(c)
+	apiKeys, err := getAPIKeyClient().Query().
+		Where(apikey.Account(us.MustGetInfo().Account)).
+		Order(ent.Desc(apikey.FieldCreatedAt)).
+		All(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &apiKeyListResp{
+		APIKeys: apiKeys,
+	}
+	return nil
+}
+
+// add 创建API key，不允许通过API key创建新的API key
+func (*apiKeyCtrl) add(c *elton.Context) error {
+	info := getUserSession(c).MustGetInfo()
+	params := apiKeyAddParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	result, key, err := params.save(c.Context(), info)
+	if err != nil {
+		return err
+	}
+	c.Created(&apiKeyAddResp{
+		APIKey: result,
+		Key:    key,
+	})
+	return nil
+}
+
+// delete 撤销API key，仅允许本人或拥有用户管理权限的用户撤销
+func (*apiKeyCtrl) delete(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	info := getUserSession(c).MustGetInfo()
+	result, err := getAPIKeyClient().Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if result.Account != info.Account &&
+		!hasPermission(info, schema.PermissionUserWrite) {
+		return hes.NewWithStatusCode("禁止撤销该API key", http.StatusForbidden, errAPIKeyCategory)
+	}
+	err = getAPIKeyClient().DeleteOneID(id).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
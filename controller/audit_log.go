@@ -0,0 +1,163 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 审计日志查询，审计日志由ent的hook在每次修改数据时自动生成
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/auditlog"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
+)
+
+type auditLogCtrl struct{}
+
+// 响应相关定义
+type (
+	// auditLogListResp 审计日志列表响应
+	auditLogListResp struct {
+		AuditLogs []*ent.AuditLog `json:"auditLogs"`
+		Count     int             `json:"count"`
+	}
+)
+
+// 参数相关定义
+type (
+	// auditLogListParams 审计日志查询参数
+	auditLogListParams struct {
+		listParams
+
+		// 数据类型，如User、Configuration
+		EntityType string `json:"entityType" validate:"omitempty,xAuditLogEntityType"`
+		// 数据ID
+		EntityID int `json:"entityID" validate:"omitempty,min=1"`
+		// 操作者账户
+		Account string    `json:"account" validate:"omitempty,xUserAccount"`
+		Begin   time.Time `json:"begin"`
+		End     time.Time `json:"end"`
+	}
+)
+
+func init() {
+	g := router.NewGroup(
+		"/audit-logs",
+		loadUserSession,
+	)
+	ctrl := auditLogCtrl{}
+
+	// 查询审计日志
+	g.GET(
+		"/v1",
+		requirePermission(schema.PermissionAuditLogRead),
+		ctrl.list,
+	)
+}
+
+func getAuditLogClient() *ent.AuditLogClient {
+	return helper.EntGetClient().AuditLog
+}
+
+// where 将查询条件中的参数转换为对应的where条件
+func (params *auditLogListParams) where(query *ent.AuditLogQuery) *ent.AuditLogQuery {
+	if params.EntityType != "" {
+		query.Where(auditlog.EntityType(params.EntityType))
+	}
+	if params.EntityID != 0 {
+		query.Where(auditlog.EntityID(params.EntityID))
+	}
+	if params.Account != "" {
+		query.Where(auditlog.Account(params.Account))
+	}
+	if !params.Begin.IsZero() {
+		query.Where(auditlog.CreatedAtGTE(params.Begin))
+	}
+	if !params.End.IsZero() {
+		query.Where(auditlog.CreatedAtLTE(params.End))
+	}
+	return query
+}
+
+// GetOrders 获取排序的函数列表，默认按ID降序
+func (params *auditLogListParams) GetOrders() []auditlog.OrderOption {
+	if params.Order == "" {
+		return []auditlog.OrderOption{
+			ent.Desc(auditlog.FieldID),
+		}
+	}
+	arr := strings.Split(params.Order, ",")
+	funcs := make([]auditlog.OrderOption, len(arr))
+	for index, item := range arr {
+		if item[0] == '-' {
+			funcs[index] = ent.Desc(strcase.ToSnake(item[1:]))
+		} else {
+			funcs[index] = ent.Asc(strcase.ToSnake(item))
+		}
+	}
+	return funcs
+}
+
+// queryAll 查询审计日志列表
+func (params *auditLogListParams) queryAll(ctx context.Context) ([]*ent.AuditLog, error) {
+	query := getAuditLogClient().Query()
+
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+
+	return query.All(ctx)
+}
+
+// count 计算总数
+func (params *auditLogListParams) count(ctx context.Context) (int, error) {
+	query := getAuditLogClient().Query()
+
+	query = params.where(query)
+
+	return query.Count(ctx)
+}
+
+// list 查询审计日志列表
+func (*auditLogCtrl) list(c *elton.Context) error {
+	params := auditLogListParams{}
+	err := validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return err
+		}
+	}
+	auditLogs, err := params.queryAll(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &auditLogListResp{
+		Count:     count,
+		AuditLogs: auditLogs,
+	}
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/vicanso/forest/profiler"
 	"github.com/vicanso/forest/request"
 	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
 	"github.com/vicanso/forest/service"
 	"github.com/vicanso/forest/util"
 	"github.com/vicanso/hes"
@@ -109,7 +110,7 @@ func init() {
 	g.GET(
 		"/prof",
 		loadUserSession,
-		shouldBeAdmin,
+		requirePermission(schema.PermissionSystemRead),
 		ctrl.getProf,
 	)
 	// 获取接口文档
@@ -28,9 +28,12 @@ import (
 	gen "github.com/vicanso/forest/ent"
 	"github.com/vicanso/forest/ent/configuration"
 	confSchema "github.com/vicanso/forest/ent/configuration"
+	"github.com/vicanso/forest/ent/configurationrevision"
+	"github.com/vicanso/forest/helper"
 	"github.com/vicanso/forest/router"
 	"github.com/vicanso/forest/schema"
 	"github.com/vicanso/forest/service"
+	"github.com/vicanso/forest/validate"
 	"github.com/vicanso/hes"
 )
 
@@ -43,6 +46,17 @@ type (
 		Configurations []*ent.Configuration `json:"configurations"`
 		Count          int                  `json:"count"`
 	}
+	// configurationRevisionListResp 配置修订版本列表响应
+	configurationRevisionListResp struct {
+		Revisions []*ent.ConfigurationRevision `json:"revisions"`
+		Count     int                          `json:"count"`
+	}
+	// configurationRevisionDiffResp 配置修订版本对比响应
+	configurationRevisionDiffResp struct {
+		From *ent.ConfigurationRevision      `json:"from"`
+		To   *ent.ConfigurationRevision      `json:"to"`
+		Diff map[string]*schema.AuditLogDiff `json:"diff"`
+	}
 )
 
 // 参数相关定义
@@ -69,6 +83,21 @@ type (
 		Description string              `json:"description"`
 	}
 
+	// configurationRevisionListParams 配置修订版本查询参数
+	configurationRevisionListParams struct {
+		listParams
+	}
+	// configurationRevisionDiffParams 配置修订版本对比参数
+	configurationRevisionDiffParams struct {
+		From int `json:"from" validate:"required,min=1"`
+		To   int `json:"to" validate:"required,min=1"`
+	}
+	// configurationRevisionParams 配置修订版本参数
+	configurationRevisionParams struct {
+		ID      int `json:"id" validate:"required,min=1"`
+		Version int `json:"version" validate:"required,min=1"`
+	}
+
 	// configurationListParmas 配置查询参数
 	configurationListParmas struct {
 		listParams
@@ -86,13 +115,13 @@ func init() {
 	g := router.NewGroup(
 		"/configurations",
 		loadUserSession,
-		shouldBeSu,
 	)
 	ctrl := configurationCtrl{}
 
 	// 查询配置
 	g.GET(
 		"/v1",
+		requirePermission(schema.PermissionConfigurationRead),
 		ctrl.list,
 	)
 
@@ -100,12 +129,14 @@ func init() {
 	g.POST(
 		"/v1",
 		newTrackerMiddleware(cs.ActionConfigurationAdd),
+		requirePermission(schema.PermissionConfigurationWrite),
 		ctrl.add,
 	)
 
 	// 获取当前有效配置
 	g.GET(
 		"/v1/current-valid",
+		requirePermission(schema.PermissionConfigurationRead),
 		ctrl.getCurrentValid,
 	)
 
@@ -113,14 +144,46 @@ func init() {
 	g.PATCH(
 		"/v1/{id}",
 		newTrackerMiddleware(cs.ActionConfigurationUpdate),
+		requirePermission(schema.PermissionConfigurationWrite),
 		ctrl.update,
 	)
 
 	// 查询单个配置
 	g.GET(
 		"/v1/{id}",
+		requirePermission(schema.PermissionConfigurationRead),
 		ctrl.findByID,
 	)
+
+	// 删除配置
+	g.DELETE(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionConfigurationDelete),
+		requirePermission(schema.PermissionConfigurationWrite),
+		ctrl.delete,
+	)
+
+	// 查询配置的修订版本
+	g.GET(
+		"/v1/{id}/revisions",
+		requirePermission(schema.PermissionConfigurationRead),
+		ctrl.listRevision,
+	)
+
+	// 对比配置的两个修订版本
+	g.GET(
+		"/v1/{id}/revisions/diff",
+		requirePermission(schema.PermissionConfigurationRead),
+		ctrl.diffRevision,
+	)
+
+	// 回滚至指定修订版本
+	g.POST(
+		"/v1/{id}/revisions/{version}/rollback",
+		newTrackerMiddleware(cs.ActionConfigurationRollback),
+		requirePermission(schema.PermissionConfigurationWrite),
+		ctrl.rollback,
+	)
 }
 
 // validateBeforeSave 保存前校验
@@ -144,16 +207,28 @@ func (params *configurationAddParams) save(ctx context.Context, owner string) (*
 	if err != nil {
 		return nil, err
 	}
-	return getConfigurationClient().Create().
-		SetName(params.Name).
-		SetStatus(params.Status).
-		SetCategory(params.Category).
-		SetData(params.Data).
-		SetOwner(owner).
-		SetStartedAt(params.StartedAt).
-		SetEndedAt(params.EndedAt).
-		SetDescription(params.Description).
-		Save(ctx)
+	var result *ent.Configuration
+	err = helper.EntWithTx(ctx, func(client *ent.Client) error {
+		result, err = client.Configuration.Create().
+			SetName(params.Name).
+			SetStatus(params.Status).
+			SetCategory(params.Category).
+			SetData(params.Data).
+			SetOwner(owner).
+			SetStartedAt(params.StartedAt).
+			SetEndedAt(params.EndedAt).
+			SetDescription(params.Description).
+			Save(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = service.AddConfigurationRevision(ctx, client, result, configurationrevision.ActionAdd)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // where 将查询条件中的参数转换为对应的where条件
@@ -205,10 +280,37 @@ func (params *configurationListParmas) count(ctx context.Context) (int, error) {
 	return query.Count(ctx)
 }
 
-// update 更新配置信息
+// updateOneID 更新配置信息，更新后记录修订版本
 func (params *configurationUpdateParams) updateOneID(ctx context.Context, id int) (*ent.Configuration, error) {
-	updateOne := getConfigurationClient().
-		UpdateOneID(id)
+	var result *ent.Configuration
+	err := helper.EntWithTx(ctx, func(client *ent.Client) error {
+		current, err := client.Configuration.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = service.InitConfigurationRevision(ctx, client, current)
+		if err != nil {
+			return err
+		}
+		result, err = params.update(ctx, client.Configuration, id)
+		if err != nil {
+			return err
+		}
+		_, err = service.AddConfigurationRevision(ctx, client, result, configurationrevision.ActionUpdate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// update 更新配置信息
+func (params *configurationUpdateParams) update(ctx context.Context, client *ent.ConfigurationClient, id int) (*ent.Configuration, error) {
+	// 已删除的配置不允许更新
+	updateOne := client.
+		UpdateOneID(id).
+		Where(configuration.DeletedAtIsNil())
 	if !params.StartedAt.IsZero() {
 		updateOne = updateOne.SetStartedAt(params.StartedAt)
 	}
@@ -309,6 +411,114 @@ func (*configurationCtrl) findByID(c *elton.Context) error {
 	return nil
 }
 
+// delete 删除配置（软删除），删除后不再生效，配置名称可重新使用
+func (*configurationCtrl) delete(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	err = helper.EntWithTx(ctx, func(client *ent.Client) error {
+		current, err := client.Configuration.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = service.InitConfigurationRevision(ctx, client, current)
+		if err != nil {
+			return err
+		}
+		err = client.Configuration.DeleteOneID(id).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = service.AddConfigurationRevision(ctx, client, current, configurationrevision.ActionDelete)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// listRevision 查询配置的修订版本，按版本号降序
+func (*configurationCtrl) listRevision(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	params := configurationRevisionListParams{}
+	err = validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	query := getConfigurationRevisionClient().Query().
+		Where(configurationrevision.ConfigurationID(id))
+	count := -1
+	if params.ShouldCount() {
+		count, err = query.Clone().Count(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	revisions, err := query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(ent.Desc(configurationrevision.FieldVersion)).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	c.Body = &configurationRevisionListResp{
+		Count:     count,
+		Revisions: revisions,
+	}
+	return nil
+}
+
+// diffRevision 对比配置的两个修订版本
+func (*configurationCtrl) diffRevision(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	params := configurationRevisionDiffParams{}
+	err = validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	from, err := service.GetConfigurationRevision(ctx, id, params.From)
+	if err != nil {
+		return err
+	}
+	to, err := service.GetConfigurationRevision(ctx, id, params.To)
+	if err != nil {
+		return err
+	}
+	c.Body = &configurationRevisionDiffResp{
+		From: from,
+		To:   to,
+		Diff: service.DiffConfigurationRevision(from, to),
+	}
+	return nil
+}
+
+// rollback 将配置回滚至指定修订版本，下次刷新配置时生效
+func (*configurationCtrl) rollback(c *elton.Context) error {
+	params := configurationRevisionParams{}
+	err := validate.Query(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	result, err := service.RollbackConfiguration(c.Context(), params.ID, params.Version)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
 // getCurrentValid 获取当前有效配置
 func (*configurationCtrl) getCurrentValid(c *elton.Context) error {
 	configs, err := service.GetAvailableConfigurations(c.Context())
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
@@ -25,11 +26,13 @@ import (
 	M "github.com/vicanso/elton/middleware"
 	"github.com/vicanso/forest/cs"
 	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/fixture"
 	"github.com/vicanso/forest/helper"
 	"github.com/vicanso/forest/influx"
 	"github.com/vicanso/forest/log"
 	"github.com/vicanso/forest/middleware"
 	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/service"
 	"github.com/vicanso/forest/session"
 	"github.com/vicanso/forest/util"
 	"github.com/vicanso/forest/validate"
@@ -44,20 +47,17 @@ var (
 
 	getUserSession = session.NewUserSession
 	// 加载用户session
-	loadUserSession = elton.Compose(session.New(), sessionHandle)
+	loadUserSession = elton.Compose(newSessionLoader(), sessionHandle)
 	// 判断用户是否登录
 	shouldBeLogin = checkLoginMiddleware
 	// 判断用户是否未登录
 	shouldBeAnonymous = checkAnonymousMiddleware
-	// 判断用户是否admin权限
-	shouldBeAdmin = newCheckRolesMiddleware([]string{
-		schema.UserRoleSu,
-		schema.UserRoleAdmin,
-	})
-	// shouldBeSu 判断用户是否su权限
-	shouldBeSu = newCheckRolesMiddleware([]string{
-		schema.UserRoleSu,
-	})
+	// 判断用户是否超级用户
+	shouldBeSu = checkSuMiddleware
+	// 判断用户是否非模拟登录
+	shouldNotImpersonate = checkNotImpersonateMiddleware
+	// 判断用户是否非API key认证
+	shouldNotUseAPIKey = checkNotAPIKeyMiddleware
 
 	// 创建新的并发控制中间件
 	newConcurrentLimit = middleware.NewConcurrentLimit
@@ -69,7 +69,7 @@ var (
 	noCacheIfRequestNoCache = middleware.NewNoCacheWithCondition("cacheControl", "no-cache")
 
 	// 图形验证码校验
-	captchaValidate = newMagicalCaptchaValidate()
+	captchaValidate = middleware.ValidateCaptcha(isFixtureCaptcha)
 	// 获取influx service
 	getInfluxSrv = influx.New
 )
@@ -97,12 +97,31 @@ func getConfigurationClient() *ent.ConfigurationClient {
 	return helper.EntGetClient().Configuration
 }
 
-func newMagicalCaptchaValidate() elton.Handler {
-	magicValue := ""
-	if !util.IsProduction() {
-		magicValue = "0145"
+func getConfigurationRevisionClient() *ent.ConfigurationRevisionClient {
+	return helper.EntGetClient().ConfigurationRevision
+}
+
+func getFileClient() *ent.FileClient {
+	return helper.EntGetClient().File
+}
+
+// isFixtureCaptcha 判断是否测试数据中的图形验证码万能值，如果是则记录
+func isFixtureCaptcha(c *elton.Context, captcha string) bool {
+	if !fixture.IsCaptcha(captcha) {
+		return false
 	}
-	return middleware.ValidateCaptcha(magicValue)
+	account := ""
+	us := session.NewUserSession(c)
+	if us.IsLogin() {
+		account = us.MustGetInfo().Account
+	}
+	fixture.RecordBypass(c.Context(), fixture.BypassParams{
+		Category: fixture.BypassCaptcha,
+		Account:  account,
+		IP:       c.RealIP(),
+		Path:     c.Request.URL.Path,
+	})
+	return true
 }
 
 // isLogin 判断是否登录状态
@@ -135,8 +154,48 @@ func checkAnonymousMiddleware(c *elton.Context) error {
 	return c.Next()
 }
 
-// newCheckRolesMiddleware 创建用户角色校验中间件
-func newCheckRolesMiddleware(validRoles []string) elton.Handler {
+// checkSuMiddleware 判断是超级用户，不允许使用API key
+func checkSuMiddleware(c *elton.Context) error {
+	err := validateLogin(c)
+	if err != nil {
+		return err
+	}
+	userInfo := getUserSession(c).MustGetInfo()
+	if userInfo.APIKeyID != 0 ||
+		!lo.Contains(getEffectiveRoles(userInfo), schema.UserRoleSu) {
+		return hes.NewWithStatusCode("仅超级用户可使用该功能", http.StatusForbidden, errUserCategory)
+	}
+	return c.Next()
+}
+
+// checkNotImpersonateMiddleware 判断非模拟登录，
+// 模拟登录时不允许修改账户的密码、两步验证以及session等
+func checkNotImpersonateMiddleware(c *elton.Context) error {
+	err := validateLogin(c)
+	if err != nil {
+		return err
+	}
+	if getUserSession(c).MustGetInfo().Impersonator != nil {
+		return hes.NewWithStatusCode("模拟登录时不允许使用该功能", http.StatusForbidden, errUserCategory)
+	}
+	return c.Next()
+}
+
+// checkNotAPIKeyMiddleware 判断非API key认证，
+// API key的权限范围仅限制requirePermission校验的功能，因此不允许使用API key管理账户
+func checkNotAPIKeyMiddleware(c *elton.Context) error {
+	err := validateLogin(c)
+	if err != nil {
+		return err
+	}
+	if getUserSession(c).MustGetInfo().APIKeyID != 0 {
+		return hes.NewWithStatusCode("不允许使用API key管理账户", http.StatusForbidden, errUserCategory)
+	}
+	return c.Next()
+}
+
+// requirePermission 创建用户权限校验中间件，用户的任一角色拥有该权限则允许访问
+func requirePermission(permission string) elton.Handler {
 	return func(c *elton.Context) error {
 		err := validateLogin(c)
 		if err != nil {
@@ -147,14 +206,39 @@ func newCheckRolesMiddleware(validRoles []string) elton.Handler {
 		if err != nil {
 			return err
 		}
-		valid := util.ContainsAny(validRoles, userInfo.Roles)
-		if valid {
+		if hasPermission(userInfo, permission) {
 			return c.Next()
 		}
+		if !isInScopes(userInfo, permission) {
+			return hes.NewWithStatusCode("API key无权限使用该功能", http.StatusForbidden, errUserCategory)
+		}
+		// 角色要求两步验证，但用户未通过两步验证
+		if service.HasPermission(userInfo.Roles, permission) {
+			return hes.NewWithStatusCode("该功能需要启用并通过两步验证", http.StatusForbidden, errUserCategory)
+		}
 		return hes.NewWithStatusCode("禁止使用该功能", http.StatusForbidden, errUserCategory)
 	}
 }
 
+// isInScopes 判断权限是否在API key允许的范围内，非API key认证则不限制
+func isInScopes(userInfo session.UserInfo, permission string) bool {
+	if len(userInfo.Scopes) == 0 || lo.Contains(userInfo.Scopes, schema.PermissionAll) {
+		return true
+	}
+	return lo.Contains(userInfo.Scopes, permission)
+}
+
+// hasPermission 判断用户是否拥有该权限
+func hasPermission(userInfo session.UserInfo, permission string) bool {
+	return isInScopes(userInfo, permission) &&
+		service.HasPermission(getEffectiveRoles(userInfo), permission)
+}
+
+// getEffectiveRoles 获取用户当前生效的角色，要求两步验证的角色需通过验证后才生效
+func getEffectiveRoles(userInfo session.UserInfo) []string {
+	return service.FilterTOTPRoles(userInfo.Roles, userInfo.TOTPVerified)
+}
+
 // newTrackerMiddleware 初始化用户行为跟踪中间件
 func newTrackerMiddleware(action string, params ...trackerExtraParams) elton.Handler {
 	marshalString := func(data any) string {
@@ -170,10 +254,15 @@ func newTrackerMiddleware(action string, params ...trackerExtraParams) elton.Han
 		MaxLength: 30,
 		OnTrack: func(info *M.TrackerInfo, c *elton.Context) {
 			account := ""
+			impersonator := ""
 			tid := util.GetDeviceID(c.Context())
 			us := session.NewUserSession(c)
 			if us != nil && us.IsLogin() {
-				account = us.MustGetInfo().Account
+				userInfo := us.MustGetInfo()
+				account = userInfo.Account
+				if userInfo.Impersonator != nil {
+					impersonator = userInfo.Impersonator.Account
+				}
 			}
 			ip := c.RealIP()
 			sid := util.GetSessionID(c)
@@ -184,6 +273,10 @@ func newTrackerMiddleware(action string, params ...trackerExtraParams) elton.Han
 				cs.FieldSID:     sid,
 				cs.FieldTID:     tid,
 			}
+			// 模拟登录时记录原用户
+			if impersonator != "" {
+				fields[cs.FieldImpersonator] = impersonator
+			}
 			if len(info.Query) != 0 {
 				fields[cs.FieldQuery] = marshalString(info.Query)
 			}
@@ -206,6 +299,9 @@ func newTrackerMiddleware(action string, params ...trackerExtraParams) elton.Han
 				Str("ip", ip).
 				Str("sid", sid).
 				Int("result", info.Result)
+			if impersonator != "" {
+				event = event.Str("impersonator", impersonator)
+			}
 			if currentStep != "" {
 				event = event.Str("step", currentStep)
 			}
@@ -258,16 +354,68 @@ func sessionHandle(c *elton.Context) error {
 
 	us := session.NewUserSession(c)
 	account := ""
+	impersonator := ""
 	if us.IsLogin() {
-		account = us.MustGetInfo().Account
+		info := us.MustGetInfo()
+		account = info.Account
+		if info.Impersonator != nil {
+			impersonator = info.Impersonator.Account
+		}
 	}
 	// 设置账号信息
-	c.WithContext(util.SetAccount(c.Context(), account))
+	ctx := util.SetAccount(c.Context(), account)
+	if impersonator != "" {
+		ctx = util.SetImpersonator(ctx, impersonator)
+	}
+	c.WithContext(ctx)
 
 	return c.Next()
 
 }
 
+// getAuthorization 获取请求头Authorization中对应认证方式的凭证
+func getAuthorization(c *elton.Context, scheme string) string {
+	credentials, found := strings.CutPrefix(c.GetRequestHeader("Authorization"), scheme+" ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(credentials)
+}
+
+// newSessionLoader 创建session加载中间件，如果请求头中有bearer token或API key则使用对应的认证，
+// 否则使用cookie session，各方式均生成相同的user session
+func newSessionLoader() elton.Handler {
+	cookieSession := session.New()
+	return func(c *elton.Context) error {
+		key := getAuthorization(c, "ApiKey")
+		if key != "" {
+			err := loadAPIKeySession(c, key)
+			if err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		token := getAuthorization(c, "Bearer")
+		if token == "" {
+			return cookieSession(c)
+		}
+		// 账户的token被撤销（如修改密码、禁用账户）后，之前签发的access token也失效
+		claims, err := service.ValidateAccessToken(c.Context(), token)
+		if err != nil {
+			return err
+		}
+		session.NewTokenUserSession(c, session.UserInfo{
+			Account:        claims.Account,
+			ID:             claims.UserID,
+			Roles:          claims.Roles,
+			Groups:         claims.Groups,
+			TOTPVerified:   claims.TOTPVerified,
+			TokenSessionID: claims.SessionID,
+		})
+		return c.Next()
+	}
+}
+
 // isIntranet 判断是否内网访问
 func isIntranet(c *elton.Context) error {
 	if elton.IsIntranet(c.ClientIP()) {
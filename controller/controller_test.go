@@ -16,6 +16,7 @@ package controller
 
 import (
 	"context"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -104,12 +105,36 @@ func TestCheckAnonymous(t *testing.T) {
 	assert.Equal("已是登录状态，请先退出登录", err.(*hes.Error).Message)
 }
 
-func TestNewCheckRolesMiddleware(t *testing.T) {
+func TestCheckNotAPIKey(t *testing.T) {
 	assert := assert.New(t)
 	ctx := context.Background()
-	fn := newCheckRolesMiddleware([]string{
-		schema.UserRoleAdmin,
+	c, us := newContextAndUserSession()
+	err := us.SetInfo(ctx, session.UserInfo{
+		Account:  "treexie",
+		APIKeyID: 1,
+	})
+	assert.Nil(err)
+	err = checkNotAPIKeyMiddleware(c)
+	assert.Equal("不允许使用API key管理账户", err.(*hes.Error).Message)
+
+	err = us.SetInfo(ctx, session.UserInfo{
+		Account: "treexie",
 	})
+	assert.Nil(err)
+	done := false
+	c.Next = func() error {
+		done = true
+		return nil
+	}
+	err = checkNotAPIKeyMiddleware(c)
+	assert.Nil(err)
+	assert.True(done)
+}
+
+func TestRequirePermission(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	fn := requirePermission(schema.PermissionRoleWrite)
 	c, us := newContextAndUserSession()
 	// 未登录
 	err := fn(c)
@@ -127,7 +152,7 @@ func TestNewCheckRolesMiddleware(t *testing.T) {
 	err = us.SetInfo(ctx, session.UserInfo{
 		Account: "treexie",
 		Roles: []string{
-			schema.UserRoleAdmin,
+			schema.UserRoleSu,
 		},
 	})
 	assert.Nil(err)
@@ -150,3 +175,20 @@ func TestGetIDFromParams(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(1, id)
 }
+
+func TestGetAuthorization(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("GET", "/", nil)
+	c := elton.NewContext(nil, req)
+	assert.Empty(getAuthorization(c, "Bearer"))
+
+	req.Header.Set("Authorization", "Basic abc")
+	assert.Empty(getAuthorization(c, "Bearer"))
+
+	req.Header.Set("Authorization", "Bearer abc")
+	assert.Equal("abc", getAuthorization(c, "Bearer"))
+	assert.Empty(getAuthorization(c, "ApiKey"))
+
+	req.Header.Set("Authorization", "ApiKey fk_abc")
+	assert.Equal("fk_abc", getAuthorization(c, "ApiKey"))
+}
@@ -15,12 +15,28 @@
 package controller
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/file"
+	"github.com/vicanso/forest/log"
 	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/service"
 	"github.com/vicanso/forest/storage"
 	"github.com/vicanso/forest/util"
+	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/hes"
 )
 
 type fileCtrl struct{}
@@ -29,8 +45,36 @@ type fileCtrl struct{}
 type (
 	// fileUploadResp 文件上传响应
 	fileUploadResp struct {
-		Name string `json:"name"`
-		Size int64  `json:"size"`
+		Name        string `json:"name"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"contentType"`
+	}
+	// filePresignedUploadResp 预签名上传响应
+	filePresignedUploadResp struct {
+		Filename string `json:"filename"`
+		*storage.PresignedURL
+	}
+	// fileUploadSessionResp 分块上传会话响应
+	fileUploadSessionResp struct {
+		ID        string    `json:"id"`
+		Filename  string    `json:"filename"`
+		Size      int64     `json:"size"`
+		ChunkSize int64     `json:"chunkSize"`
+		Chunks    int       `json:"chunks"`
+		ExpiredAt time.Time `json:"expiredAt"`
+		// 已上传的数据范围
+		ReceivedRanges []service.UploadRange `json:"receivedRanges"`
+		// 未上传的分块序号
+		MissingChunks []int `json:"missingChunks"`
+	}
+	// fileVersionListResp 文件版本列表响应
+	fileVersionListResp struct {
+		Versions []*storage.FileVersion `json:"versions"`
+	}
+	// fileListResp 文件列表响应
+	fileListResp struct {
+		Files []*storage.File `json:"files"`
+		Count int64           `json:"count"`
 	}
 )
 
@@ -40,6 +84,97 @@ type (
 	fileUploadParams struct {
 		Bucket string `json:"bucket" validate:"required,xFileBucket"`
 	}
+	// fileListParams 文件查询参数
+	fileListParams struct {
+		listParams
+
+		Bucket      string    `json:"bucket" validate:"required,xFileBucket"`
+		Creator     string    `json:"creator" validate:"omitempty,xUserAccount"`
+		ContentType string    `json:"contentType" validate:"omitempty,xFileContentType"`
+		Begin       time.Time `json:"begin"`
+		End         time.Time `json:"end"`
+	}
+	// filePresignedUploadParams 预签名上传参数
+	filePresignedUploadParams struct {
+		Bucket      string `json:"bucket" validate:"required,xFileBucket"`
+		ContentType string `json:"contentType" validate:"required,xFileContentType"`
+		// 有效期，单位秒
+		TTL int `json:"ttl" validate:"omitempty,xFilePresignedTTL"`
+	}
+	// filePresignedUploadCompleteParams 预签名上传完成参数
+	filePresignedUploadCompleteParams struct {
+		Bucket   string `json:"bucket" validate:"required,xFileBucket"`
+		Filename string `json:"filename" validate:"required,xFilename"`
+	}
+	// filePresignedGetParams 预签名下载参数
+	filePresignedGetParams struct {
+		// 有效期，单位秒
+		TTL int `json:"ttl" validate:"omitempty,xFilePresignedTTL"`
+	}
+	// fileVersionParams 文件版本路由参数
+	fileVersionParams struct {
+		Bucket   string `json:"bucket" validate:"required,xFileBucket"`
+		Filename string `json:"filename" validate:"required,xFilename"`
+		Version  int    `json:"version" validate:"required,min=1"`
+	}
+	// fileUploadSessionCreateParams 创建分块上传会话参数
+	fileUploadSessionCreateParams struct {
+		Bucket      string `json:"bucket" validate:"required,xFileBucket"`
+		ContentType string `json:"contentType" validate:"required,xFileContentType"`
+		Size        int64  `json:"size" validate:"required,min=1"`
+		// 分块大小，默认为5MB
+		ChunkSize int64 `json:"chunkSize" validate:"omitempty,xFileChunkSize"`
+	}
+	// fileUploadSessionParams 分块上传会话路由参数
+	fileUploadSessionParams struct {
+		ID string `json:"id" validate:"required,xFileUploadID"`
+	}
+	// fileUploadChunkParams 上传分块路由参数
+	fileUploadChunkParams struct {
+		ID     string `json:"id" validate:"required,xFileUploadID"`
+		Number int    `json:"number" validate:"required,min=1,max=10000"`
+	}
+	// fileImageParams 图片处理参数
+	fileImageParams struct {
+		Width   int    `json:"w" validate:"omitempty,xImageSize"`
+		Height  int    `json:"h" validate:"omitempty,xImageSize"`
+		Fit     string `json:"fit" validate:"omitempty,xImageFit"`
+		Type    string `json:"type" validate:"omitempty,xImageType"`
+		Quality int    `json:"quality" validate:"omitempty,xImageQuality"`
+	}
+	// fileParams 文件路由参数
+	fileParams struct {
+		Bucket   string `json:"bucket" validate:"required,xFileBucket"`
+		Filename string `json:"filename" validate:"required,xFilename"`
+	}
+)
+
+const (
+	errFileCategory = "file"
+
+	// 预签名地址默认有效期
+	defaultPresignedTTL = 15 * time.Minute
+
+	// 上传时multipart中除文件外的其它数据的最大长度
+	maxMultipartOverhead = 1024 * 1024
+
+	// 分块上传默认的分块大小
+	defaultChunkSize = 5 * 1024 * 1024
+	// 分块上传最多的分块数量
+	maxChunks = 10000
+)
+
+type (
+	// fileRange 文件读取的范围
+	fileRange struct {
+		start  int64
+		length int64
+	}
+	// limitReadCloser 限制读取长度的reader，并保留close函数
+	limitReadCloser struct {
+		io.Reader
+		io.Closer
+	}
 )
 
 func init() {
@@ -47,6 +182,14 @@ func init() {
 
 	g := router.NewGroup("/files")
 
+	// 查询文件列表
+	g.GET(
+		"/v1",
+		loadUserSession,
+		requirePermission(schema.PermissionFileRead),
+		ctrl.list,
+	)
+
 	// 上传文件
 	g.POST(
 		"/v1",
@@ -54,6 +197,585 @@ func init() {
 		shouldBeLogin,
 		ctrl.upload,
 	)
+
+	// 获取预签名上传地址
+	g.POST(
+		"/v1/presigned-uploads",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFilePresignedUpload),
+		shouldBeLogin,
+		ctrl.presignedUpload,
+	)
+	// 预签名上传完成，记录文件信息
+	g.POST(
+		"/v1/presigned-uploads/complete",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFilePresignedUploadComplete),
+		shouldBeLogin,
+		ctrl.completePresignedUpload,
+	)
+	// 获取预签名下载地址
+	g.GET(
+		"/v1/{bucket}/{filename}/presigned",
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.presignedGet,
+	)
+
+	// 获取文件的所有版本
+	g.GET(
+		"/v1/{bucket}/{filename}/versions",
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.listVersions,
+	)
+	// 回滚至指定版本
+	g.POST(
+		"/v1/{bucket}/{filename}/versions/{version}/rollback",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFileRollback),
+		shouldBeLogin,
+		ctrl.rollback,
+	)
+
+	// 创建分块上传会话
+	g.POST(
+		"/v1/uploads",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFileUploadSessionCreate),
+		shouldBeLogin,
+		ctrl.createUploadSession,
+	)
+	// 查询分块上传会话的已上传分块
+	g.GET(
+		"/v1/uploads/{id}",
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.getUploadSession,
+	)
+	// 上传分块，数据为请求的body
+	g.PUT(
+		"/v1/uploads/{id}/chunks/{number}",
+		loadUserSession,
+		shouldBeLogin,
+		ctrl.putUploadChunk,
+	)
+	// 完成分块上传，合并所有分块
+	g.POST(
+		"/v1/uploads/{id}/complete",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFileUploadSessionComplete),
+		shouldBeLogin,
+		ctrl.completeUploadSession,
+	)
+	// 终止分块上传
+	g.DELETE(
+		"/v1/uploads/{id}",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFileUploadSessionAbort),
+		shouldBeLogin,
+		ctrl.abortUploadSession,
+	)
+
+	// 获取文件
+	g.GET(
+		"/v1/{bucket}/{filename}",
+		loadUserSession,
+		ctrl.get,
+	)
+
+	// 删除文件
+	g.DELETE(
+		"/v1/{bucket}/{filename}",
+		loadUserSession,
+		newTrackerMiddleware(cs.ActionFileDelete),
+		shouldBeLogin,
+		ctrl.delete,
+	)
+}
+
+// parseRange 解析range请求头，仅支持单个范围，
+// 如果返回nil表示读取整个文件
+func parseRange(value string, size int64) (*fileRange, error) {
+	errInvalidRange := hes.NewWithStatusCode("请求的范围不合法", http.StatusRequestedRangeNotSatisfiable, errFileCategory)
+	prefix := "bytes="
+	if !strings.HasPrefix(value, prefix) {
+		return nil, nil
+	}
+	value = strings.TrimSpace(value[len(prefix):])
+	// 多个范围的则忽略，返回整个文件
+	if strings.Contains(value, ",") {
+		return nil, nil
+	}
+	arr := strings.SplitN(value, "-", 2)
+	if len(arr) != 2 {
+		return nil, errInvalidRange
+	}
+	startValue := strings.TrimSpace(arr[0])
+	endValue := strings.TrimSpace(arr[1])
+	// 读取最后的N个字节，如bytes=-500
+	if startValue == "" {
+		n, err := strconv.ParseInt(endValue, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return &fileRange{
+			start:  size - n,
+			length: n,
+		}, nil
+	}
+	start, err := strconv.ParseInt(startValue, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return nil, errInvalidRange
+	}
+	end := size - 1
+	if endValue != "" {
+		end, err = strconv.ParseInt(endValue, 10, 64)
+		if err != nil || end < start {
+			return nil, errInvalidRange
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return &fileRange{
+		start:  start,
+		length: end - start + 1,
+	}, nil
+}
+
+// getPresignedTTL 获取预签名地址的有效期
+func getPresignedTTL(ttl int) time.Duration {
+	if ttl <= 0 {
+		return defaultPresignedTTL
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// toImageOptions 转换为图片处理参数
+func (params *fileImageParams) toImageOptions() service.ImageOptions {
+	return service.ImageOptions{
+		Width:   params.Width,
+		Height:  params.Height,
+		Fit:     params.Fit,
+		Type:    params.Type,
+		Quality: params.Quality,
+	}
+}
+
+// saveImageVariant 根据原图生成衍生图片并保存至同一bucket
+func saveImageVariant(ctx context.Context, file *storage.File, r io.Reader, opts service.ImageOptions) (string, error) {
+	data, contentType, err := service.ProcessImage(r, file.ContentType, opts)
+	if err != nil {
+		return "", err
+	}
+	name := opts.VariantName(file.Filename, file.ContentType)
+	err = storage.Default().Put(ctx, storage.File{
+		Bucket:      file.Bucket,
+		Filename:    name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Creator:     file.Creator,
+		Data:        data,
+		Metadata: http.Header{
+			"Source": []string{
+				file.Filename,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// openImageVariant 打开图片的衍生图片，如果不存在且允许生成则根据原图生成，
+// 读取或生成衍生图片前先使用check校验原图是否可读取
+func openImageVariant(ctx context.Context, bucket, filename string, opts service.ImageOptions, creatable bool, check func(file *storage.File) error) (*storage.File, io.ReadSeekCloser, error) {
+	fileStorage := storage.Default()
+	file, r, err := fileStorage.Open(ctx, bucket, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	err = check(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	variant, vr, err := fileStorage.Open(ctx, bucket, opts.VariantName(filename, file.ContentType))
+	if err == nil {
+		return variant, vr, nil
+	}
+	if !storage.IsFileNotFound(err) {
+		return nil, nil, err
+	}
+	// 每个参数组合均会保存一个衍生图片，因此仅允许登录用户生成
+	if !creatable {
+		return nil, nil, hes.NewWithStatusCode("请先登录再生成图片", http.StatusUnauthorized, errFileCategory)
+	}
+	name, err := saveImageVariant(ctx, file, r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fileStorage.Open(ctx, bucket, name)
+}
+
+// deleteImageVariants 删除图片的所有衍生图片，衍生图片的文件名以原文件名@为前缀
+func deleteImageVariants(ctx context.Context, bucket, filename string) error {
+	const limit = 100
+	fileStorage := storage.Default()
+	// 每次删除后重新查询，直至无衍生图片
+	for {
+		files, err := fileStorage.Query(ctx, storage.FileFilterParams{
+			Fields: "filename",
+			Limit:  limit,
+			Bucket: bucket,
+			Prefix: filename + "@",
+		})
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			err = fileStorage.Delete(ctx, bucket, file.Filename)
+			if err != nil && !storage.IsFileNotFound(err) {
+				return err
+			}
+		}
+		if len(files) < limit {
+			return nil
+		}
+	}
+}
+
+// getFilePresigner 获取预签名地址生成，当前存储驱动不支持时返回出错
+func getFilePresigner() (storage.FilePresigner, error) {
+	presigner := storage.Presigner()
+	if presigner == nil {
+		return nil, hes.NewWithStatusCode("当前文件存储不支持预签名地址", http.StatusNotImplemented, errFileCategory)
+	}
+	return presigner, nil
+}
+
+// 部分常用文件类型的扩展名
+var fileExtensions = map[string]string{
+	"image/jpeg":               "jpg",
+	"image/svg+xml":            "svg",
+	"text/plain":               "txt",
+	"application/octet-stream": "bin",
+}
+
+// getFileExtension 根据文件类型获取扩展名，无法识别时为bin
+func getFileExtension(contentType string) string {
+	if ext, ok := fileExtensions[contentType]; ok {
+		return ext
+	}
+	_, subType, found := strings.Cut(contentType, "/")
+	// 如vnd.ms-excel，只取最后一部分
+	if index := strings.LastIndexAny(subType, ".+-"); index != -1 {
+		subType = subType[index+1:]
+	}
+	if !found || subType == "" {
+		return "bin"
+	}
+	return subType
+}
+
+// getFileMultipartUploader 获取分块上传，当前存储驱动不支持时返回出错
+func getFileMultipartUploader() (storage.FileMultipartUploader, error) {
+	uploader := storage.MultipartUploader()
+	if uploader == nil {
+		return nil, hes.NewWithStatusCode("当前文件存储不支持分块上传", http.StatusNotImplemented, errFileCategory)
+	}
+	return uploader, nil
+}
+
+// newFileUploadSessionResp 根据上传会话生成响应
+func newFileUploadSessionResp(session *service.UploadSession) *fileUploadSessionResp {
+	return &fileUploadSessionResp{
+		ID:             session.ID,
+		Filename:       session.Filename,
+		Size:           session.Size,
+		ChunkSize:      session.ChunkSize,
+		Chunks:         session.Chunks(),
+		ExpiredAt:      session.ExpiredAt,
+		ReceivedRanges: session.ReceivedRanges(),
+		MissingChunks:  session.MissingChunks(),
+	}
+}
+
+// getOwnUploadSession 获取当前用户的上传会话
+func getOwnUploadSession(c *elton.Context, id string) (*service.UploadSession, error) {
+	session, err := service.GetUploadSession(c.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Account != getUserSession(c).MustGetInfo().Account {
+		return nil, hes.NewWithStatusCode("禁止操作该上传会话", http.StatusForbidden, errFileCategory)
+	}
+	return session, nil
+}
+
+// genFilename 根据文件类型生成文件名
+func genFilename(contentType string) string {
+	return util.GenXID() + "." + getFileExtension(contentType)
+}
+
+// detectContentType 根据文件数据获取文件类型（不包括charset等参数）
+func detectContentType(data []byte) string {
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return strings.TrimSpace(contentType)
+}
+
+// sniffContentType 读取文件的前512字节判断文件类型
+func sniffContentType(r io.Reader) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return detectContentType(buf[:n]), nil
+}
+
+// saveUploadedFile 直接上传至存储的文件（预签名或分块上传）未计算sha256与去重，
+// 因此以流的方式读取计算后转换为数据文件的引用，同时以真实的文件类型保存，返回保存后的文件信息
+func saveUploadedFile(ctx context.Context, bucket, filename, contentType string) (*storage.File, error) {
+	return storage.CompleteUpload(ctx, bucket, filename, contentType)
+}
+
+// isFileCreatorOrAdmin 判断是否文件创建者或拥有文件更新权限
+func isFileCreatorOrAdmin(c *elton.Context, file *storage.File) bool {
+	userInfo := getUserSession(c).MustGetInfo()
+	if file.Creator == userInfo.Account {
+		return true
+	}
+	return hasPermission(userInfo, schema.PermissionFileWrite)
+}
+
+// checkFileReadable 校验当前用户是否可读取bucket中的文件，公开的bucket允许匿名读取，
+// 否则需要登录，file为nil时仅校验是否登录
+func checkFileReadable(c *elton.Context, bucket string, file *storage.File) error {
+	if service.GetFilePolicy(bucket).Public {
+		return nil
+	}
+	if !isLogin(c) {
+		return hes.NewWithStatusCode("请先登录", http.StatusUnauthorized, errFileCategory)
+	}
+	if file != nil && !isFileCreatorOrAdmin(c, file) {
+		return hes.NewWithStatusCode("仅允许创建者或管理员获取文件", http.StatusForbidden, errFileCategory)
+	}
+	return nil
+}
+
+// quoteETag 对etag添加双引号
+func quoteETag(eTag string) string {
+	if eTag == "" ||
+		strings.HasPrefix(eTag, "W/") ||
+		strings.HasPrefix(eTag, `"`) {
+		return eTag
+	}
+	return `"` + eTag + `"`
+}
+
+// toFilterParams 转换为文件存储的筛选参数
+func (params *fileListParams) toFilterParams() storage.FileFilterParams {
+	return storage.FileFilterParams{
+		Fields:      params.Fields,
+		Limit:       params.GetLimit(),
+		Offset:      params.GetOffset(),
+		Bucket:      params.Bucket,
+		Creator:     params.Creator,
+		ContentType: params.ContentType,
+		Begin:       params.Begin,
+		End:         params.End,
+	}
+}
+
+// list 查询文件列表
+func (*fileCtrl) list(c *elton.Context) error {
+	params := fileListParams{}
+	err := validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	filterParams := params.toFilterParams()
+	count := int64(-1)
+	if params.ShouldCount() {
+		count, err = storage.Default().Count(c.Context(), filterParams)
+		if err != nil {
+			return err
+		}
+	}
+	files, err := storage.Default().Query(c.Context(), filterParams)
+	if err != nil {
+		return err
+	}
+	c.Body = &fileListResp{
+		Files: files,
+		Count: count,
+	}
+	return nil
+}
+
+// get 获取文件，支持range请求，非公开的bucket仅允许创建者或管理员获取
+func (*fileCtrl) get(c *elton.Context) error {
+	params := fileParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	err = checkFileReadable(c, params.Bucket, nil)
+	if err != nil {
+		return err
+	}
+	imageParams := fileImageParams{}
+	err = validateQuery(c, &imageParams)
+	if err != nil {
+		return err
+	}
+	opts := imageParams.toImageOptions()
+	check := func(file *storage.File) error {
+		return checkFileReadable(c, params.Bucket, file)
+	}
+	var file *storage.File
+	var r io.ReadSeekCloser
+	if opts.IsEmpty() {
+		file, r, err = storage.Default().Open(c.Context(), params.Bucket, params.Filename)
+		if err != nil {
+			return err
+		}
+		err = check(file)
+		if err != nil {
+			_ = r.Close()
+			return err
+		}
+	} else {
+		// 校验原图是否可读取，避免无权限的用户生成衍生图片
+		file, r, err = openImageVariant(c.Context(), params.Bucket, params.Filename, opts, isLogin(c), check)
+		if err != nil {
+			return err
+		}
+	}
+	c.SetHeader(elton.HeaderContentType, file.ContentType)
+	c.SetHeader("Accept-Ranges", "bytes")
+	c.SetHeader(elton.HeaderETag, quoteETag(file.ETag))
+	c.SetHeader(elton.HeaderLastModified, file.CreatedAt.UTC().Format(http.TimeFormat))
+	// 数据为reader，fresh中间件不会处理，因此需要自行判断是否304
+	if elton.Fresh(c.Request.Header, c.Header()) {
+		_ = r.Close()
+		c.NotModified()
+		return nil
+	}
+
+	rangeInfo, err := parseRange(c.GetRequestHeader("Range"), file.Size)
+	if err != nil {
+		_ = r.Close()
+		c.SetHeader("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+		return err
+	}
+	if rangeInfo == nil {
+		c.SetHeader(elton.HeaderContentLength, strconv.FormatInt(file.Size, 10))
+		c.Body = r
+		return nil
+	}
+	_, err = r.Seek(rangeInfo.start, io.SeekStart)
+	if err != nil {
+		_ = r.Close()
+		return err
+	}
+	end := rangeInfo.start + rangeInfo.length - 1
+	c.SetHeader("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeInfo.start, end, file.Size))
+	c.SetHeader(elton.HeaderContentLength, strconv.FormatInt(rangeInfo.length, 10))
+	c.StatusCode = http.StatusPartialContent
+	c.Body = &limitReadCloser{
+		Reader: io.LimitReader(r, rangeInfo.length),
+		Closer: r,
+	}
+	return nil
+}
+
+// checkFileCreatorOrAdmin 校验当前用户是否文件创建者或管理员
+func checkFileCreatorOrAdmin(c *elton.Context, bucket, filename, message string) error {
+	file, r, err := storage.Default().Open(c.Context(), bucket, filename)
+	if err != nil {
+		return err
+	}
+	_ = r.Close()
+	if !isFileCreatorOrAdmin(c, file) {
+		return hes.NewWithStatusCode(message, http.StatusForbidden, errFileCategory)
+	}
+	return nil
+}
+
+// listVersions 获取文件的所有版本，仅允许创建者或管理员获取
+func (*fileCtrl) listVersions(c *elton.Context) error {
+	params := fileParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	err = checkFileCreatorOrAdmin(c, params.Bucket, params.Filename, "仅允许创建者或管理员获取文件版本")
+	if err != nil {
+		return err
+	}
+	versions, err := storage.Default().ListVersions(c.Context(), params.Bucket, params.Filename)
+	if err != nil {
+		return err
+	}
+	c.Body = &fileVersionListResp{
+		Versions: versions,
+	}
+	return nil
+}
+
+// rollback 将文件回滚至指定版本，回滚后生成新的版本
+func (*fileCtrl) rollback(c *elton.Context) error {
+	params := fileVersionParams{}
+	err := validate.Query(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	err = checkFileCreatorOrAdmin(c, params.Bucket, params.Filename, "仅允许创建者或管理员回滚文件")
+	if err != nil {
+		return err
+	}
+	fileStorage := storage.Default()
+	file, err := fileStorage.GetVersion(c.Context(), params.Bucket, params.Filename, params.Version)
+	if err != nil {
+		return err
+	}
+	file.Creator = getUserSession(c).MustGetInfo().Account
+	err = fileStorage.Put(c.Context(), *file)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// delete 删除文件，仅允许创建者或管理员删除
+func (*fileCtrl) delete(c *elton.Context) error {
+	params := fileParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	err = checkFileCreatorOrAdmin(c, params.Bucket, params.Filename, "仅允许创建者或管理员删除文件")
+	if err != nil {
+		return err
+	}
+	err = storage.Default().Delete(c.Context(), params.Bucket, params.Filename)
+	if err != nil {
+		return err
+	}
+	err = deleteImageVariants(c.Context(), params.Bucket, params.Filename)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
 }
 
 // upload 上传文件
@@ -64,29 +786,445 @@ func (*fileCtrl) upload(c *elton.Context) error {
 		return err
 	}
 
+	policy := service.GetFilePolicy(params.Bucket)
+	// 限制请求数据大小，multipart的其它数据预留1MB
+	c.Request.Body = http.MaxBytesReader(c.Response, c.Request.Body, policy.MaxSize+maxMultipartOverhead)
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return policy.ValidateSize(maxBytesErr.Limit)
+		}
 		return err
 	}
 	defer file.Close()
-	us := getUserSession(c)
-	contentType := header.Header.Get("Content-Type")
-	fileType := strings.Split(contentType, "/")[1]
-	name := util.GenXID() + "." + fileType
-	err = storage.Minio().Put(c.Context(), storage.File{
+	// 多读取一个字节用于判断是否超出限制
+	data, err := io.ReadAll(io.LimitReader(file, policy.MaxSize+1))
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+	err = policy.ValidateSize(size)
+	if err != nil {
+		return err
+	}
+	// 不使用客户端提交的类型，根据数据判断真实的文件类型
+	contentType := detectContentType(data)
+	err = policy.ValidateContentType(contentType)
+	if err != nil {
+		return err
+	}
+	account := getUserSession(c).MustGetInfo().Account
+	err = policy.IncUploadCount(c.Context(), account)
+	if err != nil {
+		return err
+	}
+	name := genFilename(contentType)
+	err = storage.Default().Put(c.Context(), storage.File{
 		Bucket:      params.Bucket,
 		Filename:    name,
 		ContentType: contentType,
-		Size:        header.Size,
-		Creator:     us.MustGetInfo().Account,
+		Size:        size,
+		Creator:     account,
+		Data:        data,
+		Metadata: http.Header{
+			"Filename": []string{
+				header.Filename,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// 生成缩略图失败不影响上传，仅记录日志
+	if service.IsImageContentType(contentType) {
+		for _, opts := range policy.Thumbnails {
+			_, err := saveImageVariant(c.Context(), &storage.File{
+				Bucket:      params.Bucket,
+				Filename:    name,
+				ContentType: contentType,
+				Creator:     account,
+			}, bytes.NewReader(data), opts)
+			if err != nil {
+				log.Error(c.Context()).
+					Err(err).
+					Str("file", name).
+					Msg("create thumbnail fail")
+			}
+		}
+	}
+
+	c.Body = &fileUploadResp{
+		Name:        name,
+		Size:        size,
+		ContentType: contentType,
+	}
+	return nil
+}
+
+// presignedUpload 获取预签名上传地址，客户端可直接上传文件至对象存储，
+// 上传完成后需调用完成接口记录文件信息
+func (*fileCtrl) presignedUpload(c *elton.Context) error {
+	params := filePresignedUploadParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	policy := service.GetFilePolicy(params.Bucket)
+	err = policy.ValidateContentType(params.ContentType)
+	if err != nil {
+		return err
+	}
+	account := getUserSession(c).MustGetInfo().Account
+	err = policy.IncUploadCount(c.Context(), account)
+	if err != nil {
+		return err
+	}
+	name := genFilename(params.ContentType)
+	ttl := getPresignedTTL(params.TTL)
+	presigner, err := getFilePresigner()
+	if err != nil {
+		return err
+	}
+	result, err := presigner.PresignedPut(c.Context(), storage.File{
+		Bucket:      params.Bucket,
+		Filename:    name,
+		ContentType: params.ContentType,
+		Creator:     account,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+	// 上传记录的有效期比地址长一分钟，避免临近过期时上传完成无法记录
+	err = service.AddPresignedUpload(c.Context(), service.PresignedUpload{
+		Bucket:      params.Bucket,
+		Filename:    name,
+		ContentType: params.ContentType,
+		Account:     account,
+	}, ttl+time.Minute)
+	if err != nil {
+		return err
+	}
+	c.Body = &filePresignedUploadResp{
+		Filename:     name,
+		PresignedURL: result,
+	}
+	return nil
+}
+
+// completePresignedUpload 预签名上传完成，校验文件后记录文件信息
+func (*fileCtrl) completePresignedUpload(c *elton.Context) error {
+	params := filePresignedUploadCompleteParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	account := getUserSession(c).MustGetInfo().Account
+	upload, err := service.GetPresignedUpload(ctx, params.Filename)
+	if err != nil {
+		return err
+	}
+	if upload.Account != account || upload.Bucket != params.Bucket {
+		return hes.NewWithStatusCode("禁止操作该上传记录", http.StatusForbidden, errFileCategory)
+	}
+	info, r, err := storage.Default().Open(ctx, params.Bucket, params.Filename)
+	if err != nil {
+		return err
+	}
+	// 上传时contentType由客户端指定，因此根据文件数据判断真实的文件类型
+	contentType, err := sniffContentType(r)
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+	// 上传时creator已签名，正常情况下必定相同
+	if info.Creator != account {
+		return hes.NewWithStatusCode("文件创建者不一致", http.StatusForbidden, errFileCategory)
+	}
+	// 预签名上传无法限制文件大小与类型，因此完成时校验，不符合则删除
+	policy := service.GetFilePolicy(params.Bucket)
+	err = policy.ValidateSize(info.Size)
+	if err == nil {
+		err = policy.ValidateContentType(contentType)
+	}
+	if err != nil {
+		_ = storage.Default().Delete(ctx, params.Bucket, params.Filename)
+		return err
+	}
+	// 记录文件信息后删除上传记录失败时，客户端重试则返回已记录的文件信息
+	result, err := getFileClient().Query().
+		Where(file.Bucket(params.Bucket)).
+		Where(file.Filename(params.Filename)).
+		Where(file.Creator(account)).
+		First(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return err
+	}
+	if result == nil {
+		info, err = saveUploadedFile(ctx, params.Bucket, params.Filename, contentType)
+		if err != nil {
+			return err
+		}
+		result, err = createPresignedFileRecord(ctx, params.Bucket, params.Filename, account, info)
+		if err != nil {
+			return err
+		}
+	}
+	err = service.DelPresignedUpload(ctx, params.Filename)
+	if err != nil {
+		return err
+	}
+	c.Created(result)
+	return nil
+}
+
+// createPresignedFileRecord 记录预签名上传的文件信息，数据保存在对象存储中，因此只记录文件信息
+func createPresignedFileRecord(ctx context.Context, bucket, filename, account string, info *storage.File) (*ent.File, error) {
+	return getFileClient().Create().
+		SetBucket(bucket).
+		SetFilename(filename).
+		SetContentType(info.ContentType).
+		SetSize(info.Size).
+		SetMetadata(&http.Header{
+			elton.HeaderETag: []string{
+				info.ETag,
+			},
+		}).
+		SetCreator(account).
+		SetData([]byte{}).
+		SetChecksum(info.Checksum).
+		Save(ctx)
+}
+
+// presignedGet 获取预签名下载地址，仅允许创建者或管理员获取
+func (*fileCtrl) presignedGet(c *elton.Context) error {
+	params := fileParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	getParams := filePresignedGetParams{}
+	err = validateQuery(c, &getParams)
+	if err != nil {
+		return err
+	}
+	file, r, err := storage.Default().Open(c.Context(), params.Bucket, params.Filename)
+	if err != nil {
+		return err
+	}
+	_ = r.Close()
+	if !isFileCreatorOrAdmin(c, file) {
+		return hes.NewWithStatusCode("仅允许创建者或管理员获取下载地址", http.StatusForbidden, errFileCategory)
+	}
+	presigner, err := getFilePresigner()
+	if err != nil {
+		return err
+	}
+	result, err := presigner.PresignedGet(c.Context(), params.Bucket, params.Filename, getPresignedTTL(getParams.TTL))
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// createUploadSession 创建分块上传会话
+func (*fileCtrl) createUploadSession(c *elton.Context) error {
+	params := fileUploadSessionCreateParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	if params.ChunkSize == 0 {
+		params.ChunkSize = defaultChunkSize
+	}
+	if (params.Size+params.ChunkSize-1)/params.ChunkSize > maxChunks {
+		return hes.New("分块数量过多，请增大分块大小", errFileCategory)
+	}
+	policy := service.GetFilePolicy(params.Bucket)
+	err = policy.ValidateContentType(params.ContentType)
+	if err != nil {
+		return err
+	}
+	err = policy.ValidateSize(params.Size)
+	if err != nil {
+		return err
+	}
+	uploader, err := getFileMultipartUploader()
+	if err != nil {
+		return err
+	}
+	account := getUserSession(c).MustGetInfo().Account
+	err = policy.IncUploadCount(c.Context(), account)
+	if err != nil {
+		return err
+	}
+	name := genFilename(params.ContentType)
+	uploadID, err := uploader.NewMultipartUpload(c.Context(), storage.File{
+		Bucket:      params.Bucket,
+		Filename:    name,
+		ContentType: params.ContentType,
+		Creator:     account,
 	})
 	if err != nil {
 		return err
 	}
+	now := time.Now()
+	session := &service.UploadSession{
+		ID:          util.GenXID(),
+		Bucket:      params.Bucket,
+		Filename:    name,
+		ContentType: params.ContentType,
+		Account:     account,
+		UploadID:    uploadID,
+		Size:        params.Size,
+		ChunkSize:   params.ChunkSize,
+		CreatedAt:   now,
+		ExpiredAt:   now.Add(service.UploadSessionTTL),
+	}
+	err = service.AddUploadSession(c.Context(), session)
+	if err != nil {
+		return err
+	}
+	c.Created(newFileUploadSessionResp(session))
+	return nil
+}
+
+// getUploadSession 获取分块上传会话，用于断点续传时查询已上传的分块
+func (*fileCtrl) getUploadSession(c *elton.Context) error {
+	params := fileUploadSessionParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	session, err := getOwnUploadSession(c, params.ID)
+	if err != nil {
+		return err
+	}
+	c.Body = newFileUploadSessionResp(session)
+	return nil
+}
 
+// putUploadChunk 上传分块，重复上传同一分块则覆盖
+func (*fileCtrl) putUploadChunk(c *elton.Context) error {
+	params := fileUploadChunkParams{}
+	err := validate.Query(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	session, err := getOwnUploadSession(c, params.ID)
+	if err != nil {
+		return err
+	}
+	size := session.GetChunkSize(params.Number)
+	if size == 0 {
+		return hes.New("分块序号不合法", errFileCategory)
+	}
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != size {
+		return hes.New(fmt.Sprintf("分块大小应为%d", size), errFileCategory)
+	}
+	uploader, err := getFileMultipartUploader()
+	if err != nil {
+		return err
+	}
+	part, err := uploader.PutPart(
+		c.Context(),
+		session.Bucket,
+		session.Filename,
+		session.UploadID,
+		params.Number,
+		io.LimitReader(c.Request.Body, size),
+		size,
+	)
+	if err != nil {
+		return err
+	}
+	session, err = service.AddUploadSessionPart(c.Context(), session.ID, *part)
+	if err != nil {
+		return err
+	}
+	c.Body = newFileUploadSessionResp(session)
+	return nil
+}
+
+// completeUploadSession 完成分块上传，合并后根据数据校验文件类型
+func (*fileCtrl) completeUploadSession(c *elton.Context) error {
+	params := fileUploadSessionParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	session, err := getOwnUploadSession(c, params.ID)
+	if err != nil {
+		return err
+	}
+	if len(session.MissingChunks()) != 0 {
+		return hes.New("还有分块未上传", errFileCategory)
+	}
+	uploader, err := getFileMultipartUploader()
+	if err != nil {
+		return err
+	}
+	err = uploader.CompleteMultipartUpload(ctx, session.Bucket, session.Filename, session.UploadID, session.SortedParts())
+	if err != nil {
+		return err
+	}
+	_ = service.DelUploadSession(ctx, session.ID)
+
+	_, r, err := storage.Default().Open(ctx, session.Bucket, session.Filename)
+	if err != nil {
+		return err
+	}
+	// 根据文件数据判断真实的文件类型
+	contentType, err := sniffContentType(r)
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+	err = service.GetFilePolicy(session.Bucket).ValidateContentType(contentType)
+	if err != nil {
+		_ = storage.Default().Delete(ctx, session.Bucket, session.Filename)
+		return err
+	}
+	// 创建会话时的文件类型由客户端指定，因此以真实的类型保存
+	_, err = saveUploadedFile(ctx, session.Bucket, session.Filename, contentType)
+	if err != nil {
+		return err
+	}
 	c.Body = &fileUploadResp{
-		Name: name,
-		Size: header.Size,
+		Name:        session.Filename,
+		Size:        session.Size,
+		ContentType: contentType,
+	}
+	return nil
+}
+
+// abortUploadSession 终止分块上传，删除已上传的分块
+func (*fileCtrl) abortUploadSession(c *elton.Context) error {
+	params := fileUploadSessionParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	session, err := getOwnUploadSession(c, params.ID)
+	if err != nil {
+		return err
+	}
+	uploader, err := getFileMultipartUploader()
+	if err != nil {
+		return err
+	}
+	err = uploader.AbortMultipartUpload(c.Context(), session.Bucket, session.Filename, session.UploadID)
+	if err != nil {
+		return err
+	}
+	err = service.DelUploadSession(c.Context(), session.ID)
+	if err != nil {
+		return err
 	}
+	c.NoContent()
 	return nil
 }
@@ -0,0 +1,145 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+func TestParseRange(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		value  string
+		size   int64
+		result *fileRange
+		err    bool
+	}{
+		{
+			value: "",
+			size:  100,
+		},
+		{
+			value: "bytes=0-9,20-29",
+			size:  100,
+		},
+		{
+			value:  "bytes=0-9",
+			size:   100,
+			result: &fileRange{start: 0, length: 10},
+		},
+		{
+			value:  "bytes=90-",
+			size:   100,
+			result: &fileRange{start: 90, length: 10},
+		},
+		{
+			value:  "bytes=-20",
+			size:   100,
+			result: &fileRange{start: 80, length: 20},
+		},
+		{
+			value:  "bytes=50-200",
+			size:   100,
+			result: &fileRange{start: 50, length: 50},
+		},
+		{
+			value: "bytes=100-",
+			size:  100,
+			err:   true,
+		},
+		{
+			value: "bytes=20-10",
+			size:  100,
+			err:   true,
+		},
+		{
+			value: "bytes=a-b",
+			size:  100,
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		result, err := parseRange(tt.value, tt.size)
+		if tt.err {
+			assert.NotNil(err, tt.value)
+			continue
+		}
+		assert.Nil(err, tt.value)
+		assert.Equal(tt.result, result, tt.value)
+	}
+}
+
+func TestQuoteETag(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`"abc"`, quoteETag("abc"))
+	assert.Equal(`"abc"`, quoteETag(`"abc"`))
+	assert.Equal(`W/"abc"`, quoteETag(`W/"abc"`))
+	assert.Empty(quoteETag(""))
+}
+
+func TestGetPresignedTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(defaultPresignedTTL, getPresignedTTL(0))
+	assert.Equal(2*time.Minute, getPresignedTTL(120))
+}
+
+func TestGetFileExtension(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("png", getFileExtension("image/png"))
+	assert.Equal("jpg", getFileExtension("image/jpeg"))
+	assert.Equal("txt", getFileExtension("text/plain"))
+	assert.Equal("excel", getFileExtension("application/vnd.ms-excel"))
+	assert.Equal("bin", getFileExtension("abc"))
+	assert.Equal("bin", getFileExtension(""))
+}
+
+func TestDetectContentType(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("text/plain", detectContentType([]byte("abc")))
+	assert.Equal("image/png", detectContentType([]byte("\x89PNG\x0D\x0A\x1A\x0A")))
+
+	contentType, err := sniffContentType(strings.NewReader("\x89PNG\x0D\x0A\x1A\x0A"))
+	assert.Nil(err)
+	assert.Equal("image/png", contentType)
+	contentType, err = sniffContentType(strings.NewReader(""))
+	assert.Nil(err)
+	assert.Equal("text/plain", contentType)
+}
+
+func TestFileGetAnonymous(t *testing.T) {
+	assert := assert.New(t)
+	ctrl := fileCtrl{}
+
+	c, _ := newContextAndUserSession()
+	c.Request = httptest.NewRequest("GET", "/files/v1/files/abc.txt", nil)
+	c.Params = new(elton.RouteParams)
+	c.Params.Add("bucket", "files")
+	c.Params.Add("filename", "abc.txt")
+	err := ctrl.get(c)
+	assert.Equal(http.StatusUnauthorized, err.(*hes.Error).StatusCode)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/vicanso/forest/cs"
 	"github.com/vicanso/forest/influx"
 	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
 	"github.com/vicanso/forest/validate"
 )
 
@@ -83,20 +84,20 @@ func init() {
 	// 查询用户tracker
 	g.GET(
 		"/v1/trackers",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionFluxRead),
 		ctrl.listTracker,
 	)
 	// 查询http出错
 	g.GET(
 		"/v1/http-errors",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionFluxRead),
 		ctrl.listHTTPError,
 	)
 
 	// 获取request相关调用统计
 	g.GET(
 		"/v1/requests",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionFluxRead),
 		ctrl.listRequest,
 	)
 
@@ -0,0 +1,501 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户分组相关管理，用户按职能分配至不同的分组，
+// 用户的分组保存在用户信息中，登录时加载至session
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqljson"
+	"github.com/iancoleman/strcase"
+	"github.com/samber/lo"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/group"
+	"github.com/vicanso/forest/ent/predicate"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/hes"
+)
+
+type groupCtrl struct{}
+
+// 响应相关定义
+type (
+	// groupListResp 分组列表响应
+	groupListResp struct {
+		Groups []*ent.Group `json:"groups"`
+		Count  int          `json:"count"`
+	}
+)
+
+// 参数相关定义
+type (
+	// groupAddParams 添加分组参数
+	groupAddParams struct {
+		Name        string `json:"name" validate:"required,xUserGroup"`
+		Description string `json:"description" validate:"omitempty,xUserGroupDescription"`
+	}
+	// groupUpdateParams 更新分组参数
+	groupUpdateParams struct {
+		Status      schema.Status `json:"status" validate:"omitempty,xStatus"`
+		Description string        `json:"description" validate:"omitempty,xUserGroupDescription"`
+	}
+	// groupListParams 分组查询参数
+	groupListParams struct {
+		listParams
+
+		Name string `json:"name" validate:"omitempty,xUserGroup"`
+	}
+	// groupMemberAddParams 添加分组成员参数
+	groupMemberAddParams struct {
+		Accounts []string `json:"accounts" validate:"required,min=1,max=100,dive,xUserAccount"`
+	}
+	// groupMemberRemoveParams 移除分组成员参数
+	groupMemberRemoveParams struct {
+		Account string `json:"account" validate:"required,xUserAccount"`
+	}
+)
+
+const (
+	errGroupCategory = "group"
+)
+
+func init() {
+	g := router.NewGroup(
+		"/groups",
+		loadUserSession,
+	)
+	ctrl := groupCtrl{}
+
+	// 查询分组
+	g.GET(
+		"/v1",
+		requirePermission(schema.PermissionGroupRead),
+		ctrl.list,
+	)
+
+	// 添加分组
+	g.POST(
+		"/v1",
+		newTrackerMiddleware(cs.ActionGroupAdd),
+		requirePermission(schema.PermissionGroupWrite),
+		ctrl.add,
+	)
+
+	// 查询单个分组
+	g.GET(
+		"/v1/{id}",
+		requirePermission(schema.PermissionGroupRead),
+		ctrl.findByID,
+	)
+
+	// 更新分组
+	g.PATCH(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionGroupUpdate),
+		requirePermission(schema.PermissionGroupWrite),
+		ctrl.update,
+	)
+
+	// 删除分组
+	g.DELETE(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionGroupDelete),
+		requirePermission(schema.PermissionGroupWrite),
+		ctrl.delete,
+	)
+
+	// 查询分组成员
+	g.GET(
+		"/v1/{id}/members",
+		requirePermission(schema.PermissionGroupRead),
+		ctrl.listMember,
+	)
+
+	// 添加分组成员
+	g.POST(
+		"/v1/{id}/members",
+		newTrackerMiddleware(cs.ActionGroupMemberAdd),
+		requirePermission(schema.PermissionGroupWrite),
+		ctrl.addMember,
+	)
+
+	// 移除分组成员
+	g.DELETE(
+		"/v1/{id}/members/{account}",
+		newTrackerMiddleware(cs.ActionGroupMemberRemove),
+		requirePermission(schema.PermissionGroupWrite),
+		ctrl.removeMember,
+	)
+}
+
+func getGroupClient() *ent.GroupClient {
+	return helper.EntGetClient().Group
+}
+
+// hasGroup 用户分组的查询条件
+func hasGroup(name string) predicate.User {
+	return predicate.User(func(s *sql.Selector) {
+		s.Where(sqljson.ValueContains(user.FieldGroups, name))
+	})
+}
+
+// validateGroups 校验分组是否均存在且启用
+func validateGroups(ctx context.Context, names []string) error {
+	names = lo.Uniq(names)
+	result, err := getGroupClient().Query().
+		Where(group.NameIn(names...)).
+		Where(group.StatusEQ(schema.StatusEnabled)).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, found := lo.Find(result, func(item *ent.Group) bool {
+			return item.Name == name
+		})
+		if !found {
+			return hes.New("分组不存在或已禁用："+name, errGroupCategory)
+		}
+	}
+	return nil
+}
+
+// validateBeforeSave 保存前校验
+func (params *groupAddParams) validateBeforeSave(ctx context.Context) error {
+	exists, err := getGroupClient().Query().
+		Where(group.Name(params.Name)).
+		Exist(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return hes.New("该分组已存在", errGroupCategory)
+	}
+	return nil
+}
+
+// save 保存分组
+func (params *groupAddParams) save(ctx context.Context, owner string) (*ent.Group, error) {
+	err := params.validateBeforeSave(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return getGroupClient().Create().
+		SetName(params.Name).
+		SetDescription(params.Description).
+		SetOwner(owner).
+		Save(ctx)
+}
+
+// where 将查询条件中的参数转换为对应的where条件
+func (params *groupListParams) where(query *ent.GroupQuery) *ent.GroupQuery {
+	if params.Name != "" {
+		query.Where(group.NameContains(params.Name))
+	}
+	return query
+}
+
+// GetOrders 获取排序的函数列表
+func (params *groupListParams) GetOrders() []group.OrderOption {
+	if params.Order == "" {
+		return nil
+	}
+	arr := strings.Split(params.Order, ",")
+	funcs := make([]group.OrderOption, len(arr))
+	for index, item := range arr {
+		if item[0] == '-' {
+			funcs[index] = ent.Desc(strcase.ToSnake(item[1:]))
+		} else {
+			funcs[index] = ent.Asc(strcase.ToSnake(item))
+		}
+	}
+	return funcs
+}
+
+// queryAll 查询分组列表
+func (params *groupListParams) queryAll(ctx context.Context) ([]*ent.Group, error) {
+	query := getGroupClient().Query()
+
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+
+	return query.All(ctx)
+}
+
+// count 计算总数
+func (params *groupListParams) count(ctx context.Context) (int, error) {
+	query := getGroupClient().Query()
+
+	query = params.where(query)
+
+	return query.Count(ctx)
+}
+
+// updateOneID 更新分组信息
+func (params *groupUpdateParams) updateOneID(ctx context.Context, id int) (*ent.Group, error) {
+	updateOne := getGroupClient().UpdateOneID(id)
+	if params.Status != 0 {
+		updateOne = updateOne.SetStatus(params.Status)
+	}
+	if params.Description != "" {
+		updateOne = updateOne.SetDescription(params.Description)
+	}
+	return updateOne.Save(ctx)
+}
+
+// add 将用户添加至分组，已在分组中的用户则忽略
+func (params *groupMemberAddParams) add(ctx context.Context, name string) error {
+	users, err := getUserClient().Query().
+		Where(user.AccountIn(params.Accounts...)).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	// 先校验所有账号均存在，避免只添加了部分用户
+	for _, account := range params.Accounts {
+		_, found := lo.Find(users, func(item *ent.User) bool {
+			return item.Account == account
+		})
+		if !found {
+			return hes.New("用户不存在："+account, errGroupCategory)
+		}
+	}
+	for _, u := range users {
+		if lo.Contains(u.Groups, name) {
+			continue
+		}
+		_, err = u.Update().
+			SetGroups(append(u.Groups, name)).
+			Save(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove 将用户从分组中移除
+func (params *groupMemberRemoveParams) remove(ctx context.Context, name string) error {
+	u, err := getUserClient().Query().
+		Where(user.Account(params.Account)).
+		Only(ctx)
+	if err != nil {
+		return err
+	}
+	if !lo.Contains(u.Groups, name) {
+		return hes.New("该用户不在分组中", errGroupCategory)
+	}
+	_, err = u.Update().
+		SetGroups(lo.Without(u.Groups, name)).
+		Save(ctx)
+	return err
+}
+
+// add 添加分组
+func (*groupCtrl) add(c *elton.Context) error {
+	params := groupAddParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	us := getUserSession(c)
+	result, err := params.save(c.Context(), us.MustGetInfo().Account)
+	if err != nil {
+		return err
+	}
+	c.Created(result)
+	return nil
+}
+
+// list 查询分组列表
+func (*groupCtrl) list(c *elton.Context) error {
+	params := groupListParams{}
+	err := validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return err
+		}
+	}
+	groups, err := params.queryAll(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &groupListResp{
+		Count:  count,
+		Groups: groups,
+	}
+	return nil
+}
+
+// findByID 通过id查询
+func (*groupCtrl) findByID(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	result, err := getGroupClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// update 更新分组信息
+func (*groupCtrl) update(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	params := groupUpdateParams{}
+	err = validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	result, err := params.updateOneID(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// delete 删除分组，仍有成员的分组不允许删除
+func (*groupCtrl) delete(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	result, err := getGroupClient().Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	exists, err := getUserClient().Query().
+		Where(hasGroup(result.Name)).
+		Exist(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return hes.New("该分组仍有成员，不允许删除", errGroupCategory)
+	}
+	err = getGroupClient().DeleteOneID(id).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// listMember 查询分组成员
+func (*groupCtrl) listMember(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	result, err := getGroupClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	params := userListParams{}
+	err = validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	params.Group = result.Name
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return err
+		}
+	}
+	users, err := params.queryAll(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &userListResp{
+		Count: count,
+		Users: users,
+	}
+	return nil
+}
+
+// addMember 添加分组成员
+func (*groupCtrl) addMember(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	params := groupMemberAddParams{}
+	err = validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	result, err := getGroupClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	if result.Status != schema.StatusEnabled {
+		return hes.New("该分组已禁用", errGroupCategory)
+	}
+	err = params.add(c.Context(), result.Name)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// removeMember 移除分组成员
+func (*groupCtrl) removeMember(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	params := groupMemberRemoveParams{}
+	err = validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	result, err := getGroupClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	err = params.remove(c.Context(), result.Name)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+func TestGroupParams(t *testing.T) {
+	// 测试代码中不执行main，因此在此处调用初始化
+	_ = helper.EntInitSchema()
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	name := util.RandomString(8)
+	account := util.RandomString(8)
+	groupID := 0
+
+	t.Run("save", func(t *testing.T) {
+		params := groupAddParams{
+			Name: name,
+		}
+		group, err := params.save(ctx, "treexie")
+		assert.Nil(err)
+		assert.Equal(name, group.Name)
+		groupID = group.ID
+
+		err = params.validateBeforeSave(ctx)
+		assert.Equal("该分组已存在", err.(*hes.Error).Message)
+	})
+
+	t.Run("validateGroups", func(t *testing.T) {
+		assert.Nil(validateGroups(ctx, []string{name}))
+		assert.NotNil(validateGroups(ctx, []string{name, util.RandomString(8)}))
+	})
+
+	t.Run("member", func(t *testing.T) {
+		_, err := getUserClient().Create().
+			SetAccount(account).
+			SetPassword(util.RandomString(44)).
+			Save(ctx)
+		assert.Nil(err)
+
+		addParams := groupMemberAddParams{
+			Accounts: []string{
+				account,
+				util.RandomString(8),
+			},
+		}
+		// 有账号不存在时不添加
+		err = addParams.add(ctx, name)
+		assert.NotNil(err)
+
+		addParams.Accounts = []string{
+			account,
+		}
+		err = addParams.add(ctx, name)
+		assert.Nil(err)
+		// 重复添加则忽略
+		err = addParams.add(ctx, name)
+		assert.Nil(err)
+
+		listParams := userListParams{
+			Group: name,
+		}
+		users, err := listParams.queryAll(ctx)
+		assert.Nil(err)
+		assert.Equal(1, len(users))
+		assert.Equal(account, users[0].Account)
+		assert.Equal([]string{name}, users[0].Groups)
+
+		removeParams := groupMemberRemoveParams{
+			Account: account,
+		}
+		err = removeParams.remove(ctx, name)
+		assert.Nil(err)
+		users, err = listParams.queryAll(ctx)
+		assert.Nil(err)
+		assert.Equal(0, len(users))
+	})
+
+	_ = getGroupClient().DeleteOneID(groupID).Exec(ctx)
+}
@@ -0,0 +1,392 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 角色相关管理，角色保存于数据库中，每个角色拥有不同的权限
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqljson"
+	"github.com/iancoleman/strcase"
+	"github.com/samber/lo"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/role"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/service"
+	"github.com/vicanso/hes"
+)
+
+type roleCtrl struct{}
+
+// 响应相关定义
+type (
+	// roleListResp 角色列表响应
+	roleListResp struct {
+		Roles []*ent.Role `json:"roles"`
+		Count int         `json:"count"`
+	}
+	// rolePermissionListResp 权限列表响应
+	rolePermissionListResp struct {
+		Permissions []*schema.PermissionInfo `json:"permissions"`
+	}
+)
+
+// 参数相关定义
+type (
+	// roleAddParams 添加角色参数
+	roleAddParams struct {
+		Name        string   `json:"name" validate:"required,xRoleName"`
+		Description string   `json:"description" validate:"omitempty,xRoleDescription"`
+		Permissions []string `json:"permissions" validate:"omitempty,dive,xRolePermission"`
+		// 是否要求拥有该角色的用户启用两步验证
+		RequireTOTP bool `json:"requireTOTP"`
+	}
+	// roleUpdateParams 更新角色参数
+	roleUpdateParams struct {
+		Status      schema.Status `json:"status" validate:"omitempty,xStatus"`
+		Description string        `json:"description" validate:"omitempty,xRoleDescription"`
+		Permissions []string      `json:"permissions" validate:"omitempty,dive,xRolePermission"`
+		// 为空时表示不修改
+		RequireTOTP *bool `json:"requireTOTP"`
+	}
+	// roleListParams 角色查询参数
+	roleListParams struct {
+		listParams
+
+		Name string `json:"name" validate:"omitempty,xRoleName"`
+	}
+)
+
+const (
+	errRoleCategory = "role"
+)
+
+func init() {
+	g := router.NewGroup(
+		"/roles",
+		loadUserSession,
+	)
+	ctrl := roleCtrl{}
+
+	// 查询角色
+	g.GET(
+		"/v1",
+		requirePermission(schema.PermissionRoleRead),
+		ctrl.list,
+	)
+
+	// 查询可分配的权限
+	g.GET(
+		"/v1/permissions",
+		requirePermission(schema.PermissionRoleRead),
+		ctrl.listPermission,
+	)
+
+	// 添加角色
+	g.POST(
+		"/v1",
+		newTrackerMiddleware(cs.ActionRoleAdd),
+		requirePermission(schema.PermissionRoleWrite),
+		ctrl.add,
+	)
+
+	// 查询单个角色
+	g.GET(
+		"/v1/{id}",
+		requirePermission(schema.PermissionRoleRead),
+		ctrl.findByID,
+	)
+
+	// 更新角色
+	g.PATCH(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionRoleUpdate),
+		requirePermission(schema.PermissionRoleWrite),
+		ctrl.update,
+	)
+
+	// 删除角色
+	g.DELETE(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionRoleDelete),
+		requirePermission(schema.PermissionRoleWrite),
+		ctrl.delete,
+	)
+}
+
+func getRoleClient() *ent.RoleClient {
+	return helper.EntGetClient().Role
+}
+
+// validatePermissions 校验权限是否均为已定义的权限，
+// 而且操作者需拥有该权限，避免通过角色获取高于自身的权限
+func validatePermissions(operatorRoles, permissions []string) error {
+	values := lo.Map(schema.GetPermissionList(), func(item *schema.PermissionInfo, _ int) string {
+		return item.Value
+	})
+	for _, permission := range permissions {
+		if !lo.Contains(values, permission) {
+			return hes.New("权限不存在："+permission, errRoleCategory)
+		}
+		if !service.HasPermission(operatorRoles, permission) {
+			return hes.NewWithStatusCode("无权限分配"+permission+"权限", http.StatusForbidden, errRoleCategory)
+		}
+	}
+	return nil
+}
+
+// validateBeforeSave 保存前校验
+func (params *roleAddParams) validateBeforeSave(ctx context.Context, operatorRoles []string) error {
+	err := validatePermissions(operatorRoles, params.Permissions)
+	if err != nil {
+		return err
+	}
+	exists, err := getRoleClient().Query().
+		Where(role.Name(params.Name)).
+		Exist(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return hes.New("该角色已存在", errRoleCategory)
+	}
+	return nil
+}
+
+// save 保存角色
+func (params *roleAddParams) save(ctx context.Context, operatorRoles []string) (*ent.Role, error) {
+	err := params.validateBeforeSave(ctx, operatorRoles)
+	if err != nil {
+		return nil, err
+	}
+	return getRoleClient().Create().
+		SetName(params.Name).
+		SetDescription(params.Description).
+		SetPermissions(params.Permissions).
+		SetRequireTotp(params.RequireTOTP).
+		Save(ctx)
+}
+
+// where 将查询条件中的参数转换为对应的where条件
+func (params *roleListParams) where(query *ent.RoleQuery) *ent.RoleQuery {
+	if params.Name != "" {
+		query.Where(role.NameContains(params.Name))
+	}
+	return query
+}
+
+// GetOrders 获取排序的函数列表
+func (params *roleListParams) GetOrders() []role.OrderOption {
+	if params.Order == "" {
+		return nil
+	}
+	arr := strings.Split(params.Order, ",")
+	funcs := make([]role.OrderOption, len(arr))
+	for index, item := range arr {
+		if item[0] == '-' {
+			funcs[index] = ent.Desc(strcase.ToSnake(item[1:]))
+		} else {
+			funcs[index] = ent.Asc(strcase.ToSnake(item))
+		}
+	}
+	return funcs
+}
+
+// queryAll 查询角色列表
+func (params *roleListParams) queryAll(ctx context.Context) ([]*ent.Role, error) {
+	query := getRoleClient().Query()
+
+	query = query.Limit(params.GetLimit()).
+		Offset(params.GetOffset()).
+		Order(params.GetOrders()...)
+	query = params.where(query)
+
+	return query.All(ctx)
+}
+
+// count 计算总数
+func (params *roleListParams) count(ctx context.Context) (int, error) {
+	query := getRoleClient().Query()
+
+	query = params.where(query)
+
+	return query.Count(ctx)
+}
+
+// updateOneID 更新角色信息
+func (params *roleUpdateParams) updateOneID(ctx context.Context, id int, operatorRoles []string) (*ent.Role, error) {
+	err := validatePermissions(operatorRoles, params.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	result, err := getRoleClient().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// 超级用户角色仅允许修改描述与是否要求两步验证
+	if service.IsBuiltinSuRole(result.Name) &&
+		(params.Status != 0 || params.Permissions != nil) {
+		return nil, hes.New("超级用户角色不允许修改状态与权限", errRoleCategory)
+	}
+	updateOne := result.Update()
+	if params.Status != 0 {
+		updateOne = updateOne.SetStatus(params.Status)
+	}
+	if params.Description != "" {
+		updateOne = updateOne.SetDescription(params.Description)
+	}
+	if params.Permissions != nil {
+		updateOne = updateOne.SetPermissions(params.Permissions)
+	}
+	if params.RequireTOTP != nil {
+		updateOne = updateOne.SetRequireTotp(*params.RequireTOTP)
+	}
+	return updateOne.Save(ctx)
+}
+
+// add 添加角色
+func (*roleCtrl) add(c *elton.Context) error {
+	params := roleAddParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	result, err := params.save(c.Context(), getEffectiveRoles(getUserSession(c).MustGetInfo()))
+	if err != nil {
+		return err
+	}
+	err = service.RefreshRoles(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Created(result)
+	return nil
+}
+
+// list 查询角色列表
+func (*roleCtrl) list(c *elton.Context) error {
+	params := roleListParams{}
+	err := validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	count := -1
+	if params.ShouldCount() {
+		count, err = params.count(c.Context())
+		if err != nil {
+			return err
+		}
+	}
+	roles, err := params.queryAll(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &roleListResp{
+		Count: count,
+		Roles: roles,
+	}
+	return nil
+}
+
+// listPermission 查询权限列表
+func (*roleCtrl) listPermission(c *elton.Context) error {
+	c.Body = &rolePermissionListResp{
+		Permissions: schema.GetPermissionList(),
+	}
+	return nil
+}
+
+// findByID 通过id查询
+func (*roleCtrl) findByID(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	result, err := getRoleClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// update 更新角色信息
+func (*roleCtrl) update(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	params := roleUpdateParams{}
+	err = validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	result, err := params.updateOneID(c.Context(), id, getEffectiveRoles(getUserSession(c).MustGetInfo()))
+	if err != nil {
+		return err
+	}
+	err = service.RefreshRoles(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// delete 删除角色，仍有用户使用的角色不允许删除
+func (*roleCtrl) delete(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	result, err := getRoleClient().Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if service.IsBuiltinSuRole(result.Name) {
+		return hes.New("超级用户角色不允许删除", errRoleCategory)
+	}
+	exists, err := getUserClient().Query().
+		Where(func(s *sql.Selector) {
+			s.Where(sqljson.ValueContains(user.FieldRoles, result.Name))
+		}).
+		Exist(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return hes.New("该角色仍有用户使用，不允许删除", errRoleCategory)
+	}
+	err = getRoleClient().DeleteOneID(id).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	err = service.RefreshRoles(ctx)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
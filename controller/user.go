@@ -18,6 +18,9 @@ package controller
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -32,18 +35,23 @@ import (
 	"github.com/vicanso/elton"
 	"github.com/vicanso/forest/config"
 	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/email"
 	"github.com/vicanso/forest/ent"
 	gen "github.com/vicanso/forest/ent"
 	"github.com/vicanso/forest/ent/predicate"
 	"github.com/vicanso/forest/ent/user"
 	"github.com/vicanso/forest/ent/userlogin"
+	"github.com/vicanso/forest/fixture"
+	"github.com/vicanso/forest/helper"
 	"github.com/vicanso/forest/location"
 	"github.com/vicanso/forest/log"
 	"github.com/vicanso/forest/middleware"
 	"github.com/vicanso/forest/router"
 	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/service"
 	"github.com/vicanso/forest/session"
 	"github.com/vicanso/forest/util"
+	"github.com/vicanso/forest/validate"
 	"github.com/vicanso/hes"
 )
 
@@ -51,16 +59,15 @@ type userCtrl struct{}
 
 // 响应相关定义
 type (
-	// 用户登录Token响应
-	userLoginTokenResp struct {
-		// 用户登录的Token
-		Token string `json:"token"`
-	}
 	// userInfoResp 用户信息响应
 	userInfoResp struct {
 		// 服务器当前时间，2021-03-06T15:10:12+08:00
 		Date string `json:"date"`
 		session.UserInfo
+		// 用户角色拥有的权限
+		Permissions []string `json:"permissions"`
+		// 以token认证方式登录时返回的token
+		Tokens *service.AuthTokens `json:"tokens,omitempty"`
 	}
 
 	// userListResp 用户列表响应
@@ -71,9 +78,31 @@ type (
 		// 用户记录总数，如果返回-1表示此次查询未返回总数
 		Count int `json:"count"`
 	}
+	// userRoleInfo 用户角色信息
+	userRoleInfo struct {
+		// 角色说明
+		Name string `json:"name"`
+		// 角色名称
+		Value string `json:"value"`
+	}
 	// userRoleListResp 用户角色列表响应
 	userRoleListResp struct {
-		UserRoles []*schema.UserRoleInfo `json:"userRoles"`
+		UserRoles []*userRoleInfo `json:"userRoles"`
+	}
+	// userTOTPVerifyResp 启用两步验证响应
+	userTOTPVerifyResp struct {
+		// 恢复码，仅在启用时返回一次，用于无法使用验证器App时登录
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	// userSessionInfo 用户session信息
+	userSessionInfo struct {
+		session.SessionInfo
+		// 是否当前使用的session
+		Current bool `json:"current"`
+	}
+	// userSessionListResp 用户session列表响应
+	userSessionListResp struct {
+		Sessions []*userSessionInfo `json:"sessions"`
 	}
 	// userLoginListResp 用户登录列表响应
 	userLoginListResp struct {
@@ -119,7 +148,7 @@ type (
 		// required: true
 		// pattern: xUserAccount
 		Account string `json:"account" validate:"required,xUserAccount"`
-		// 用户密码，如果登录则是sha256(token + 用户密码)
+		// 用户密码，客户端sha256之后的值，服务端使用argon2id生成hash后保存
 		// required: true
 		// pattern: xUserPassword
 		Password string `json:"password" validate:"required,xUserPassword"`
@@ -134,9 +163,55 @@ type (
 	}
 	// userUpdateParams 更新用户信息参数
 	userUpdateParams struct {
-		Roles  []string      `json:"roles" validate:"omitempty"`
+		Roles []string `json:"roles" validate:"omitempty,dive,xUserRole"`
+		// 为空数组时清除用户的分组
+		Groups *[]string     `json:"groups" validate:"omitempty,dive,xUserGroup"`
 		Status schema.Status `json:"status" validate:"omitempty,xStatus"`
 	}
+	// userTOTPCodeParams 两步验证码参数
+	userTOTPCodeParams struct {
+		// 验证器App生成的验证码或恢复码
+		// required: true
+		// pattern: xUserTOTPCode
+		Code string `json:"code" validate:"required,xUserTOTPCode"`
+	}
+	// userForgotPasswordParams 找回密码参数
+	userForgotPasswordParams struct {
+		// 账户
+		// required: true
+		// pattern: xUserAccount
+		Account string `json:"account" validate:"required,xUserAccount"`
+	}
+	// userResetPasswordParams 重置密码参数
+	userResetPasswordParams struct {
+		// 邮件链接中的令牌
+		// required: true
+		// pattern: xUserAccountToken
+		Token string `json:"token" validate:"required,xUserAccountToken"`
+		// 新的密码，客户端sha256之后的值
+		// required: true
+		// pattern: xUserPassword
+		Password string `json:"password" validate:"required,xUserPassword"`
+	}
+	// userVerifyEmailParams 邮箱验证参数
+	userVerifyEmailParams struct {
+		// 邮件链接中的令牌
+		// required: true
+		// pattern: xUserAccountToken
+		Token string `json:"token" validate:"required,xUserAccountToken"`
+	}
+	// userSessionRevokeParams 删除session参数
+	userSessionRevokeParams struct {
+		// 为空则删除当前session以外的所有session
+		SessionID string `json:"sessionID" validate:"omitempty,xUserSessionID"`
+	}
+	// userAuthTokenParams refresh token参数
+	userAuthTokenParams struct {
+		// 登录时返回的refresh token
+		// required: true
+		// pattern: xUserAuthToken
+		RefreshToken string `json:"refreshToken" validate:"required,xUserAuthToken"`
+	}
 	// userActionAddParams 用户添加行为记录的参数
 	userActionAddParams struct {
 		Actions []struct {
@@ -159,10 +234,28 @@ type (
 var (
 	// session配置信息
 	sessionConfig = config.MustGetSessionConfig()
+	// 账户相关配置
+	accountConfig = config.MustGetAccountConfig()
+)
+
+var (
+	// 账户锁定出错
+	errAccountLocked = &hes.Error{
+		StatusCode: http.StatusForbidden,
+		Message:    "账户登录失败次数过多已被锁定，请稍候再试或联系管理员",
+		Category:   errUserCategory,
+	}
 )
 
 const (
 	errUserCategory = "user"
+
+	// 密码校验通过后，需要在此时间内完成两步验证
+	totpLoginTTL = 5 * time.Minute
+
+	// 登录时指定认证方式的请求头，设置为token时返回bearer token而非使用cookie session
+	headerAuthMode = "X-Auth-Mode"
+	authModeToken  = "token"
 )
 
 func init() {
@@ -175,14 +268,14 @@ func init() {
 	// 获取用户列表
 	g.GET(
 		"/v1",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserRead),
 		ctrl.list,
 	)
 
 	// 获取用户信息
 	g.GET(
 		"/v1/{id}",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserRead),
 		ctrl.findByID,
 	)
 
@@ -190,15 +283,62 @@ func init() {
 	g.PATCH(
 		"/v1/{id}",
 		newTrackerMiddleware(cs.ActionUserInfoUpdate),
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserWrite),
 		ctrl.updateByID,
 	)
 
-	// 获取登录token
+	// 删除用户
+	g.DELETE(
+		"/v1/{id}",
+		newTrackerMiddleware(cs.ActionUserDelete),
+		requirePermission(schema.PermissionUserWrite),
+		ctrl.deleteByID,
+	)
+
+	// 解除用户锁定
+	g.POST(
+		"/v1/{id}/unlock",
+		newTrackerMiddleware(cs.ActionUserUnlock),
+		requirePermission(schema.PermissionUserWrite),
+		ctrl.unlockByID,
+	)
+
+	// 模拟登录为指定用户，用于排查用户反馈的问题
+	g.POST(
+		"/v1/{id}/impersonate",
+		newTrackerMiddleware(cs.ActionUserImpersonate),
+		shouldBeSu,
+		ctrl.impersonate,
+	)
+
+	// 结束模拟登录，恢复为原用户
+	g.DELETE(
+		"/v1/me/impersonate",
+		newTrackerMiddleware(cs.ActionUserImpersonateStop),
+		shouldBeLogin,
+		ctrl.stopImpersonate,
+	)
+
+	// 获取用户的session列表
+	g.GET(
+		"/v1/{id}/sessions",
+		requirePermission(schema.PermissionUserRead),
+		ctrl.listSessionByID,
+	)
+
+	// 删除用户的所有session，强制用户退出登录
+	g.DELETE(
+		"/v1/{id}/sessions",
+		newTrackerMiddleware(cs.ActionUserSessionRevoke),
+		requirePermission(schema.PermissionUserWrite),
+		ctrl.revokeSessionByID,
+	)
+
+	// 初始化登录session
 	g.GET(
 		"/v1/me/login",
 		shouldBeAnonymous,
-		ctrl.getLoginToken,
+		ctrl.initLoginSession,
 	)
 
 	// 获取用户信息
@@ -247,6 +387,16 @@ func init() {
 		}),
 		ctrl.login,
 	)
+	// 两步验证登录，在密码校验通过后提交验证码
+	g.POST(
+		"/v1/me/login/totp",
+		middleware.WaitFor(time.Second, true),
+		newTrackerMiddleware(cs.ActionLoginTOTP),
+		shouldBeAnonymous,
+		// 限制10分钟内，相同的账号只允许出错5次
+		newErrorLimit(5, 10*time.Minute, getTOTPErrorLimitKey),
+		ctrl.loginTOTP,
+	)
 	// 内部登录
 	g.POST(
 		"/inner/v1/me/login",
@@ -261,9 +411,112 @@ func init() {
 		"/v1/me",
 		newTrackerMiddleware(cs.ActionUserMeUpdate),
 		shouldBeLogin,
+		shouldNotUseAPIKey,
 		ctrl.updateMe,
 	)
 
+	// 生成两步验证的密钥与二维码
+	g.POST(
+		"/v1/me/totp",
+		newTrackerMiddleware(cs.ActionUserTOTPEnroll),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.enrollTOTP,
+	)
+
+	// 校验验证码并启用两步验证
+	g.POST(
+		"/v1/me/totp/verify",
+		newTrackerMiddleware(cs.ActionUserTOTPVerify),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		newErrorLimit(5, 10*time.Minute, getTOTPErrorLimitKey),
+		ctrl.verifyTOTP,
+	)
+
+	// 关闭两步验证
+	g.POST(
+		"/v1/me/totp/disable",
+		newTrackerMiddleware(cs.ActionUserTOTPDisable),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		newErrorLimit(5, 10*time.Minute, getTOTPErrorLimitKey),
+		ctrl.disableTOTP,
+	)
+
+	// 找回密码，发送重置密码的邮件
+	g.POST(
+		"/v1/me/password/forgot",
+		// 无论账户是否存在均最少等待1秒
+		middleware.WaitFor(time.Second),
+		newTrackerMiddleware(cs.ActionPasswordForgot),
+		captchaValidate,
+		// 限制相同IP在10分钟之内只能调用5次
+		newIPLimit(5, 10*time.Minute, cs.ActionPasswordForgot),
+		ctrl.forgotPassword,
+	)
+
+	// 通过邮件中的令牌重置密码
+	g.POST(
+		"/v1/me/password/reset",
+		middleware.WaitFor(time.Second, true),
+		newTrackerMiddleware(cs.ActionPasswordReset),
+		// 限制相同IP在10分钟之内只能调用10次
+		newIPLimit(10, 10*time.Minute, cs.ActionPasswordReset),
+		ctrl.resetPassword,
+	)
+
+	// 通过邮件中的令牌确认邮箱
+	g.POST(
+		"/v1/me/email/verify",
+		newTrackerMiddleware(cs.ActionEmailVerify),
+		// 限制相同IP在10分钟之内只能调用10次
+		newIPLimit(10, 10*time.Minute, cs.ActionEmailVerify),
+		ctrl.verifyEmail,
+	)
+
+	// 使用refresh token获取新的token
+	g.POST(
+		"/v1/me/tokens/refresh",
+		newTrackerMiddleware(cs.ActionAuthTokenRefresh),
+		// 限制相同IP在60秒之内只能调用30次
+		newIPLimit(30, 60*time.Second, cs.ActionAuthTokenRefresh),
+		ctrl.refreshToken,
+	)
+
+	// 撤销refresh token，用于token认证方式的退出登录
+	g.POST(
+		"/v1/me/tokens/revoke",
+		newTrackerMiddleware(cs.ActionAuthTokenRevoke),
+		ctrl.revokeToken,
+	)
+
+	// 获取当前用户的session列表
+	g.GET(
+		"/v1/me/sessions",
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.listMySession,
+	)
+
+	// 删除当前session以外的所有session
+	g.DELETE(
+		"/v1/me/sessions",
+		newTrackerMiddleware(cs.ActionUserMeSessionRevoke),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.revokeMySession,
+	)
+
+	// 删除指定的session
+	g.DELETE(
+		"/v1/me/sessions/{sessionID}",
+		newTrackerMiddleware(cs.ActionUserMeSessionRevoke),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.revokeMySession,
+	)
+
 	// 用户退出登录
 	g.DELETE(
 		"/v1/me",
@@ -275,7 +528,7 @@ func init() {
 	// 获取客户登录记录
 	g.GET(
 		"/v1/login-records",
-		shouldBeAdmin,
+		requirePermission(schema.PermissionUserRead),
 		ctrl.listLoginRecord,
 	)
 
@@ -295,10 +548,10 @@ func init() {
 
 // validateBeforeSave 保存前校验
 func (params *userRegisterLoginParams) validateBeforeSave(ctx context.Context) error {
-	// 判断该账户是否已注册
+	// 判断该账户是否已注册，已删除的账户同样不可再注册
 	exists, err := getUserClient().Query().
 		Where(user.Account(params.Account)).
-		Exist(ctx)
+		Exist(schema.SkipSoftDelete(ctx))
 	if err != nil {
 		return err
 	}
@@ -315,14 +568,47 @@ func (params *userRegisterLoginParams) save(ctx context.Context) (*ent.User, err
 	if err != nil {
 		return nil, err
 	}
+	password, err := util.HashPassword(params.Password)
+	if err != nil {
+		return nil, err
+	}
 	return getUserClient().Create().
 		SetAccount(params.Account).
-		SetPassword(params.Password).
+		SetPassword(password).
+		Save(ctx)
+}
+
+// verifyUserPassword 校验用户密码，数据库中保存的是argon2id生成的hash，
+// 旧数据保存的是客户端sha256之后的值，客户端提交的也是该值，因此直接比较。
+// 服务端不保存可逆的值，因此无法使用每次登录不同的挑战值，登录的防重放依赖于TLS
+func verifyUserPassword(u *ent.User, password string) (bool, error) {
+	if !util.IsPasswordHashed(u.Password) {
+		return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1, nil
+	}
+	return util.VerifyPassword(u.Password, password)
+}
+
+// rehashUserPassword 如果用户密码非当前配置的argon2id hash，则重新生成，
+// 旧数据保存的即为客户端sha256之后的值，因此直接使用该值生成
+func rehashUserPassword(ctx context.Context, u *ent.User, password string) error {
+	if !util.PasswordNeedsRehash(u.Password) {
+		return nil
+	}
+	if !util.IsPasswordHashed(u.Password) {
+		password = u.Password
+	}
+	hash, err := util.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = u.Update().
+		SetPassword(hash).
 		Save(ctx)
+	return err
 }
 
 // login 登录
-func (params *userRegisterLoginParams) login(ctx context.Context, token string) (*ent.User, error) {
+func (params *userRegisterLoginParams) login(ctx context.Context) (*ent.User, error) {
 	u, err := getUserClient().Query().
 		Where(user.Account(params.Account)).
 		First(ctx)
@@ -334,21 +620,114 @@ func (params *userRegisterLoginParams) login(ctx context.Context, token string)
 		}
 		return nil, err
 	}
-	pwd := util.Sha256(u.Password + token)
-	// 用于自动化测试使用
-	if util.IsDevelopment() && params.Password == "fEqNCco3Yq9h5ZUglD3CZJT4lBsfEqNCco31Yq9h5ZUB" {
-		pwd = params.Password
+	if service.IsAccountLocked(u) {
+		return nil, errAccountLocked
 	}
-	if pwd != params.Password {
+	valid, err := verifyUserPassword(u, params.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		locked, err := service.AddLoginFailure(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, errAccountLocked
+		}
 		return nil, errAccountOrPasswordInvalid
 	}
+	// 登录失败次数仅统计连续失败的，清除失败不影响登录
+	_ = service.ResetLoginFailure(ctx, u.Account)
 	// 禁止非正常状态用户登录
 	if u.Status != schema.StatusEnabled {
 		return nil, hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
 	}
+	// 登录成功后将旧的密码数据迁移为argon2id hash，失败不影响登录
+	err = rehashUserPassword(ctx, u, params.Password)
+	if err != nil {
+		log.Error(ctx).
+			Err(err).
+			Str("account", u.Account).
+			Msg("rehash user password fail")
+	}
 	return u, nil
 }
 
+// getTOTPErrorLimitKey 获取两步验证出错限制的key，
+// 两步验证登录时账号未登录，因此使用等待验证的账号
+func getTOTPErrorLimitKey(c *elton.Context) string {
+	userInfo, _ := getUserSession(c).GetInfo()
+	account := userInfo.Account
+	if account == "" {
+		account = userInfo.TOTPAccount
+	}
+	return "totp-" + account
+}
+
+// validateUserTOTP 校验用户的两步验证码，也可使用恢复码（使用后则失效）
+func validateUserTOTP(ctx context.Context, u *ent.User, code string) error {
+	if !u.TotpEnabled {
+		return hes.New("未启用两步验证", errUserCategory)
+	}
+	ok, err := service.ValidateTOTP(ctx, u.Account, u.TotpSecret, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	matched, err := consumeRecoveryCode(ctx, u.ID, code)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return hes.New("两步验证码错误", errUserCategory)
+	}
+	return nil
+}
+
+// consumeRecoveryCode 使用恢复码，成功则将其移除。
+// 在事务中锁定用户记录后重新读取恢复码，避免并发请求重复使用同一恢复码
+func consumeRecoveryCode(ctx context.Context, id int, code string) (bool, error) {
+	matched := false
+	err := helper.EntWithTx(ctx, func(client *ent.Client) error {
+		values, err := client.User.Query().
+			Where(user.ID(id)).
+			Modify(func(s *sql.Selector) {
+				s.Select(s.C(user.FieldRecoveryCodes)).ForUpdate()
+			}).
+			Strings(ctx)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		recoveryCodes := make([]string, 0)
+		if values[0] != "" {
+			err = json.Unmarshal([]byte(values[0]), &recoveryCodes)
+			if err != nil {
+				return err
+			}
+		}
+		index := service.MatchRecoveryCode(recoveryCodes, code)
+		if index == -1 {
+			return nil
+		}
+		matched = true
+		recoveryCodes = append(recoveryCodes[:index], recoveryCodes[index+1:]...)
+		_, err = client.User.UpdateOneID(id).
+			SetRecoveryCodes(recoveryCodes).
+			Save(ctx)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return matched, nil
+}
+
 // update 更新用户信息
 func (params *userUpdateMeParams) updateOneAccount(ctx context.Context, account string) (*ent.User, error) {
 
@@ -359,30 +738,66 @@ func (params *userUpdateMeParams) updateOneAccount(ctx context.Context, account
 		return nil, err
 	}
 	// 更新密码时需要先校验旧密码
+	newPassword := ""
 	if params.NewPassword != "" {
-		if u.Password != params.Password {
+		valid, err := verifyUserPassword(u, params.Password)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
 			return nil, hes.New("旧密码错误，请重新输入", errUserCategory)
 		}
+		newPassword, err = util.HashPassword(params.NewPassword)
+		if err != nil {
+			return nil, err
+		}
 	}
 	updateOne := u.Update()
 	if params.Name != "" {
 		updateOne = updateOne.SetName(params.Name)
 	}
-	if params.Email != "" {
-		updateOne = updateOne.SetEmail(params.Email)
-	}
-	if params.NewPassword != "" {
-		updateOne = updateOne.SetPassword(params.NewPassword)
+	if newPassword != "" {
+		updateOne = updateOne.SetPassword(newPassword)
 	}
 	return updateOne.Save(ctx)
 }
 
+// getAccountLink 获取邮件中的链接地址
+func getAccountLink(path, token string) string {
+	return strings.TrimSuffix(accountConfig.URL, "/") + path + "?token=" + token
+}
+
+// sendVerifyEmail 发送邮箱验证邮件，用户确认后才保存邮箱
+func sendVerifyEmail(ctx context.Context, account, address string) error {
+	ttl := accountConfig.VerifyEmailTTL
+	token, err := service.CreateAccountToken(ctx, service.AccountToken{
+		Category: service.AccountTokenVerifyEmail,
+		Account:  account,
+		Email:    address,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("您正在为账户%s绑定此邮箱，请在%d分钟内打开以下链接完成验证：\n%s\n如非本人操作，请忽略此邮件。",
+		account,
+		int(ttl.Minutes()),
+		getAccountLink("/verify-email", token),
+	)
+	email.Send(ctx, "邮箱验证", message, address)
+	return nil
+}
+
 // updateByID 通过ID更新信息
 func (params *userUpdateParams) updateByID(ctx context.Context, id int) (*ent.User, error) {
-	updateOne := getUserClient().UpdateOneID(id)
+	// 已删除的用户不允许更新
+	updateOne := getUserClient().UpdateOneID(id).
+		Where(user.DeletedAtIsNil())
 	if len(params.Roles) != 0 {
 		updateOne = updateOne.SetRoles(params.Roles)
 	}
+	if params.Groups != nil {
+		updateOne = updateOne.SetGroups(lo.Uniq(*params.Groups))
+	}
 	if params.Status != 0 {
 		updateOne = updateOne.SetStatus(params.Status)
 	}
@@ -400,6 +815,9 @@ func (params *userListParams) where(query *ent.UserQuery) *ent.UserQuery {
 		}))
 
 	}
+	if params.Group != "" {
+		query.Where(hasGroup(params.Group))
+	}
 	if params.Status != "" {
 		v, _ := strconv.Atoi(params.Status)
 		query.Where(user.Status(schema.Status(v)))
@@ -504,6 +922,13 @@ func pickUserInfo(c *elton.Context) (*userInfoResp, error) {
 		Date: now(),
 	}
 	resp.UserInfo = userInfo
+	resp.Permissions = service.GetPermissions(getEffectiveRoles(userInfo))
+	// API key认证时仅返回key允许的权限
+	if len(userInfo.Scopes) != 0 {
+		resp.Permissions = lo.Filter(userInfo.Scopes, func(item string, _ int) bool {
+			return hasPermission(userInfo, item)
+		})
+	}
 	return &resp, nil
 }
 
@@ -564,80 +989,118 @@ func (ctrl *userCtrl) updateByID(c *elton.Context) error {
 	if err != nil {
 		return err
 	}
-	user, err := params.updateByID(c.Context(), id)
+	ctx := c.Context()
+	old, err := getUserClient().Get(ctx, id)
 	if err != nil {
 		return err
 	}
-	c.Body = user
-	return nil
-}
-
-// swagger:route GET /users/v1/me/login users userLoginToken
-// 获取登录的token
-//
-// 在登录之前需要先调用获取token，此token用于登录时与客户密码sha256生成hash，
-// 保证客户每次登录时的密码均不相同，避免接口重放登录。
-// Responses:
-//
-//	200: apiUserLoginTokenResponse
-func (*userCtrl) getLoginToken(c *elton.Context) error {
-	us := getUserSession(c)
-	// 清除当前session id，确保每次登录的用户都是新的session
-	err := us.Destroy(c.Context())
+	operatorRoles := getEffectiveRoles(getUserSession(c).MustGetInfo())
+	err = service.ValidateManageUser(operatorRoles, old.Roles)
 	if err != nil {
 		return err
 	}
-	userInfo := session.UserInfo{
-		Token: util.RandomString(8),
+	if len(params.Roles) != 0 {
+		err = service.ValidateGrantRoles(operatorRoles, params.Roles)
+		if err != nil {
+			return err
+		}
 	}
-	err = us.SetInfo(c.Context(), userInfo)
+	if params.Groups != nil && len(*params.Groups) != 0 {
+		err = validateGroups(ctx, *params.Groups)
+		if err != nil {
+			return err
+		}
+	}
+	user, err := params.updateByID(ctx, id)
 	if err != nil {
 		return err
 	}
-	c.Body = &userLoginTokenResp{
-		Token: userInfo.Token,
+	// 用户被禁用或角色调整时，删除用户所有session，需要重新登录
+	disabled := params.Status != 0 && params.Status != schema.StatusEnabled
+	rolesChanged := len(params.Roles) != 0 &&
+		!(lo.Every(old.Roles, params.Roles) && lo.Every(params.Roles, old.Roles))
+	if disabled || rolesChanged {
+		err = destroyUserSessions(ctx, user.Account)
+		if err != nil {
+			return err
+		}
 	}
+	c.Body = user
 	return nil
 }
 
-// swagger:route GET /users/v1/me users userMe
-// 获取客户信息
-//
-// 若用户登录状态，则返回客户的相关信息。
-// 若用户未登录，仅返回服务器当前时间。
-// Responses:
-//
-//	200: apiUserInfoResponse
-func (*userCtrl) me(c *elton.Context) error {
-	cookie, _ := c.Cookie(sessionConfig.TrackKey)
-	if cookie == nil {
-		uid := util.GenXID()
-		c.AddCookie(&http.Cookie{
-			Name:     sessionConfig.TrackKey,
-			Value:    uid,
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   365 * 24 * 3600,
-		})
+// destroyUserSessions 删除用户的所有session并撤销已签发的token，强制用户重新登录，
+// excludes为保留的session id或token会话id
+func destroyUserSessions(ctx context.Context, account string, excludes ...string) error {
+	err := session.DestroyUserSessions(ctx, account, excludes...)
+	if err != nil {
+		return err
+	}
+	return service.RevokeAuthTokens(ctx, account, excludes...)
+}
 
-		ip := c.RealIP()
-		fields := map[string]any{
-			cs.FieldUserAgent: c.GetRequestHeader("User-Agent"),
-			cs.FieldTID:       uid,
-			cs.FieldIP:        ip,
+// getCurrentSessionID 获取当前登录的session id，token认证时为token的会话id
+func getCurrentSessionID(us *session.UserSession) string {
+	if us.IsTokenAuth() {
+		return us.MustGetInfo().TokenSessionID
+	}
+	return us.ID()
+}
+
+// toUserSessionListResp 转换为session列表响应
+func toUserSessionListResp(sessions []*session.SessionInfo, currentID string) *userSessionListResp {
+	result := make([]*userSessionInfo, len(sessions))
+	for index, item := range sessions {
+		result[index] = &userSessionInfo{
+			SessionInfo: *item,
+			Current:     item.ID == currentID,
 		}
+	}
+	return &userSessionListResp{
+		Sessions: result,
+	}
+}
 
-		go func() {
-			// 新的go routine，因此不直接使用c.Context()
-			location, _ := location.GetByIP(context.Background(), ip)
-			if location != nil {
-				fields[cs.FieldCountry] = location.Country
-				fields[cs.FieldProvince] = location.Province
-				fields[cs.FieldCity] = location.City
-				fields[cs.FieldISP] = location.ISP
-			}
-			getInfluxSrv().Write(cs.MeasurementUserAddTrack, nil, fields)
-		}()
+// impersonate 模拟登录为指定用户，原用户信息保存于session中，
+// 不允许模拟登录超级用户
+func (*userCtrl) impersonate(c *elton.Context) error {
+	us := getUserSession(c)
+	if us.IsTokenAuth() {
+		return hes.New("模拟登录仅支持cookie session", errUserCategory)
+	}
+	info := us.MustGetInfo()
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	if id == info.ID {
+		return hes.New("不能模拟登录自己的账户", errUserCategory)
+	}
+	ctx := c.Context()
+	u, err := getUserClient().Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if service.HasPermission(u.Roles, schema.PermissionAll) {
+		return hes.NewWithStatusCode("不允许模拟登录超级用户", http.StatusForbidden, errUserCategory)
+	}
+	if u.Status != schema.StatusEnabled {
+		return hes.New("该账户已禁用，不允许模拟登录", errUserCategory)
+	}
+	// 模拟登录时未通过两步验证，要求两步验证的角色不生效
+	err = us.SetInfo(ctx, session.UserInfo{
+		Account: u.Account,
+		ID:      u.ID,
+		Roles:   u.Roles,
+		Groups:  u.Groups,
+		Impersonator: &session.ImpersonatorInfo{
+			Account:      info.Account,
+			ID:           info.ID,
+			TOTPVerified: info.TOTPVerified,
+		},
+	})
+	if err != nil {
+		return err
 	}
 	resp, err := pickUserInfo(c)
 	if err != nil {
@@ -647,18 +1110,219 @@ func (*userCtrl) me(c *elton.Context) error {
 	return nil
 }
 
-// detail 详细信息
-func (*userCtrl) detail(c *elton.Context) error {
+// stopImpersonate 结束模拟登录，原用户信息从数据库中重新加载
+func (*userCtrl) stopImpersonate(c *elton.Context) error {
 	us := getUserSession(c)
-	user, err := getUserClient().Get(c.Context(), us.MustGetInfo().ID)
+	info := us.MustGetInfo()
+	if info.Impersonator == nil {
+		return hes.New("当前非模拟登录状态", errUserCategory)
+	}
+	ctx := c.Context()
+	u, err := getUserClient().Get(ctx, info.Impersonator.ID)
 	if err != nil {
 		return err
 	}
-
-	c.Body = user
-	return nil
-}
-
+	// 原用户已不允许登录则直接退出登录
+	if u.Status != schema.StatusEnabled {
+		err = us.Destroy(ctx)
+		if err != nil {
+			return err
+		}
+		return hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
+	}
+	err = us.SetInfo(ctx, session.UserInfo{
+		Account:      u.Account,
+		ID:           u.ID,
+		Roles:        u.Roles,
+		Groups:       u.Groups,
+		TOTPVerified: info.Impersonator.TOTPVerified,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := pickUserInfo(c)
+	if err != nil {
+		return err
+	}
+	c.Body = resp
+	return nil
+}
+
+// listSessionByID 获取用户的session列表
+func (*userCtrl) listSessionByID(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	u, err := getUserClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	sessions, err := session.ListUserSessions(c.Context(), u.Account)
+	if err != nil {
+		return err
+	}
+	c.Body = toUserSessionListResp(sessions, "")
+	return nil
+}
+
+// revokeSessionByID 删除用户的所有session
+func (*userCtrl) revokeSessionByID(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	u, err := getUserClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	err = service.ValidateManageUser(getEffectiveRoles(getUserSession(c).MustGetInfo()), u.Roles)
+	if err != nil {
+		return err
+	}
+	err = destroyUserSessions(c.Context(), u.Account)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// deleteByID 删除用户（软删除），用户的登录状态与API key均失效
+func (*userCtrl) deleteByID(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	if id == getUserSession(c).MustGetInfo().ID {
+		return hes.New("不能删除自己的账户", errUserCategory)
+	}
+	ctx := c.Context()
+	u, err := getUserClient().Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if service.HasPermission(u.Roles, schema.PermissionAll) {
+		return hes.NewWithStatusCode("不允许删除超级用户", http.StatusForbidden, errUserCategory)
+	}
+	err = service.ValidateManageUser(getEffectiveRoles(getUserSession(c).MustGetInfo()), u.Roles)
+	if err != nil {
+		return err
+	}
+	err = service.DeleteUser(ctx, u)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// unlockByID 解除用户锁定
+func (*userCtrl) unlockByID(c *elton.Context) error {
+	id, err := getIDFromParams(c)
+	if err != nil {
+		return err
+	}
+	u, err := getUserClient().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	err = service.ValidateManageUser(getEffectiveRoles(getUserSession(c).MustGetInfo()), u.Roles)
+	if err != nil {
+		return err
+	}
+	result, err := service.UnlockAccount(c.Context(), u)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// swagger:route GET /users/v1/me/login users userLoginSession
+// 初始化登录session
+//
+// 在登录之前需要先调用此接口，调用时会重新生成session，确保每次登录均为新的session。
+// 服务端保存的是密码的argon2id hash，无法基于可逆的值生成登录挑战，因此不再返回登录token，
+// 提交的密码为客户端sha256之后的值，需通过HTTPS避免被截取重放。
+// Responses:
+//
+//	204: apiNoContentResponse
+func (*userCtrl) initLoginSession(c *elton.Context) error {
+	us := getUserSession(c)
+	// 清除当前session id，确保每次登录的用户都是新的session
+	err := us.Destroy(c.Context())
+	if err != nil {
+		return err
+	}
+	// 设置空的用户信息，保存时生成新的session id
+	err = us.SetInfo(c.Context(), session.UserInfo{})
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// swagger:route GET /users/v1/me users userMe
+// 获取客户信息
+//
+// 若用户登录状态，则返回客户的相关信息。
+// 若用户未登录，仅返回服务器当前时间。
+// Responses:
+//
+//	200: apiUserInfoResponse
+func (*userCtrl) me(c *elton.Context) error {
+	cookie, _ := c.Cookie(sessionConfig.TrackKey)
+	if cookie == nil {
+		uid := util.GenXID()
+		c.AddCookie(&http.Cookie{
+			Name:     sessionConfig.TrackKey,
+			Value:    uid,
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   365 * 24 * 3600,
+		})
+
+		ip := c.RealIP()
+		fields := map[string]any{
+			cs.FieldUserAgent: c.GetRequestHeader("User-Agent"),
+			cs.FieldTID:       uid,
+			cs.FieldIP:        ip,
+		}
+
+		go func() {
+			// 新的go routine，因此不直接使用c.Context()
+			location, _ := location.GetByIP(context.Background(), ip)
+			if location != nil {
+				fields[cs.FieldCountry] = location.Country
+				fields[cs.FieldProvince] = location.Province
+				fields[cs.FieldCity] = location.City
+				fields[cs.FieldISP] = location.ISP
+			}
+			getInfluxSrv().Write(cs.MeasurementUserAddTrack, nil, fields)
+		}()
+	}
+	resp, err := pickUserInfo(c)
+	if err != nil {
+		return err
+	}
+	c.Body = resp
+	return nil
+}
+
+// detail 详细信息
+func (*userCtrl) detail(c *elton.Context) error {
+	us := getUserSession(c)
+	user, err := getUserClient().Get(c.Context(), us.MustGetInfo().ID)
+	if err != nil {
+		return err
+	}
+
+	c.Body = user
+	return nil
+}
+
 // swagger:route POST /users/v1/me users userRegister
 // 用户注册
 //
@@ -696,8 +1360,9 @@ func (*userCtrl) register(c *elton.Context) error {
 // swagger:route POST /users/v1/me/login users userLogin
 // 用户登录
 //
-// 用户登录时需要先获取token，之后使用token与密码sha256后提交，
+// 用户登录时需要先初始化登录session（每次登录的session均需重新初始化），之后提交sha256后的密码，
 // 登录成功后返回用户信息。
+// 如果用户启用了两步验证，则返回的用户信息中totpAccount不为空，需再提交验证码完成登录。
 // Responses:
 //
 //	200: apiUserInfoResponse
@@ -708,38 +1373,149 @@ func (*userCtrl) login(c *elton.Context) error {
 		return err
 	}
 	us := getUserSession(c)
-	userInfo, err := us.GetInfo()
+	// 未初始化登录session时无session id，登录后无法添加至账户的session索引
+	if us.ID() == "" {
+		return hes.New("登录session未初始化，请先初始化", errUserCategory)
+	}
+	// 登录
+	u, err := params.login(c.Context())
 	if err != nil {
 		return err
 	}
+	// 启用了两步验证，需要校验验证码后才设置为登录状态
+	if u.TotpEnabled {
+		err = us.SetInfo(c.Context(), session.UserInfo{
+			TOTPAccount:   u.Account,
+			TOTPExpiredAt: time.Now().Add(totpLoginTTL).Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		resp, err := pickUserInfo(c)
+		if err != nil {
+			return err
+		}
+		c.Body = resp
+		return nil
+	}
+	return completeLogin(c, u, false)
+}
 
-	if userInfo.Token == "" {
-		return hes.New("登录令牌不能为空", errUserCategory)
+// swagger:route POST /users/v1/me/login/totp users userLoginTOTP
+// 两步验证登录
+//
+// 启用两步验证的用户在密码校验通过后，需要提交验证器App生成的验证码或恢复码，
+// 校验通过后返回用户信息。
+// Responses:
+//
+//	200: apiUserInfoResponse
+func (*userCtrl) loginTOTP(c *elton.Context) error {
+	params := userTOTPCodeParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
 	}
-	// 登录
-	u, err := params.login(c.Context(), userInfo.Token)
+	userInfo, err := getUserSession(c).GetInfo()
 	if err != nil {
 		return err
 	}
-	account := u.Account
-
-	// 设置session
-	err = us.SetInfo(c.Context(), session.UserInfo{
-		Account: account,
-		ID:      u.ID,
-		Roles:   u.Roles,
-		// Groups: u.,
-	})
+	if userInfo.TOTPAccount == "" || time.Now().Unix() > userInfo.TOTPExpiredAt {
+		return hes.New("两步验证已过期，请重新登录", errUserCategory)
+	}
+	u, err := getUserClient().Query().
+		Where(user.Account(userInfo.TOTPAccount)).
+		First(c.Context())
 	if err != nil {
 		return err
 	}
+	if u.Status != schema.StatusEnabled {
+		return hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
+	}
+	if service.IsAccountLocked(u) {
+		return errAccountLocked
+	}
+	err = validateUserTOTP(c.Context(), u, params.Code)
+	if err != nil {
+		// 两步验证失败也计入登录失败次数
+		locked, e := service.AddLoginFailure(c.Context(), u)
+		if e != nil {
+			return e
+		}
+		if locked {
+			return errAccountLocked
+		}
+		return err
+	}
+	return completeLogin(c, u, true)
+}
 
+// completeLogin 设置用户登录状态，并记录登录信息
+func completeLogin(c *elton.Context, u *ent.User, totpVerified bool) error {
+	us := getUserSession(c)
+	account := u.Account
+	userInfo := session.UserInfo{
+		Account:      account,
+		ID:           u.ID,
+		Roles:        u.Roles,
+		Groups:       u.Groups,
+		TOTPVerified: totpVerified,
+	}
 	ip := c.RealIP()
-	tid := util.GetDeviceID(c.Context())
-	sid := util.GetSessionID(c)
 	userAgent := c.GetRequestHeader("User-Agent")
 
+	var tokens *service.AuthTokens
+	if c.GetRequestHeader(headerAuthMode) == authModeToken {
+		// token认证不使用cookie session，清除登录过程中使用的session
+		err := us.Destroy(c.Context())
+		if err != nil {
+			return err
+		}
+		tokens, err = service.IssueAuthTokens(c.Context(), service.AuthTokenClaims{
+			UserID:       u.ID,
+			Account:      account,
+			Roles:        u.Roles,
+			Groups:       u.Groups,
+			TOTPVerified: totpVerified,
+		})
+		if err != nil {
+			return err
+		}
+		us = session.NewTokenUserSession(c, userInfo)
+	} else {
+		// 设置session
+		err := us.SetInfo(c.Context(), userInfo)
+		if err != nil {
+			return err
+		}
+		// 添加至账户的session索引，失败不影响登录
+		err = session.AddUserSession(c.Context(), account, session.SessionInfo{
+			ID:        us.ID(),
+			IP:        ip,
+			UserAgent: userAgent,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Error(c.Context()).
+				Err(err).
+				Str("account", account).
+				Msg("add user session fail")
+		}
+	}
+	// 测试用户登录需要记录
+	if fixture.IsUser(account) {
+		fixture.RecordBypass(c.Context(), fixture.BypassParams{
+			Category: fixture.BypassLogin,
+			Account:  account,
+			IP:       ip,
+			Path:     c.Request.URL.Path,
+		})
+	}
+	tid := util.GetDeviceID(c.Context())
+	// token认证时session id为空
+	sid := us.ID()
+
 	xForwardedFor := c.GetRequestHeader("X-Forwarded-For")
+	userEmail := u.Email
 	go func() {
 		// 由于elton.context可利用
 		// 此函数中不可再使用elton.context的相关属性(c.Context()也不可以)
@@ -767,8 +1543,27 @@ func (*userCtrl) login(c *elton.Context) error {
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
+		// 与近期的登录记录对比，判断是否可疑登录
+		suspicious, err := service.IsSuspiciousLogin(ctx, account, country, province, isp)
+		if err != nil {
+			log.Error(ctx).
+				Err(err).
+				Msg("detect suspicious login fail")
+		}
+		fields[cs.FieldSuspicious] = suspicious
+		if suspicious && userEmail != "" {
+			message := fmt.Sprintf("您的账户%s于%s在新的地点登录（%s %s %s，IP：%s），如非本人操作，请尽快修改密码。",
+				account,
+				time.Now().Format(time.RFC3339),
+				country,
+				province,
+				isp,
+				ip,
+			)
+			email.Send(ctx, "可疑登录提醒", message, userEmail)
+		}
 		// 记录至数据库
-		_, err := getUserLoginClient().Create().
+		_, err = getUserLoginClient().Create().
 			SetAccount(account).
 			SetUserAgent(userAgent).
 			SetIP(ip).
@@ -779,6 +1574,7 @@ func (*userCtrl) login(c *elton.Context) error {
 			SetProvince(province).
 			SetCity(city).
 			SetIsp(isp).
+			SetSuspicious(suspicious).
 			Save(ctx)
 		if err != nil {
 			log.Error(ctx).
@@ -794,12 +1590,115 @@ func (*userCtrl) login(c *elton.Context) error {
 	if err != nil {
 		return err
 	}
+	resp.Tokens = tokens
 	// 如果刷新ttl失败，则忽略错误
 	_ = us.AutoRefresh(c.Context())
 	c.Body = resp
 	return nil
 }
 
+// enrollTOTP 生成两步验证的密钥与二维码，需校验验证码后才启用
+func (*userCtrl) enrollTOTP(c *elton.Context) error {
+	account := getUserSession(c).MustGetInfo().Account
+	u, err := getUserClient().Query().
+		Where(user.Account(account)).
+		First(c.Context())
+	if err != nil {
+		return err
+	}
+	if u.TotpEnabled {
+		return hes.New("已启用两步验证，如需重新绑定请先关闭", errUserCategory)
+	}
+	info, err := service.NewTOTPEnroll(c.Context(), account)
+	if err != nil {
+		return err
+	}
+	c.NoStore()
+	c.Body = info
+	return nil
+}
+
+// verifyTOTP 校验验证码并启用两步验证，返回恢复码
+func (*userCtrl) verifyTOTP(c *elton.Context) error {
+	params := userTOTPCodeParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	us := getUserSession(c)
+	userInfo := us.MustGetInfo()
+	ctx := c.Context()
+	secret, err := service.GetTOTPEnrollSecret(ctx, userInfo.Account)
+	if err != nil {
+		return err
+	}
+	ok, err := service.ValidateTOTP(ctx, userInfo.Account, secret, params.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return hes.New("两步验证码错误", errUserCategory)
+	}
+	recoveryCodes, hashes := service.GenerateRecoveryCodes()
+	_, err = getUserClient().UpdateOneID(userInfo.ID).
+		SetTotpSecret(secret).
+		SetTotpEnabled(true).
+		SetRecoveryCodes(hashes).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	// 已保存至用户信息，删除失败也不影响
+	_ = service.DelTOTPEnrollSecret(ctx, userInfo.Account)
+
+	// 当前session视为已通过两步验证
+	userInfo.TOTPVerified = true
+	err = us.SetInfo(ctx, userInfo)
+	if err != nil {
+		return err
+	}
+	c.NoStore()
+	c.Body = &userTOTPVerifyResp{
+		RecoveryCodes: recoveryCodes,
+	}
+	return nil
+}
+
+// disableTOTP 校验验证码后关闭两步验证
+func (*userCtrl) disableTOTP(c *elton.Context) error {
+	params := userTOTPCodeParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	us := getUserSession(c)
+	userInfo := us.MustGetInfo()
+	ctx := c.Context()
+	u, err := getUserClient().Get(ctx, userInfo.ID)
+	if err != nil {
+		return err
+	}
+	err = validateUserTOTP(ctx, u, params.Code)
+	if err != nil {
+		return err
+	}
+	_, err = u.Update().
+		ClearTotpSecret().
+		SetTotpEnabled(false).
+		ClearRecoveryCodes().
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	userInfo.TOTPVerified = false
+	err = us.SetInfo(ctx, userInfo)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
 // swagger:route DELETE /users/v1/me users userLogout
 // 用户退出登录
 //
@@ -809,11 +1708,103 @@ func (*userCtrl) login(c *elton.Context) error {
 //	204: apiNoContentResponse
 func (*userCtrl) logout(c *elton.Context) error {
 	us := getUserSession(c)
+	// 模拟登录时session属于原用户
+	account := us.MustGetInfo().SessionAccount()
+	id := us.ID()
 	// 清除session
 	err := us.Destroy(c.Context())
 	if err != nil {
 		return err
 	}
+	// 从账户的session索引中删除
+	err = session.DestroyUserSession(c.Context(), account, id)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// refreshToken 使用refresh token获取新的token，refresh token仅能使用一次，
+// 用户信息从数据库中重新加载，因此角色调整后刷新即生效
+func (*userCtrl) refreshToken(c *elton.Context) error {
+	params := userAuthTokenParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	claims, err := service.ConsumeRefreshToken(ctx, params.RefreshToken)
+	if err != nil {
+		return err
+	}
+	u, err := getUserClient().Get(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if u.Status != schema.StatusEnabled || service.IsAccountLocked(u) {
+		return hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
+	}
+	tokens, err := service.IssueAuthTokens(ctx, service.AuthTokenClaims{
+		UserID:       u.ID,
+		Account:      u.Account,
+		Roles:        u.Roles,
+		Groups:       u.Groups,
+		TOTPVerified: claims.TOTPVerified && u.TotpEnabled,
+		SessionID:    claims.SessionID,
+	})
+	if err != nil {
+		return err
+	}
+	c.Body = tokens
+	return nil
+}
+
+// revokeToken 撤销refresh token
+func (*userCtrl) revokeToken(c *elton.Context) error {
+	params := userAuthTokenParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	err = service.RevokeRefreshToken(c.Context(), params.RefreshToken)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// listMySession 获取当前用户的session列表
+func (*userCtrl) listMySession(c *elton.Context) error {
+	us := getUserSession(c)
+	sessions, err := session.ListUserSessions(c.Context(), us.MustGetInfo().Account)
+	if err != nil {
+		return err
+	}
+	c.Body = toUserSessionListResp(sessions, us.ID())
+	return nil
+}
+
+// revokeMySession 删除当前用户指定的session，
+// 如果未指定则删除当前session以外的所有session，并撤销当前token以外所有已签发的token
+func (*userCtrl) revokeMySession(c *elton.Context) error {
+	params := userSessionRevokeParams{}
+	err := validate.Do(&params, c.Params.ToMap())
+	if err != nil {
+		return err
+	}
+	us := getUserSession(c)
+	account := us.MustGetInfo().Account
+	if params.SessionID == "" {
+		// 退出其它所有设备，包括通过token登录的客户端
+		err = destroyUserSessions(c.Context(), account, getCurrentSessionID(us))
+	} else {
+		err = session.DestroyUserSession(c.Context(), account, params.SessionID)
+	}
+	if err != nil {
+		return err
+	}
 	c.NoContent()
 	return nil
 }
@@ -861,6 +1852,10 @@ func (ctrl *userCtrl) updateMe(c *elton.Context) error {
 		return ctrl.refresh(c)
 	}
 	us := getUserSession(c)
+	// 模拟登录时仅允许刷新session，不允许修改用户信息
+	if us.MustGetInfo().Impersonator != nil {
+		return hes.NewWithStatusCode("模拟登录时不允许修改用户信息", http.StatusForbidden, errUserCategory)
+	}
 	params := userUpdateMeParams{}
 	err := validateBody(c, &params)
 	if err != nil {
@@ -868,7 +1863,130 @@ func (ctrl *userCtrl) updateMe(c *elton.Context) error {
 	}
 
 	// 更新用户信息
-	_, err = params.updateOneAccount(c.Context(), us.MustGetInfo().Account)
+	u, err := params.updateOneAccount(c.Context(), us.MustGetInfo().Account)
+	if err != nil {
+		return err
+	}
+	// 修改密码后其它设备需要重新登录，仅保留当前session
+	if params.NewPassword != "" {
+		err = destroyUserSessions(c.Context(), u.Account, getCurrentSessionID(us))
+		if err != nil {
+			return err
+		}
+	}
+	// 邮箱需要用户通过邮件确认后才保存
+	if params.Email != "" && params.Email != u.Email {
+		err = sendVerifyEmail(c.Context(), u.Account, params.Email)
+		if err != nil {
+			return err
+		}
+	}
+	c.NoContent()
+	return nil
+}
+
+// forgotPassword 找回密码，发送重置密码的邮件，
+// 为避免通过此接口判断账户是否存在，无论是否发送邮件均返回成功
+func (*userCtrl) forgotPassword(c *elton.Context) error {
+	params := userForgotPasswordParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	u, err := getUserClient().Query().
+		Where(user.Account(params.Account)).
+		First(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return err
+	}
+	if u == nil || u.Email == "" || u.Status != schema.StatusEnabled {
+		log.Info(ctx).
+			Str("account", params.Account).
+			Msg("forgot password is ignored")
+		c.NoContent()
+		return nil
+	}
+	ttl := accountConfig.ResetPasswordTTL
+	token, err := service.CreateAccountToken(ctx, service.AccountToken{
+		Category: service.AccountTokenResetPassword,
+		Account:  u.Account,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("您正在找回账户%s的密码，请在%d分钟内打开以下链接重置密码：\n%s\n如非本人操作，请忽略此邮件。",
+		u.Account,
+		int(ttl.Minutes()),
+		getAccountLink("/reset-password", token),
+	)
+	email.Send(ctx, "找回密码", message, u.Email)
+	c.NoContent()
+	return nil
+}
+
+// resetPassword 通过邮件中的令牌重置密码，令牌仅能使用一次
+func (*userCtrl) resetPassword(c *elton.Context) error {
+	params := userResetPasswordParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	info, err := service.ConsumeAccountToken(ctx, service.AccountTokenResetPassword, params.Token)
+	if err != nil {
+		return err
+	}
+	u, err := getUserClient().Query().
+		Where(user.Account(info.Account)).
+		First(ctx)
+	if err != nil {
+		return err
+	}
+	// 令牌签发后账户可能已被禁用
+	if u.Status != schema.StatusEnabled {
+		return hes.NewWithStatusCode("该账户不允许重置密码", http.StatusForbidden, errUserCategory)
+	}
+	password, err := util.HashPassword(params.Password)
+	if err != nil {
+		return err
+	}
+	_, err = u.Update().
+		SetPassword(password).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	// 重置密码后所有已登录的设备均需要重新登录
+	err = destroyUserSessions(ctx, u.Account)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// verifyEmail 通过邮件中的令牌确认邮箱，确认后才保存用户邮箱
+func (*userCtrl) verifyEmail(c *elton.Context) error {
+	params := userVerifyEmailParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	info, err := service.ConsumeAccountToken(ctx, service.AccountTokenVerifyEmail, params.Token)
+	if err != nil {
+		return err
+	}
+	u, err := getUserClient().Query().
+		Where(user.Account(info.Account)).
+		First(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = u.Update().
+		SetEmail(info.Email).
+		Save(ctx)
 	if err != nil {
 		return err
 	}
@@ -879,8 +1997,20 @@ func (ctrl *userCtrl) updateMe(c *elton.Context) error {
 // getRoleList 获取用户角色列表
 func (*userCtrl) getRoleList(c *elton.Context) error {
 	c.CacheMaxAge(time.Minute)
+	roles := service.ListRoles()
+	userRoles := make([]*userRoleInfo, len(roles))
+	for index, item := range roles {
+		name := item.Description
+		if name == "" {
+			name = item.Name
+		}
+		userRoles[index] = &userRoleInfo{
+			Name:  name,
+			Value: item.Name,
+		}
+	}
 	c.Body = &userRoleListResp{
-		UserRoles: schema.GetUserRoleList(),
+		UserRoles: userRoles,
 	}
 	return nil
 }
@@ -0,0 +1,264 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户个人数据导出以及账户注销，注销申请后有等待期，
+// 等待期后账户数据匿名化而非删除
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/userlogin"
+	"github.com/vicanso/forest/influx"
+	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/service"
+	"github.com/vicanso/forest/storage"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+// 参数相关定义
+type (
+	// userDeletionParams 申请注销账户参数
+	userDeletionParams struct {
+		// 用户密码，客户端sha256之后的值
+		// required: true
+		// pattern: xUserPassword
+		Password string `json:"password" validate:"required,xUserPassword"`
+		// 启用了两步验证时需要提交验证码
+		// pattern: xUserTOTPCode
+		Code string `json:"code" validate:"omitempty,xUserTOTPCode"`
+	}
+)
+
+const (
+	// 导出数据时每类记录的最大数量
+	userExportMaxRecords = 5000
+	// 导出用户行为记录的时间范围
+	userExportInfluxDuration = 90 * 24 * time.Hour
+	// 每次查询的数量，查询的数量限制为200
+	userExportPageSize = 200
+)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+	ctrl := userCtrl{}
+
+	// 导出个人数据
+	g.GET(
+		"/v1/me/export",
+		newTrackerMiddleware(cs.ActionUserMeExport),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		// 限制相同IP在60秒之内只能调用3次
+		newIPLimit(3, 60*time.Second, cs.ActionUserMeExport),
+		ctrl.export,
+	)
+
+	// 申请注销账户
+	g.POST(
+		"/v1/me/deletion",
+		newTrackerMiddleware(cs.ActionUserMeDeletionSchedule),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		// 限制10分钟内，相同的账号只允许出错5次
+		newErrorLimit(5, 10*time.Minute, func(c *elton.Context) string {
+			return "deletion-" + getUserSession(c).MustGetInfo().Account
+		}),
+		ctrl.scheduleDeletion,
+	)
+
+	// 撤销注销账户
+	g.DELETE(
+		"/v1/me/deletion",
+		newTrackerMiddleware(cs.ActionUserMeDeletionCancel),
+		shouldNotImpersonate,
+		shouldNotUseAPIKey,
+		ctrl.cancelDeletion,
+	)
+}
+
+// listExportUserLogins 获取导出的登录记录
+func listExportUserLogins(ctx context.Context, account string) ([]*ent.UserLogin, error) {
+	result := make([]*ent.UserLogin, 0)
+	for offset := 0; offset < userExportMaxRecords; offset += userExportPageSize {
+		items, err := getUserLoginClient().Query().
+			Where(userlogin.Account(account)).
+			Order(ent.Desc(userlogin.FieldCreatedAt)).
+			Limit(userExportPageSize).
+			Offset(offset).
+			All(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+		if len(items) < userExportPageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// listExportFiles 获取导出的文件列表（不包括文件数据），文件存储的查询需指定bucket，
+// 因此遍历所有的bucket
+func listExportFiles(ctx context.Context, account string) ([]*storage.File, error) {
+	result := make([]*storage.File, 0)
+	for _, bucket := range cs.FileBuckets {
+		for offset := 0; offset < userExportMaxRecords; offset += userExportPageSize {
+			items, err := storage.Default().Query(ctx, storage.FileFilterParams{
+				Limit:   userExportPageSize,
+				Offset:  offset,
+				Bucket:  bucket,
+				Creator: account,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, items...)
+			if len(items) < userExportPageSize {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// listExportInfluxRecords 获取导出的用户行为记录
+func listExportInfluxRecords(ctx context.Context, measurement, account string) ([]map[string]any, error) {
+	now := time.Now()
+	result, err := getInfluxSrv().Query(ctx, influx.QueryParams{
+		Measurement: measurement,
+		Begin:       now.Add(-userExportInfluxDuration),
+		End:         now,
+		Limit:       userExportMaxRecords,
+		Fields: map[string]any{
+			cs.FieldAccount: account,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = make([]map[string]any, 0)
+	}
+	return result, nil
+}
+
+// export 导出个人数据，包括用户信息、登录记录、上传的文件列表以及行为记录，
+// 以zip的形式返回
+func (*userCtrl) export(c *elton.Context) error {
+	ctx := c.Context()
+	info := getUserSession(c).MustGetInfo()
+	u, err := getUserClient().Get(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+	logins, err := listExportUserLogins(ctx, u.Account)
+	if err != nil {
+		return err
+	}
+	files, err := listExportFiles(ctx, u.Account)
+	if err != nil {
+		return err
+	}
+	actions, err := listExportInfluxRecords(ctx, cs.MeasurementUserAction, u.Account)
+	if err != nil {
+		return err
+	}
+	trackers, err := listExportInfluxRecords(ctx, cs.MeasurementUserTracker, u.Account)
+	if err != nil {
+		return err
+	}
+	buf, err := util.ZipJSON(map[string]any{
+		"profile.json":       u,
+		"user_logins.json":   logins,
+		"files.json":         files,
+		"user_actions.json":  actions,
+		"user_trackers.json": trackers,
+	})
+	if err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("%s-%s.zip", u.Account, time.Now().Format("20060102"))
+	c.NoCache()
+	c.SetHeader(elton.HeaderContentType, "application/zip")
+	c.SetHeader("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.BodyBuffer = bytes.NewBuffer(buf)
+	return nil
+}
+
+// scheduleDeletion 申请注销账户，需校验密码（以及两步验证）
+func (*userCtrl) scheduleDeletion(c *elton.Context) error {
+	info := getUserSession(c).MustGetInfo()
+	params := userDeletionParams{}
+	err := validateBody(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	u, err := getUserClient().Get(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+	if u.DeletionScheduledAt != nil {
+		return hes.New("已申请注销账户", errUserCategory)
+	}
+	valid, err := verifyUserPassword(u, params.Password)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return hes.New("密码错误，请重新输入", errUserCategory)
+	}
+	if u.TotpEnabled {
+		if params.Code == "" {
+			return hes.New("请输入两步验证码", errUserCategory)
+		}
+		err = validateUserTOTP(ctx, u, params.Code)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := service.ScheduleUserDeletion(ctx, u)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
+
+// cancelDeletion 撤销注销账户，仅在等待期内有效
+func (*userCtrl) cancelDeletion(c *elton.Context) error {
+	ctx := c.Context()
+	u, err := getUserClient().Get(ctx, getUserSession(c).MustGetInfo().ID)
+	if err != nil {
+		return err
+	}
+	if u.DeletionScheduledAt == nil {
+		return hes.New("未申请注销账户", errUserCategory)
+	}
+	result, err := service.CancelUserDeletion(ctx, u)
+	if err != nil {
+		return err
+	}
+	c.Body = result
+	return nil
+}
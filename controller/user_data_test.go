@@ -0,0 +1,32 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListExportFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	// 文件存储的查询需要指定bucket，未上传文件时返回空列表
+	files, err := listExportFiles(context.Background(), "export-test")
+	assert.Nil(err)
+	assert.NotNil(files)
+	assert.Empty(files)
+}
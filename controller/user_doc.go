@@ -18,13 +18,6 @@ type apiUserListParams struct {
 	userListParams
 }
 
-// 用户登录Token响应
-// swagger:response apiUserLoginTokenResponse
-type apiUserLoginTokenResponse struct {
-	// in: body
-	Body *userLoginTokenResp
-}
-
 // 用户信息
 // swagger:response apiUserInfoResponse
 type apiUserInfoResponse struct {
@@ -39,6 +32,13 @@ type apiUserRegisterLoginParams struct {
 	Body *userRegisterLoginParams
 }
 
+// 两步验证登录参数
+// swagger:parameters userLoginTOTP
+type apiUserLoginTOTPParams struct {
+	// in: body
+	Body *userTOTPCodeParams
+}
+
 // 用户注册响应
 // swagger:response apiUserRegisterResponse
 type apiUserRegisterResponse struct {
@@ -0,0 +1,306 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 用户OIDC单点登录，通过授权码流程(PKCE)登录，
+// 首次登录时通过已验证的邮箱关联账户，未关联时可配置自动创建
+
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/router"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/service"
+	"github.com/vicanso/forest/session"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+// 参数相关定义
+type (
+	// userOIDCAuthorizeParams 单点登录参数
+	userOIDCAuthorizeParams struct {
+		// 登录成功后跳转的路径
+		// pattern: xPath
+		Redirect string `json:"redirect" validate:"omitempty,xPath"`
+	}
+	// userOIDCCallbackParams 单点登录回调参数
+	userOIDCCallbackParams struct {
+		Code  string `json:"code" validate:"required,xUserOIDCCode"`
+		State string `json:"state" validate:"required,xUserOIDCState"`
+	}
+)
+
+var (
+	// OIDC单点登录配置
+	oidcConfig = config.MustGetOIDCConfig()
+	// OIDC认证服务
+	oidcProvider = service.NewOIDCProvider(oidcConfig)
+)
+
+var (
+	errOIDCDisabled = &hes.Error{
+		StatusCode: http.StatusNotFound,
+		Message:    "未启用单点登录",
+		Category:   errUserCategory,
+	}
+	// 自动创建账户时，账户名仅保留允许的字符
+	oidcAccountInvalidChars = regexp.MustCompile("[^a-zA-Z_0-9]")
+)
+
+const (
+	// 保存认证状态的cookie，用于校验回调与发起登录的是否同一浏览器
+	oidcStateCookie = "oidcState"
+)
+
+func init() {
+	g := router.NewGroup("/users", loadUserSession)
+	ctrl := userCtrl{}
+
+	// 单点登录，跳转至认证服务
+	g.GET(
+		"/v1/me/oidc/authorize",
+		shouldBeAnonymous,
+		ctrl.oidcAuthorize,
+	)
+
+	// 单点登录回调，登录成功后跳转至前端
+	g.GET(
+		"/v1/me/oidc/callback",
+		newTrackerMiddleware(cs.ActionLoginOIDC),
+		shouldBeAnonymous,
+		// 限制相同IP在60秒之内只能调用10次
+		newIPLimit(10, 60*time.Second, cs.ActionLoginOIDC),
+		ctrl.oidcCallback,
+	)
+}
+
+// setFoundRedirect 设置302跳转，
+// 不使用c.Redirect是因为其直接提交响应，session的cookie无法再设置
+func setFoundRedirect(c *elton.Context, url string) {
+	c.SetHeader(elton.HeaderLocation, url)
+	c.Body = nil
+	c.StatusCode = http.StatusFound
+}
+
+// newOIDCAccount 根据认证服务的用户信息生成新的账户名
+func newOIDCAccount(ctx context.Context, claims *service.OIDCClaims) (string, error) {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	name = oidcAccountInvalidChars.ReplaceAllString(name, "")
+	candidates := make([]string, 0, 6)
+	if len(name) >= 2 && len(name) <= 10 {
+		candidates = append(candidates, name)
+	}
+	if name == "" {
+		name = "sso"
+	}
+	// 账户名已存在或不符合时，使用前缀加随机数字
+	prefix := util.CutRune(name, 6)
+	for i := 0; i < 5; i++ {
+		candidates = append(candidates, prefix+util.RandomDigit(4))
+	}
+	for _, account := range candidates {
+		// 已删除的账户同样不可使用
+		exists, err := getUserClient().Query().
+			Where(user.Account(account)).
+			Exist(schema.SkipSoftDelete(ctx))
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return account, nil
+		}
+	}
+	return "", hes.New("无法生成可用的账户", errUserCategory)
+}
+
+// createOIDCUser 自动创建单点登录的用户，密码随机生成，可通过找回密码设置
+func createOIDCUser(ctx context.Context, claims *service.OIDCClaims) (*ent.User, error) {
+	account, err := newOIDCAccount(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	password, err := util.HashPassword(util.SecureRandomString(32))
+	if err != nil {
+		return nil, err
+	}
+	return getUserClient().Create().
+		SetAccount(account).
+		SetPassword(password).
+		SetName(claims.Name).
+		SetEmail(claims.Email).
+		SetOidcSubject(claims.Subject).
+		SetRoles(oidcProvider.MapRoles(nil, claims.Groups)).
+		Save(ctx)
+}
+
+// getOIDCUser 获取单点登录对应的用户，未关联时通过已验证的邮箱关联，
+// 并根据认证服务的分组同步角色
+func getOIDCUser(ctx context.Context, claims *service.OIDCClaims) (*ent.User, error) {
+	u, err := getUserClient().Query().
+		Where(user.OidcSubject(claims.Subject)).
+		Only(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return nil, err
+	}
+	var updateOne *ent.UserUpdateOne
+	if u == nil {
+		if claims.Email == "" || !claims.EmailVerified {
+			return nil, hes.NewWithStatusCode("认证服务未提供已验证的邮箱，无法关联账户", http.StatusForbidden, errUserCategory)
+		}
+		// 用户的邮箱需验证后才保存，因此可用于关联
+		users, err := getUserClient().Query().
+			Where(user.Email(claims.Email)).
+			Limit(2).
+			All(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch len(users) {
+		case 0:
+			if !oidcConfig.AutoProvision {
+				return nil, hes.NewWithStatusCode("该邮箱未关联账户，请联系管理员", http.StatusForbidden, errUserCategory)
+			}
+			return createOIDCUser(ctx, claims)
+		case 1:
+			u = users[0]
+		default:
+			return nil, hes.NewWithStatusCode("该邮箱关联了多个账户，请联系管理员", http.StatusForbidden, errUserCategory)
+		}
+		if u.OidcSubject != "" {
+			return nil, hes.NewWithStatusCode("该账户已关联其它单点登录用户", http.StatusForbidden, errUserCategory)
+		}
+		updateOne = u.Update().SetOidcSubject(claims.Subject)
+	}
+	roles := oidcProvider.MapRoles(u.Roles, claims.Groups)
+	if !lo.Every(roles, u.Roles) || !lo.Every(u.Roles, roles) {
+		if updateOne == nil {
+			updateOne = u.Update()
+		}
+		updateOne = updateOne.SetRoles(roles)
+	}
+	if updateOne == nil {
+		return u, nil
+	}
+	return updateOne.Save(ctx)
+}
+
+// oidcAuthorize 生成认证状态并跳转至认证服务
+func (*userCtrl) oidcAuthorize(c *elton.Context) error {
+	if !oidcProvider.Enabled() {
+		return errOIDCDisabled
+	}
+	params := userOIDCAuthorizeParams{}
+	err := validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	s := service.NewOIDCState(params.Redirect)
+	err = service.SaveOIDCState(ctx, s, oidcConfig.StateTTL)
+	if err != nil {
+		return err
+	}
+	authorizeURL, err := oidcProvider.AuthorizeURL(ctx, s)
+	if err != nil {
+		return err
+	}
+	// 回调时校验cookie中的state，避免登录CSRF
+	c.AddCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    s.State,
+		Path:     sessionConfig.CookiePath,
+		MaxAge:   int(oidcConfig.StateTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	setFoundRedirect(c, authorizeURL)
+	return nil
+}
+
+// oidcCallback 认证服务回调，校验授权码后登录并跳转至前端，
+// 启用两步验证的用户仍需提交验证码完成登录
+func (*userCtrl) oidcCallback(c *elton.Context) error {
+	if !oidcProvider.Enabled() {
+		return errOIDCDisabled
+	}
+	if message := c.QueryParam("error"); message != "" {
+		if description := c.QueryParam("error_description"); description != "" {
+			message = description
+		}
+		return hes.NewWithStatusCode("单点登录失败："+util.CutRune(message, 100), http.StatusUnauthorized, errUserCategory)
+	}
+	params := userOIDCCallbackParams{}
+	err := validateQuery(c, &params)
+	if err != nil {
+		return err
+	}
+	cookie, _ := c.Cookie(oidcStateCookie)
+	if cookie == nil ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(params.State)) != 1 {
+		return hes.NewWithStatusCode("认证状态不匹配，请重新登录", http.StatusUnauthorized, errUserCategory)
+	}
+	c.AddCookie(&http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   sessionConfig.CookiePath,
+		MaxAge: -1,
+	})
+	ctx := c.Context()
+	s, err := service.ConsumeOIDCState(ctx, params.State)
+	if err != nil {
+		return err
+	}
+	claims, err := oidcProvider.Exchange(ctx, params.Code, s)
+	if err != nil {
+		return err
+	}
+	u, err := getOIDCUser(ctx, claims)
+	if err != nil {
+		return err
+	}
+	if u.Status != schema.StatusEnabled {
+		return hes.NewWithStatusCode("该账户不允许登录", http.StatusForbidden, errUserCategory)
+	}
+	if service.IsAccountLocked(u) {
+		return errAccountLocked
+	}
+	if u.TotpEnabled {
+		err = getUserSession(c).SetInfo(ctx, session.UserInfo{
+			TOTPAccount:   u.Account,
+			TOTPExpiredAt: time.Now().Add(totpLoginTTL).Unix(),
+		})
+	} else {
+		err = completeLogin(c, u, false)
+	}
+	if err != nil {
+		return err
+	}
+	setFoundRedirect(c, accountConfig.URL+s.Redirect)
+	return nil
+}
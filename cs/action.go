@@ -21,8 +21,55 @@ const (
 	// ActionLogout logout
 	ActionLogout = "logout"
 
+	// ActionLoginTOTP login with totp code
+	ActionLoginTOTP = "loginTOTP"
+	// ActionLoginOIDC login with oidc
+	ActionLoginOIDC = "loginOIDC"
+
+	// ActionUserTOTPEnroll enroll totp
+	ActionUserTOTPEnroll = "enrollUserTOTP"
+	// ActionUserTOTPVerify verify and enable totp
+	ActionUserTOTPVerify = "verifyUserTOTP"
+	// ActionUserTOTPDisable disable totp
+	ActionUserTOTPDisable = "disableUserTOTP"
+
+	// ActionPasswordForgot forgot password
+	ActionPasswordForgot = "forgotPassword"
+	// ActionPasswordReset reset password
+	ActionPasswordReset = "resetPassword"
+	// ActionEmailVerify verify email
+	ActionEmailVerify = "verifyEmail"
+
+	// ActionAuthTokenRefresh refresh auth token
+	ActionAuthTokenRefresh = "refreshAuthToken"
+	// ActionAuthTokenRevoke revoke auth token
+	ActionAuthTokenRevoke = "revokeAuthToken"
+
+	// ActionAPIKeyAdd add api key
+	ActionAPIKeyAdd = "addAPIKey"
+	// ActionAPIKeyDelete delete api key
+	ActionAPIKeyDelete = "deleteAPIKey"
+
 	// ActionUserInfoUpdate update user info
 	ActionUserInfoUpdate = "updateUserInfo"
+	// ActionUserImpersonate impersonate user
+	ActionUserImpersonate = "impersonateUser"
+	// ActionUserImpersonateStop stop impersonating user
+	ActionUserImpersonateStop = "stopImpersonateUser"
+	// ActionUserDelete delete user
+	ActionUserDelete = "deleteUser"
+	// ActionUserUnlock unlock user
+	ActionUserUnlock = "unlockUser"
+	// ActionUserSessionRevoke revoke user's sessions
+	ActionUserSessionRevoke = "revokeUserSession"
+	// ActionUserMeSessionRevoke revoke my sessions
+	ActionUserMeSessionRevoke = "revokeUserMeSession"
+	// ActionUserMeExport export my data
+	ActionUserMeExport = "exportUserMe"
+	// ActionUserMeDeletionSchedule schedule deletion of my account
+	ActionUserMeDeletionSchedule = "scheduleUserMeDeletion"
+	// ActionUserMeDeletionCancel cancel deletion of my account
+	ActionUserMeDeletionCancel = "cancelUserMeDeletion"
 	// ActionUserMeUpdate update my info
 	ActionUserMeUpdate = "updateUserMe"
 
@@ -30,6 +77,43 @@ const (
 	ActionConfigurationAdd = "addConfiguration"
 	// ActionConfigurationUpdate update configuration
 	ActionConfigurationUpdate = "updateConfiguration"
+	// ActionConfigurationDelete delete configuration
+	ActionConfigurationDelete = "deleteConfiguration"
+	// ActionConfigurationRollback rollback configuration to the revision
+	ActionConfigurationRollback = "rollbackConfiguration"
+
+	// ActionFileDelete delete file
+	ActionFileDelete = "deleteFile"
+	// ActionFilePresignedUpload presigned upload file
+	ActionFilePresignedUpload = "presignedUploadFile"
+	// ActionFilePresignedUploadComplete complete presigned upload
+	ActionFilePresignedUploadComplete = "completePresignedUploadFile"
+	// ActionFileUploadSessionCreate create upload session
+	ActionFileUploadSessionCreate = "createFileUploadSession"
+	// ActionFileUploadSessionComplete complete upload session
+	ActionFileUploadSessionComplete = "completeFileUploadSession"
+	// ActionFileRollback rollback file to the version
+	ActionFileRollback = "rollbackFile"
+	// ActionFileUploadSessionAbort abort upload session
+	ActionFileUploadSessionAbort = "abortFileUploadSession"
+
+	// ActionRoleAdd add role
+	ActionRoleAdd = "addRole"
+	// ActionRoleUpdate update role
+	ActionRoleUpdate = "updateRole"
+	// ActionRoleDelete delete role
+	ActionRoleDelete = "deleteRole"
+
+	// ActionGroupAdd add group
+	ActionGroupAdd = "addGroup"
+	// ActionGroupUpdate update group
+	ActionGroupUpdate = "updateGroup"
+	// ActionGroupDelete delete group
+	ActionGroupDelete = "deleteGroup"
+	// ActionGroupMemberAdd add members to group
+	ActionGroupMemberAdd = "addGroupMember"
+	// ActionGroupMemberRemove remove member from group
+	ActionGroupMemberRemove = "removeGroupMember"
 
 	// ActionAdminCleanCache clean cache
 	ActionAdminCleanCache = "cleanCache"
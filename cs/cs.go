@@ -23,10 +23,10 @@ const (
 	UserSession = "userSession"
 )
 
-const (
-	// MagicalCaptcha magical captcha(for test only)
-	MagicalCaptcha = "0145"
-)
+// FileBuckets 文件存储可使用的bucket
+var FileBuckets = []string{
+	"files",
+}
 
 const (
 	// ResultSuccess result success
@@ -36,4 +36,4 @@ const (
 )
 
 // ***处理
-var MaskRegExp = regexp.MustCompile(`(?i)password`)
+var MaskRegExp = regexp.MustCompile(`(?i)password|secret|recovery_?codes|hash`)
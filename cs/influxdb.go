@@ -39,12 +39,16 @@ const (
 	MeasurementEntUpdate = "entUpdate"
 	// MeasurementEntQuery ent的查询记录
 	MeasurementEntQuery = "entQuery"
+	// MeasurementEntBulkMutation ent的批量更新与删除记录
+	MeasurementEntBulkMutation = "entBulkMutation"
 	// MeasurementInfluxdbStats influxdb统计
 	MeasurementInfluxdbStats = "influxdbStats"
 	// MeasurementHTTPError http响应出错统计
 	MeasurementHTTPError = "httpError"
 	// MeasurementUserTracker 用户行为记录
 	MeasurementUserTracker = "userTracker"
+	// MeasurementFixtureBypass 测试数据使用记录
+	MeasurementFixtureBypass = "fixtureBypass"
 	// MeasurementUserAction 用户行为记录
 	// 用于前端记录客户相关的操作，如点击、确认、取消等
 	MeasurementUserAction = "userAction"
@@ -95,6 +99,8 @@ const (
 	FieldPath = "path"
 	// FieldAccount 账号
 	FieldAccount = "account"
+	// FieldImpersonator 模拟登录的原用户账号
+	FieldImpersonator = "impersonator"
 	// FieldSID session id
 	FieldSID = "sid"
 	// FieldTID track id
@@ -117,6 +123,8 @@ const (
 	FieldCity = "city"
 	// FieldISP ISP
 	FieldISP = "isp"
+	// FieldSuspicious 是否可疑
+	FieldSuspicious = "suspicious"
 	// FieldErrCategory 出错分类
 	FieldErrCategory = "errCategory"
 )
@@ -147,6 +155,8 @@ const (
 	FieldTransferUse = "transferUse"
 	// FieldCount 总数
 	FieldCount = "count"
+	// FieldReason 原因
+	FieldReason = "reason"
 	// FieldSize 大小
 	FieldSize = "size"
 	// FieldBodySize 内容大小
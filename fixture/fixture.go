@@ -0,0 +1,188 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 测试数据，仅用于开发与测试环境，包括启动时创建的测试用户以及图形验证码的万能值，
+// 测试数据从配置的文件中加载（不打包至程序中），生产环境如果配置了测试数据则无法启动
+
+package fixture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+
+	"github.com/samber/lo"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/cs"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/log"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/viperx"
+)
+
+const (
+	// BypassCaptcha 使用图形验证码的万能值
+	BypassCaptcha = "captcha"
+	// BypassLogin 使用测试用户登录
+	BypassLogin = "login"
+)
+
+type (
+	// User 测试用户
+	User struct {
+		Account string `validate:"required,xUserAccount"`
+		// 客户端sha256之后的密码
+		Password string   `validate:"required,xUserPassword"`
+		Roles    []string `validate:"omitempty,dive,xUserRole"`
+		Groups   []string `validate:"omitempty,dive,xUserGroup"`
+	}
+	// Fixtures 测试数据
+	Fixtures struct {
+		Users    []User `validate:"omitempty,dive"`
+		Captchas []string
+	}
+	// BypassParams 使用测试数据的记录参数
+	BypassParams struct {
+		// 类型，captcha或login
+		Category string
+		Account  string
+		IP       string
+		Path     string
+	}
+)
+
+var currentFixtures = mustLoadFixtures()
+
+// mustLoadFixtures 加载测试数据，生产环境配置了测试数据则panic
+func mustLoadFixtures() *Fixtures {
+	fixtureConfig := config.MustGetFixtureConfig()
+	if fixtureConfig.Path == "" {
+		return &Fixtures{}
+	}
+	if util.IsProduction() {
+		panic(errors.New("fixtures are not allowed in production, remove the fixture path config"))
+	}
+	fixtures, err := load(fixtureConfig.Path)
+	// 文件不存在时（如单元测试的目录不同）忽略
+	if os.IsNotExist(err) {
+		log.Warn(context.Background()).
+			Str("category", "fixture").
+			Str("path", fixtureConfig.Path).
+			Msg("fixture file is not exists")
+		return &Fixtures{}
+	}
+	if err != nil {
+		panic(err)
+	}
+	return fixtures
+}
+
+// load 从文件中加载测试数据
+func load(file string) (*Fixtures, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	vx := viperx.New("yml")
+	err = vx.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	fixtures := &Fixtures{}
+	err = vx.Unmarshal(fixtures)
+	if err != nil {
+		return nil, err
+	}
+	err = validate.Struct(fixtures)
+	if err != nil {
+		return nil, err
+	}
+	return fixtures, nil
+}
+
+// IsEmpty 判断是否无测试数据
+func IsEmpty() bool {
+	return len(currentFixtures.Users) == 0 &&
+		len(currentFixtures.Captchas) == 0
+}
+
+// IsCaptcha 判断是否图形验证码的万能值
+func IsCaptcha(value string) bool {
+	return value != "" && lo.Contains(currentFixtures.Captchas, value)
+}
+
+// IsUser 判断是否测试用户
+func IsUser(account string) bool {
+	_, found := lo.Find(currentFixtures.Users, func(item User) bool {
+		return item.Account == account
+	})
+	return found
+}
+
+// SeedUsers 创建不存在的测试用户
+func SeedUsers(ctx context.Context) error {
+	client := helper.EntGetClient().User
+	for _, item := range currentFixtures.Users {
+		// 已删除的用户账号也不可再创建
+		exists, err := client.Query().
+			Where(user.Account(item.Account)).
+			Exist(schema.SkipSoftDelete(ctx))
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		password, err := util.HashPassword(item.Password)
+		if err != nil {
+			return err
+		}
+		_, err = client.Create().
+			SetAccount(item.Account).
+			SetPassword(password).
+			SetRoles(item.Roles).
+			SetGroups(item.Groups).
+			Save(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info(ctx).
+			Str("category", "fixture").
+			Str("account", item.Account).
+			Msg("seed fixture user")
+	}
+	return nil
+}
+
+// RecordBypass 记录测试数据的使用，输出日志并写入influxdb
+func RecordBypass(ctx context.Context, params BypassParams) {
+	log.Warn(ctx).
+		Str("category", "fixture").
+		Str("bypass", params.Category).
+		Str("account", params.Account).
+		Str("ip", params.IP).
+		Str("path", params.Path).
+		Msg("fixture bypass")
+	helper.GetInfluxDB().Write(cs.MeasurementFixtureBypass, map[string]string{
+		cs.TagCategory: params.Category,
+	}, map[string]any{
+		cs.FieldAccount: params.Account,
+		cs.FieldIP:      params.IP,
+		cs.FieldPath:    params.Path,
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures, err := load("../fixtures/dev.yml")
+	assert.Nil(err)
+	assert.Equal(1, len(fixtures.Users))
+	assert.Equal("tester", fixtures.Users[0].Account)
+	assert.Equal([]string{"su"}, fixtures.Users[0].Roles)
+	assert.Equal([]string{"0145"}, fixtures.Captchas)
+
+	_, err = load("../fixtures/not-exists.yml")
+	assert.NotNil(err)
+}
+
+func TestFixtures(t *testing.T) {
+	assert := assert.New(t)
+
+	originalFixtures := currentFixtures
+	defer func() {
+		currentFixtures = originalFixtures
+	}()
+
+	currentFixtures = &Fixtures{}
+	assert.True(IsEmpty())
+	assert.False(IsCaptcha(""))
+	assert.False(IsCaptcha("0145"))
+
+	currentFixtures = &Fixtures{
+		Users: []User{
+			{
+				Account: "tester",
+			},
+		},
+		Captchas: []string{
+			"0145",
+		},
+	}
+	assert.False(IsEmpty())
+	assert.True(IsCaptcha("0145"))
+	assert.False(IsCaptcha("1234"))
+	assert.True(IsUser("tester"))
+	assert.False(IsUser("treexie"))
+}
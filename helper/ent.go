@@ -37,10 +37,11 @@ import (
 	"github.com/vicanso/forest/config"
 	"github.com/vicanso/forest/cs"
 	gen "github.com/vicanso/forest/ent"
-	"github.com/vicanso/forest/ent/hook"
 	"github.com/vicanso/forest/ent/intercept"
 	"github.com/vicanso/forest/ent/migrate"
+	_ "github.com/vicanso/forest/ent/runtime"
 	"github.com/vicanso/forest/log"
+	"github.com/vicanso/forest/schema"
 	"github.com/vicanso/forest/util"
 	"github.com/vicanso/hes"
 	"go.uber.org/atomic"
@@ -81,8 +82,38 @@ type EntListParams struct {
 	IgnoreCount string `json:"ignoreCount"`
 }
 
+// entSoftDeleteMutation 支持软删除的mutation
+type entSoftDeleteMutation interface {
+	gen.Mutation
+	Client() *gen.Client
+	SetOp(gen.Op)
+	SetDeletedAt(time.Time)
+	WhereP(...func(*entsql.Selector))
+}
+
+type entBulkMutationKey struct{}
+type entSoftDeletingKey struct{}
+
 var currentEntProcessingStats = new(entProcessingStats)
 
+// EntWithBulkMutation 返回允许批量更新与删除的context，
+// reason为操作的原因（不可为空），执行时会记录日志与统计
+func EntWithBulkMutation(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, entBulkMutationKey{}, reason)
+}
+
+// getEntBulkMutationReason 获取批量操作的原因，为空表示不允许批量操作
+func getEntBulkMutationReason(ctx context.Context) string {
+	reason, _ := ctx.Value(entBulkMutationKey{}).(string)
+	return reason
+}
+
+// isEntSoftDeleting 是否软删除转换后的更新
+func isEntSoftDeleting(ctx context.Context) bool {
+	softDeleting, _ := ctx.Value(entSoftDeletingKey{}).(bool)
+	return softDeleting
+}
+
 func getMaskURI(uri string) string {
 	reg := regexp.MustCompile(`://\S+?:(\S+?)@`)
 	result := reg.FindAllStringSubmatch(uri, 1)
@@ -155,7 +186,7 @@ func mustNewEntClient() (*entsql.Driver, *gen.Client) {
 	entLogger := log.NewEntLogger()
 	c := gen.NewClient(gen.Driver(driver), gen.Log(entLogger.Log))
 
-	initSchemaHooks(c)
+	initSchemaHooks(driver, c)
 	return driver, c
 }
 
@@ -223,7 +254,11 @@ func (stats *entProcessingStats) dec(schema string) (int32, int32) {
 }
 
 // initSchemaHooks 初始化相关的hooks
-func initSchemaHooks(c *gen.Client) {
+func initSchemaHooks(driver *entsql.Driver, c *gen.Client) {
+	// 软删除的查询条件通过生成的intercept添加
+	schema.NewPredicateQuery = func(q ent.Query) (schema.PredicateQuery, error) {
+		return intercept.NewQuery(q)
+	}
 	schemas := make([]string, len(migrate.Tables))
 	for index, table := range migrate.Tables {
 		name := strcase.ToCamel(table.Name)
@@ -243,9 +278,102 @@ func initSchemaHooks(c *gen.Client) {
 		}
 		return false
 	}
-	// 禁止删除数据以及一次更新多个数据
-	// 如果需要更新多个数据可通过DBA处理
-	c.Use(hook.Reject(gen.OpDelete | gen.OpDeleteOne | gen.OpUpdate))
+	// 文件、去重的文件数据、文件历史版本、角色以及用户分组允许通过ID删除
+	isDeleteOneAllowed := func(schemaType string) bool {
+		return schemaType == gen.TypeFile ||
+			schemaType == gen.TypeFileBlob ||
+			schemaType == gen.TypeFileVersion ||
+			schemaType == gen.TypeRole ||
+			schemaType == gen.TypeGroup ||
+			schemaType == gen.TypeAPIKey
+	}
+	isSoftDelete := func(ctx context.Context, m gen.Mutation) bool {
+		_, ok := m.(entSoftDeleteMutation)
+		return ok && !schema.IsSoftDeleteSkipped(ctx)
+	}
+	// 默认禁止删除数据以及一次更新多个数据，
+	// 支持软删除的允许通过ID删除，批量操作则需要通过EntWithBulkMutation指定原因
+	c.Use(func(next gen.Mutator) gen.Mutator {
+		return gen.MutateFunc(func(ctx context.Context, m gen.Mutation) (gen.Value, error) {
+			op := m.Op()
+			reason := getEntBulkMutationReason(ctx)
+			allowed := true
+			switch {
+			case op.Is(gen.OpDeleteOne):
+				allowed = reason != "" ||
+					isDeleteOneAllowed(m.Type()) ||
+					isSoftDelete(ctx, m)
+			case op.Is(gen.OpDelete | gen.OpUpdate):
+				allowed = reason != "" ||
+					(op.Is(gen.OpUpdate) && isEntSoftDeleting(ctx))
+			}
+			if !allowed {
+				return nil, fmt.Errorf("ent/hook: %s operation is not allowed", op)
+			}
+			// 非批量操作或软删除转换后的更新（转换前已记录）
+			if reason == "" ||
+				isEntSoftDeleting(ctx) ||
+				!op.Is(gen.OpDelete|gen.OpDeleteOne|gen.OpUpdate) {
+				return next.Mutate(ctx, m)
+			}
+			startedAt := time.Now()
+			result := cs.ResultSuccess
+			message := ""
+			mutateResult, err := next.Mutate(ctx, m)
+			if err != nil {
+				result = cs.ResultFail
+				message = err.Error()
+			}
+			// 批量操作返回影响的记录数
+			count, _ := mutateResult.(int)
+			account := util.GetAccount(ctx)
+			d := time.Since(startedAt)
+			log.Info(ctx).
+				Str("category", "entBulkMutation").
+				Str("schema", m.Type()).
+				Str("op", op.String()).
+				Str("reason", reason).
+				Str("account", account).
+				Int("count", count).
+				Int("result", result).
+				Str("use", d.String()).
+				Str("message", message).
+				Msg("")
+			fields := map[string]any{
+				cs.FieldReason:  reason,
+				cs.FieldAccount: account,
+				cs.FieldCount:   count,
+				cs.FieldLatency: int(d.Milliseconds()),
+			}
+			if message != "" {
+				fields[cs.FieldError] = message
+			}
+			tags := map[string]string{
+				cs.TagSchema: m.Type(),
+				cs.TagOP:     op.String(),
+				cs.TagResult: strconv.Itoa(result),
+			}
+			GetInfluxDB().Write(cs.MeasurementEntBulkMutation, tags, fields)
+			return mutateResult, err
+		})
+	})
+	// 审计日志
+	c.Use(newEntAuditHook(driver.Dialect()))
+	// 软删除：删除操作转换为设置删除时间，已删除的记录不再更新
+	c.Use(func(next gen.Mutator) gen.Mutator {
+		return gen.MutateFunc(func(ctx context.Context, m gen.Mutation) (gen.Value, error) {
+			if !m.Op().Is(gen.OpDelete|gen.OpDeleteOne) || !isSoftDelete(ctx, m) {
+				return next.Mutate(ctx, m)
+			}
+			sm := m.(entSoftDeleteMutation)
+			sm.WhereP(entsql.FieldIsNull(schema.FieldDeletedAt))
+			sm.SetOp(gen.OpUpdate)
+			sm.SetDeletedAt(time.Now())
+			// 以更新的形式重新执行，返回更新的记录数，
+			// 因此对已删除的记录再次通过ID删除时返回not found
+			return sm.Client().Mutate(context.WithValue(ctx, entSoftDeletingKey{}, true), sm)
+		})
+	})
 	// 数据库操作统计
 	c.Use(func(next gen.Mutator) gen.Mutator {
 		return gen.MutateFunc(func(ctx context.Context, m gen.Mutation) (gen.Value, error) {
@@ -405,6 +533,20 @@ func EntGetClient() *gen.Client {
 	return defaultEntClient
 }
 
+// EntWithTx 在事务中执行fn，fn返回出错时回滚，否则提交
+func EntWithTx(ctx context.Context, fn func(client *gen.Client) error) error {
+	tx, err := defaultEntClient.Tx(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(tx.Client())
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // EntPing ent driver ping
 func EntPing() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -0,0 +1,360 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helper
+
+import (
+	"context"
+	"strconv"
+
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/samber/lo"
+	"github.com/vicanso/forest/cs"
+	gen "github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/apikey"
+	"github.com/vicanso/forest/ent/auditlog"
+	"github.com/vicanso/forest/ent/configuration"
+	"github.com/vicanso/forest/ent/configurationrevision"
+	"github.com/vicanso/forest/ent/file"
+	"github.com/vicanso/forest/ent/fileblob"
+	"github.com/vicanso/forest/ent/fileversion"
+	"github.com/vicanso/forest/ent/group"
+	"github.com/vicanso/forest/ent/role"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/ent/userlogin"
+	"github.com/vicanso/forest/log"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/util"
+)
+
+// entAuditIDField 数据的ID字段
+const entAuditIDField = "id"
+
+// entAuditMaxIDs 批量操作记录审计的最大数量（与查询的limit限制一致）
+const entAuditMaxIDs = 200
+
+// entIDsMutation 可获取ID的mutation
+type entIDsMutation interface {
+	gen.Mutation
+	ID() (int, bool)
+	IDs(context.Context) ([]int, error)
+}
+
+// entAuditTable schema对应的数据库表
+type entAuditTable struct {
+	// 表名
+	name string
+	// 所有字段，删除时查询删除前的数据
+	columns []string
+	// 二进制数据字段，数据可能较大，仅记录数据长度
+	sizeColumns []string
+}
+
+// newEntAuditTables 获取schema类型对应的数据库表
+func newEntAuditTables() map[string]*entAuditTable {
+	return map[string]*entAuditTable{
+		gen.TypeAPIKey: {
+			name:    apikey.Table,
+			columns: apikey.Columns,
+		},
+		gen.TypeAuditLog: {
+			name:    auditlog.Table,
+			columns: auditlog.Columns,
+		},
+		gen.TypeConfiguration: {
+			name:    configuration.Table,
+			columns: configuration.Columns,
+		},
+		gen.TypeConfigurationRevision: {
+			name:    configurationrevision.Table,
+			columns: configurationrevision.Columns,
+		},
+		gen.TypeFile: {
+			name:    file.Table,
+			columns: file.Columns,
+			sizeColumns: []string{
+				file.FieldData,
+			},
+		},
+		gen.TypeFileBlob: {
+			name:    fileblob.Table,
+			columns: fileblob.Columns,
+		},
+		gen.TypeFileVersion: {
+			name:    fileversion.Table,
+			columns: fileversion.Columns,
+			sizeColumns: []string{
+				fileversion.FieldData,
+			},
+		},
+		gen.TypeGroup: {
+			name:    group.Table,
+			columns: group.Columns,
+		},
+		gen.TypeRole: {
+			name:    role.Table,
+			columns: role.Columns,
+		},
+		gen.TypeUser: {
+			name:    user.Table,
+			columns: user.Columns,
+		},
+		gen.TypeUserLogin: {
+			name:    userlogin.Table,
+			columns: userlogin.Columns,
+		},
+	}
+}
+
+// isSizeColumn 判断是否仅记录数据长度的字段
+func (t *entAuditTable) isSizeColumn(name string) bool {
+	return t != nil && lo.Contains(t.sizeColumns, name)
+}
+
+// getEntAuditSize 获取二进制数据的长度，查询修改前的数据时已转换为长度
+func getEntAuditSize(value any) any {
+	switch v := value.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		// mysql中查询的长度为字符串
+		size, _ := strconv.Atoi(v)
+		return size
+	case int64:
+		return int(v)
+	}
+	return value
+}
+
+// maskEntAuditValue 敏感字段脱敏
+func maskEntAuditValue(name string, value any) any {
+	if value == nil || !cs.MaskRegExp.MatchString(name) {
+		return value
+	}
+	return "***"
+}
+
+// newEntAuditSelector 生成查询修改前数据的selector，columns为空则查询所有字段，
+// 二进制数据字段仅查询数据长度
+func newEntAuditSelector(dialect, table string, columns []string, ids []int, sizeColumns ...string) *entsql.Selector {
+	b := entsql.Dialect(dialect)
+	var selector *entsql.Selector
+	if len(columns) == 0 {
+		selector = b.Select("*")
+	} else {
+		selector = b.Select(entAuditIDField)
+		for _, column := range columns {
+			if !lo.Contains(sizeColumns, column) {
+				selector.AppendSelect(column)
+				continue
+			}
+			name := column
+			selector.AppendSelectExprAs(entsql.ExprFunc(func(b *entsql.Builder) {
+				b.WriteString("OCTET_LENGTH(").Ident(name).WriteByte(')')
+			}), name)
+		}
+	}
+	return selector.
+		From(entsql.Table(table)).
+		Where(entsql.InInts(entAuditIDField, ids...))
+}
+
+// loadEntAuditRows 使用修改的client查询修改前的数据，在事务中时为事务内的数据，返回以ID为key的字段值
+func loadEntAuditRows(ctx context.Context, client *gen.Client, dialect string, table *entAuditTable, columns []string, ids []int) (map[int]map[string]any, error) {
+	if table == nil || len(ids) == 0 {
+		return nil, nil
+	}
+	query, args := newEntAuditSelector(dialect, table.name, columns, ids, table.sizeColumns...).Query()
+	rows, err := client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]map[string]any)
+	for rows.Next() {
+		values := make([]any, len(names))
+		ptrs := make([]any, len(names))
+		for index := range values {
+			ptrs[index] = &values[index]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]any)
+		id := 0
+		for index, name := range names {
+			value := values[index]
+			switch v := value.(type) {
+			case []byte:
+				value = string(v)
+			case int64:
+				if name == entAuditIDField {
+					id = int(v)
+				}
+			case int32:
+				if name == entAuditIDField {
+					id = int(v)
+				}
+			}
+			row[name] = value
+		}
+		result[id] = row
+	}
+	return result, rows.Err()
+}
+
+// newEntAuditDiffs 生成各数据修改前后的字段值，二进制数据字段仅记录数据长度
+func newEntAuditDiffs(m gen.Mutation, table *entAuditTable, ids []int, olds map[int]map[string]any) map[int]map[string]*schema.AuditLogDiff {
+	op := m.Op()
+	convert := func(name string, value any) any {
+		if table.isSizeColumn(name) {
+			return getEntAuditSize(value)
+		}
+		return maskEntAuditValue(name, value)
+	}
+	result := make(map[int]map[string]*schema.AuditLogDiff)
+	for _, id := range ids {
+		diff := make(map[string]*schema.AuditLogDiff)
+		old := olds[id]
+		// 删除则记录删除前的所有字段
+		if op.Is(gen.OpDelete | gen.OpDeleteOne) {
+			for name, value := range old {
+				if name == entAuditIDField {
+					continue
+				}
+				diff[name] = &schema.AuditLogDiff{
+					Old: convert(name, value),
+				}
+			}
+			result[id] = diff
+			continue
+		}
+		for _, name := range m.Fields() {
+			// 创建与更新时间由程序自动生成，不记录
+			if name == "created_at" || name == "updated_at" {
+				continue
+			}
+			value, _ := m.Field(name)
+			diff[name] = &schema.AuditLogDiff{
+				Old: convert(name, old[name]),
+				New: convert(name, value),
+			}
+		}
+		for _, name := range m.ClearedFields() {
+			diff[name] = &schema.AuditLogDiff{
+				Old: convert(name, old[name]),
+			}
+		}
+		result[id] = diff
+	}
+	return result
+}
+
+// entClientMutation 可获取client的mutation，在事务中时为事务的client
+type entClientMutation interface {
+	Client() *gen.Client
+}
+
+// newEntAuditHook 生成记录审计日志的hook，记录每次修改的操作者以及修改前后的字段值。
+// 修改前的数据查询以及审计日志写入均使用修改的client，在事务中时随事务提交或回滚，仅记录执行成功的修改。
+// 审计日志写入失败时返回出错，在事务中时（如postgres出错后事务已中止）需回滚整个事务
+func newEntAuditHook(dialect string) gen.Hook {
+	tables := newEntAuditTables()
+	return func(next gen.Mutator) gen.Mutator {
+		return gen.MutateFunc(func(ctx context.Context, m gen.Mutation) (gen.Value, error) {
+			im, ok := m.(entIDsMutation)
+			cm, clientOK := m.(entClientMutation)
+			// 审计日志自身以及软删除转换后的更新（转换前已记录）不记录
+			if !ok ||
+				!clientOK ||
+				m.Type() == gen.TypeAuditLog ||
+				isEntSoftDeleting(ctx) {
+				return next.Mutate(ctx, m)
+			}
+			op := m.Op()
+			table := tables[m.Type()]
+			var ids []int
+			var olds map[int]map[string]any
+			if !op.Is(gen.OpCreate) {
+				var err error
+				ids, err = im.IDs(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if len(ids) >= entAuditMaxIDs {
+					log.Warn(ctx).
+						Str("category", "entAudit").
+						Str("schema", m.Type()).
+						Str("op", op.String()).
+						Msgf("only the first %d records are audited", entAuditMaxIDs)
+				}
+				var columns []string
+				if op.Is(gen.OpDelete | gen.OpDeleteOne) {
+					if table != nil {
+						columns = lo.Without(table.columns, entAuditIDField)
+					}
+				} else {
+					columns = append(m.Fields(), m.ClearedFields()...)
+				}
+				olds, err = loadEntAuditRows(ctx, cm.Client(), dialect, table, columns, ids)
+				if err != nil {
+					return nil, err
+				}
+			}
+			value, err := next.Mutate(ctx, m)
+			if err != nil {
+				return value, err
+			}
+			if op.Is(gen.OpCreate) {
+				id, ok := im.ID()
+				if ok {
+					ids = []int{id}
+				}
+			}
+			if len(ids) == 0 {
+				return value, nil
+			}
+			diffs := newEntAuditDiffs(m, table, ids, olds)
+			c := cm.Client()
+			builders := make([]*gen.AuditLogCreate, 0, len(ids))
+			for _, id := range ids {
+				builders = append(builders, c.AuditLog.Create().
+					SetAccount(util.GetAccount(ctx)).
+					SetImpersonator(util.GetImpersonator(ctx)).
+					SetTraceID(util.GetTraceID(ctx)).
+					SetEntityType(m.Type()).
+					SetEntityID(id).
+					SetOp(op.String()).
+					SetReason(getEntBulkMutationReason(ctx)).
+					SetDiff(diffs[id]))
+			}
+			err = c.AuditLog.CreateBulk(builders...).Exec(ctx)
+			if err != nil {
+				log.Error(ctx).
+					Str("category", "entAudit").
+					Str("schema", m.Type()).
+					Str("op", op.String()).
+					Err(err).
+					Msg("")
+				return nil, err
+			}
+			return value, nil
+		})
+	}
+}
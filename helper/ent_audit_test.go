@@ -0,0 +1,127 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helper
+
+import (
+	"testing"
+
+	"entgo.io/ent/dialect"
+	"github.com/stretchr/testify/assert"
+	gen "github.com/vicanso/forest/ent"
+)
+
+func TestNewEntAuditTables(t *testing.T) {
+	assert := assert.New(t)
+	tables := newEntAuditTables()
+	assert.Equal("users", tables[gen.TypeUser].name)
+	assert.Equal("api_keys", tables[gen.TypeAPIKey].name)
+	assert.Equal("audit_logs", tables[gen.TypeAuditLog].name)
+	assert.Equal("configuration_revisions", tables[gen.TypeConfigurationRevision].name)
+	assert.True(tables[gen.TypeFile].isSizeColumn("data"))
+	assert.False(tables[gen.TypeUser].isSizeColumn("data"))
+}
+
+func TestMaskEntAuditValue(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("***", maskEntAuditValue("password", "abc"))
+	assert.Equal("***", maskEntAuditValue("totp_secret", "abc"))
+	assert.Nil(maskEntAuditValue("totp_secret", nil))
+	assert.Equal("***", maskEntAuditValue("hash", "abc"))
+	assert.Equal("abc", maskEntAuditValue("name", "abc"))
+}
+
+func TestNewEntAuditSelector(t *testing.T) {
+	assert := assert.New(t)
+	query, args := newEntAuditSelector(dialect.Postgres, "users", nil, []int{1, 2}).Query()
+	assert.Equal(`SELECT * FROM "users" WHERE "id" IN ($1, $2)`, query)
+	assert.Equal([]any{1, 2}, args)
+
+	query, _ = newEntAuditSelector(dialect.Postgres, "users", []string{"name"}, []int{1}).Query()
+	assert.Equal(`SELECT "id", "name" FROM "users" WHERE "id" IN ($1)`, query)
+
+	query, _ = newEntAuditSelector(dialect.Postgres, "files", []string{"filename", "data"}, []int{1}, "data").Query()
+	assert.Equal(`SELECT "id", "filename", (OCTET_LENGTH("data")) AS "data" FROM "files" WHERE "id" IN ($1)`, query)
+}
+
+func TestNewEntAuditDiffs(t *testing.T) {
+	assert := assert.New(t)
+	m := EntGetClient().User.Create().
+		SetAccount("test").
+		SetPassword("123456").
+		SetName("Tree").
+		Mutation()
+	m.SetOp(gen.OpUpdateOne)
+	m.ClearEmail()
+	tables := newEntAuditTables()
+	diffs := newEntAuditDiffs(m, tables[gen.TypeUser], []int{1}, map[int]map[string]any{
+		1: {
+			"name":     "tree",
+			"password": "abcdef",
+			"email":    "tree@test.com",
+		},
+	})
+	diff := diffs[1]
+	assert.Equal("tree", diff["name"].Old)
+	assert.Equal("Tree", diff["name"].New)
+	assert.Equal("***", diff["password"].Old)
+	assert.Equal("***", diff["password"].New)
+	assert.Equal("tree@test.com", diff["email"].Old)
+	assert.Nil(diff["email"].New)
+
+	m.SetOp(gen.OpDeleteOne)
+	diffs = newEntAuditDiffs(m, tables[gen.TypeUser], []int{1}, map[int]map[string]any{
+		1: {
+			"id":   1,
+			"name": "tree",
+		},
+	})
+	assert.Equal(1, len(diffs[1]))
+	assert.Equal("tree", diffs[1]["name"].Old)
+	assert.Nil(diffs[1]["name"].New)
+}
+
+func TestNewEntAuditDiffsFileData(t *testing.T) {
+	assert := assert.New(t)
+	tables := newEntAuditTables()
+	m := EntGetClient().File.Create().
+		SetBucket("bucket").
+		SetFilename("test.txt").
+		SetContentType("text/plain").
+		SetSize(3).
+		SetCreator("tree").
+		SetData([]byte("abc")).
+		Mutation()
+	diffs := newEntAuditDiffs(m, tables[gen.TypeFile], []int{1}, nil)
+	diff := diffs[1]
+	assert.Equal("test.txt", diff["filename"].New)
+	// 文件数据仅记录长度
+	assert.Equal(3, diff["data"].New)
+
+	m.SetOp(gen.OpDeleteOne)
+	diffs = newEntAuditDiffs(m, tables[gen.TypeFile], []int{1}, map[int]map[string]any{
+		1: {
+			"id":       1,
+			"filename": "test.txt",
+			"data":     int64(3),
+		},
+	})
+	assert.Equal(3, diffs[1]["data"].Old)
+
+	keyMutation := EntGetClient().APIKey.Create().
+		SetHash("abc").
+		Mutation()
+	diffs = newEntAuditDiffs(keyMutation, tables[gen.TypeAPIKey], []int{1}, nil)
+	assert.Equal("***", diffs[1]["hash"].New)
+}
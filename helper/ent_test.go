@@ -15,9 +15,14 @@
 package helper
 
 import (
+	"context"
 	"testing"
 
+	"entgo.io/ent"
+	entsql "entgo.io/ent/dialect/sql"
 	"github.com/stretchr/testify/assert"
+	gen "github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/schema"
 )
 
 func TestEnt(t *testing.T) {
@@ -35,3 +40,62 @@ func TestEntGetStats(t *testing.T) {
 	stats := EntGetStats()
 	assert.NotNil(stats)
 }
+
+func TestEntBulkMutation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	assert.Empty(getEntBulkMutationReason(ctx))
+
+	ctx = EntWithBulkMutation(ctx, "test")
+	assert.Equal("test", getEntBulkMutationReason(ctx))
+}
+
+func TestEntSoftDeleteMutation(t *testing.T) {
+	assert := assert.New(t)
+	client := EntGetClient()
+
+	var m gen.Mutation = client.User.Create().Mutation()
+	_, ok := m.(entSoftDeleteMutation)
+	assert.True(ok)
+
+	m = client.Configuration.Create().Mutation()
+	_, ok = m.(entSoftDeleteMutation)
+	assert.True(ok)
+
+	m = client.Role.Create().Mutation()
+	_, ok = m.(entSoftDeleteMutation)
+	assert.False(ok)
+}
+
+// entTestQuery 记录添加的查询条件
+type entTestQuery struct {
+	predicates []func(*entsql.Selector)
+}
+
+func (q *entTestQuery) WhereP(ps ...func(*entsql.Selector)) {
+	q.predicates = append(q.predicates, ps...)
+}
+
+func TestEntSoftDeleteQuery(t *testing.T) {
+	assert := assert.New(t)
+	traverser, ok := schema.SoftDeleteMixin{}.Interceptors()[0].(ent.Traverser)
+	assert.True(ok)
+
+	ctx := context.Background()
+	assert.Nil(traverser.Traverse(ctx, EntGetClient().User.Query()))
+	// 非query则出错
+	assert.NotNil(traverser.Traverse(ctx, "user"))
+
+	q := &entTestQuery{}
+	assert.Nil(traverser.Traverse(ctx, q))
+	assert.Equal(1, len(q.predicates))
+	selector := entsql.Select("*").From(entsql.Table("users"))
+	q.predicates[0](selector)
+	query, _ := selector.Query()
+	assert.Equal("SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL", query)
+
+	// 跳过软删除时不添加查询条件
+	q = &entTestQuery{}
+	assert.Nil(traverser.Traverse(schema.SkipSoftDelete(ctx), q))
+	assert.Empty(q.predicates)
+}
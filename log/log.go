@@ -115,9 +115,15 @@ func fillTraceInfos(ctx context.Context, e *zerolog.Event) *zerolog.Event {
 	if deviceID == "" {
 		return e
 	}
-	return e.Str("deviceID", deviceID).
+	e = e.Str("deviceID", deviceID).
 		Str("traceID", util.GetTraceID(ctx)).
 		Str("account", util.GetAccount(ctx))
+	// 模拟登录时记录原用户
+	impersonator := util.GetImpersonator(ctx)
+	if impersonator != "" {
+		e = e.Str("impersonator", impersonator)
+	}
+	return e
 }
 
 func Info(ctx context.Context) *zerolog.Event {
@@ -61,6 +61,7 @@ import (
 	_ "github.com/vicanso/forest/controller"
 	"github.com/vicanso/forest/cs"
 	"github.com/vicanso/forest/email"
+	"github.com/vicanso/forest/fixture"
 	"github.com/vicanso/forest/helper"
 	"github.com/vicanso/forest/influx"
 	"github.com/vicanso/forest/log"
@@ -182,6 +183,20 @@ func dependServiceCheck() (err error) {
 	if err != nil {
 		return
 	}
+	// 创建内置角色并加载角色权限
+	err = service.InitRoles(context.Background())
+	if err != nil {
+		return
+	}
+	// 创建测试用户（仅开发与测试环境）
+	err = fixture.SeedUsers(context.Background())
+	if err != nil {
+		return
+	}
+	err = service.RefreshRoles(context.Background())
+	if err != nil {
+		return
+	}
 	return
 }
 
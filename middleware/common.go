@@ -57,7 +57,7 @@ func WaitFor(d time.Duration, onlyErrOccurreds ...bool) elton.Handler {
 }
 
 // ValidateCaptcha 图形难码校验
-func ValidateCaptcha(magicalCaptcha string) elton.Handler {
+func ValidateCaptcha(bypass func(c *elton.Context, captcha string) bool) elton.Handler {
 	return func(c *elton.Context) error {
 		value := c.GetRequestHeader(xCaptchaHeader)
 		if value == "" {
@@ -67,8 +67,8 @@ func ValidateCaptcha(magicalCaptcha string) elton.Handler {
 		if len(arr) != 2 {
 			return hes.New(fmt.Sprintf("图形验证码参数长度异常(%d)", len(arr)), errCommonCategory)
 		}
-		// 如果有配置万能验证码，则判断是否相等
-		if magicalCaptcha != "" && arr[1] == magicalCaptcha {
+		// 如果允许跳过校验（如测试数据中的万能值）
+		if bypass != nil && bypass(c, arr[1]) {
 			return c.Next()
 		}
 		valid, err := service.ValidateCaptcha(c.Context(), arr[0], arr[1])
@@ -82,7 +82,9 @@ func TestValidateCaptcha(t *testing.T) {
 	assert := assert.New(t)
 
 	magicalCaptcha := "12345"
-	fn := ValidateCaptcha(magicalCaptcha)
+	fn := ValidateCaptcha(func(_ *elton.Context, captcha string) bool {
+		return captcha == magicalCaptcha
+	})
 
 	req := httptest.NewRequest("GET", "/", nil)
 	c := elton.NewContext(nil, req)
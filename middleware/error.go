@@ -83,6 +83,9 @@ func NewError() elton.Handler {
 		if account != "" {
 			fields[cs.FieldAccount] = account
 		}
+		if impersonator := util.GetImpersonator(c.Context()); impersonator != "" {
+			fields[cs.FieldImpersonator] = impersonator
+		}
 		tags := map[string]string{
 			cs.TagMethod: c.Request.Method,
 			cs.TagRoute:  c.Route,
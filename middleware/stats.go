@@ -69,6 +69,10 @@ func NewStats(processingCount *atomic.Int32) elton.Handler {
 				cs.FieldSize:       info.Size,
 				cs.FieldProcessing: processing,
 			}
+			// 模拟登录的请求记录原用户
+			if impersonator := util.GetImpersonator(c.Context()); impersonator != "" {
+				fields[cs.FieldImpersonator] = impersonator
+			}
 			helper.GetInfluxDB().Write(cs.MeasurementHTTPStats, tags, fields)
 		},
 	})
@@ -45,6 +45,7 @@ func init() {
 	_, _ = c.AddFunc("@every 1m", entPing)
 	_, _ = c.AddFunc("@every 1m", influxdbPing)
 	_, _ = c.AddFunc("@every 1m", configRefresh)
+	_, _ = c.AddFunc("@every 1m", roleRefresh)
 	_, _ = c.AddFunc("@every 1m", redisStats)
 	_, _ = c.AddFunc("@every 1m", entStats)
 	_, _ = c.AddFunc("@every 1m", influxdbStats)
@@ -52,6 +53,8 @@ func init() {
 	_, _ = c.AddFunc("@every 10s", performanceStats)
 	_, _ = c.AddFunc("@every 1m", httpInstanceStats)
 	_, _ = c.AddFunc("@every 1m", routerConcurrencyStats)
+	_, _ = c.AddFunc("@every 1h", abortExpiredUploads)
+	_, _ = c.AddFunc("@every 10m", anonymizeDueUsers)
 	// 如果是开发环境，则不执行定时任务
 	if util.IsDevelopment() {
 		return
@@ -99,6 +102,13 @@ func configRefresh() {
 	})
 }
 
+// roleRefresh 刷新角色权限，其它实例更新的角色在刷新后生效
+func roleRefresh() {
+	doTask("role refresh", func() error {
+		return service.RefreshRoles(context.Background())
+	})
+}
+
 func redisStats() {
 	doStatsTask("redis stats", func() map[string]any {
 		// 统计中除了redis数据库的统计，还有当前实例的统计指标，因此所有实例都会写入统计
@@ -108,6 +118,40 @@ func redisStats() {
 	})
 }
 
+// abortExpiredUploads 清除已过期的分块上传
+func abortExpiredUploads() {
+	doTask("abort expired uploads", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		count, err := service.AbortExpiredUploads(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info(ctx).
+			Str("category", logCategory).
+			Int("count", count).
+			Msg("abort expired uploads")
+		return nil
+	})
+}
+
+// anonymizeDueUsers 匿名化已到注销时间的账户
+func anonymizeDueUsers() {
+	doTask("anonymize due users", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		count, err := service.AnonymizeDueUsers(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info(ctx).
+			Str("category", logCategory).
+			Int("count", count).
+			Msg("anonymize due users")
+		return nil
+	})
+}
+
 func entPing() {
 	doTask("ent ping", helper.EntPing)
 }
@@ -0,0 +1,91 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// APIKey holds the schema definition for the APIKey entity.
+type APIKey struct {
+	ent.Schema
+}
+
+// Mixin 用户API key表的mixin
+func (APIKey) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 用户API key表的字段配置
+func (APIKey) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("所属账户"),
+		field.String("name").
+			NotEmpty().
+			Comment("API key名称，用于区分不同的用途"),
+		field.String("prefix").
+			NotEmpty().
+			Immutable().
+			Comment("API key的前缀，用于展示时区分不同的key"),
+		field.String("hash").
+			Sensitive().
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("API key的sha256值，不保存原始key"),
+		field.Strings("scopes").
+			Optional().
+			Comment("API key允许使用的权限，为空则与账户的权限一致"),
+		field.Bool("totp_verified").
+			StructTag(`json:"totpVerified"`).
+			Default(false).
+			Immutable().
+			Comment("创建时是否已通过两步验证，用于要求两步验证的角色"),
+		field.Time("expired_at").
+			StructTag(`json:"expiredAt,omitempty"`).
+			Optional().
+			Nillable().
+			Comment("过期时间，为空则不过期"),
+		field.Time("last_used_at").
+			StructTag(`json:"lastUsedAt,omitempty"`).
+			Optional().
+			Nillable().
+			Comment("最近使用时间"),
+		field.String("last_used_ip").
+			StructTag(`json:"lastUsedIP,omitempty"`).
+			Optional().
+			Comment("最近使用的IP"),
+	}
+}
+
+// Edges of the APIKey.
+func (APIKey) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 用户API key表索引
+func (APIKey) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("account"),
+		index.Fields("hash").Unique(),
+	}
+}
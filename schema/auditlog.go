@@ -0,0 +1,92 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// AuditLogDiff 字段修改前后的值
+type AuditLogDiff struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// AuditLog holds the schema definition for the AuditLog entity.
+type AuditLog struct {
+	ent.Schema
+}
+
+// Mixin 审计记录的mixin
+func (AuditLog) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 审计记录的相关字段
+func (AuditLog) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			Optional().
+			Immutable().
+			Comment("操作者账户，系统任务则为空"),
+		field.String("impersonator").
+			Optional().
+			Immutable().
+			Comment("模拟登录时的原用户账户"),
+		field.String("trace_id").
+			StructTag(`json:"traceID"`).
+			Optional().
+			Immutable().
+			Comment("操作的trace id"),
+		field.String("entity_type").
+			StructTag(`json:"entityType"`).
+			NotEmpty().
+			Immutable().
+			Comment("操作的数据类型"),
+		field.Int("entity_id").
+			StructTag(`json:"entityID"`).
+			Immutable().
+			Comment("操作的数据ID"),
+		field.String("op").
+			NotEmpty().
+			Immutable().
+			Comment("操作类型"),
+		field.String("reason").
+			Optional().
+			Immutable().
+			Comment("批量操作的原因"),
+		field.JSON("diff", map[string]*AuditLogDiff{}).
+			Optional().
+			Comment("修改前后的字段值，敏感字段已脱敏"),
+	}
+}
+
+// Edges of the AuditLog.
+func (AuditLog) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 审计记录表索引
+func (AuditLog) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("entity_type", "entity_id"),
+		index.Fields("account"),
+		index.Fields("trace_id"),
+	}
+}
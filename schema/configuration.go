@@ -16,6 +16,7 @@ package schema
 
 import (
 	"entgo.io/ent"
+	"entgo.io/ent/dialect/entsql"
 	"entgo.io/ent/schema/field"
 	"entgo.io/ent/schema/index"
 )
@@ -39,6 +40,8 @@ const (
 	ConfigurationHTTPServerInterceptor = "httpServerInterceptor"
 	// ConfigurationHTTPRequestInterceptor http请求拦截配置
 	ConfigurationHTTPRequestInterceptor = "httpRequestInterceptor"
+	// ConfigurationCategoryFilePolicy 文件上传策略配置
+	ConfigurationCategoryFilePolicy = "filePolicy"
 )
 
 // Configuration holds the schema definition for the Configuration entity.
@@ -51,6 +54,7 @@ func (Configuration) Mixin() []ent.Mixin {
 	return []ent.Mixin{
 		TimeMixin{},
 		StatusMixin{},
+		SoftDeleteMixin{},
 	}
 }
 
@@ -59,7 +63,6 @@ func (Configuration) Fields() []ent.Field {
 	return []ent.Field{
 		field.String("name").
 			NotEmpty().
-			Unique().
 			Comment("配置名称"),
 		field.Enum("category").
 			Values(
@@ -72,6 +75,7 @@ func (Configuration) Fields() []ent.Field {
 				ConfigurationCategoryEmail,
 				ConfigurationHTTPServerInterceptor,
 				ConfigurationHTTPRequestInterceptor,
+				ConfigurationCategoryFilePolicy,
 			).
 			Comment("配置分类"),
 		field.String("owner").
@@ -100,8 +104,10 @@ func (Configuration) Edges() []ent.Edge {
 // Indexes 配置表索引
 func (Configuration) Indexes() []ent.Index {
 	return []ent.Index{
-		// 配置名称，唯一索引
-		index.Fields("name").Unique(),
+		// 配置名称，未删除的配置唯一（mysql不支持部分索引，则已删除的名称不可复用）
+		index.Fields("name").
+			Unique().
+			Annotations(entsql.IndexWhere(FieldDeletedAt + " IS NULL")),
 		index.Fields("status"),
 	}
 }
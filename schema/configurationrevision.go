@@ -0,0 +1,117 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+const (
+	// ConfigurationRevisionActionAdd 添加配置
+	ConfigurationRevisionActionAdd = "add"
+	// ConfigurationRevisionActionUpdate 更新配置
+	ConfigurationRevisionActionUpdate = "update"
+	// ConfigurationRevisionActionDelete 删除配置
+	ConfigurationRevisionActionDelete = "delete"
+	// ConfigurationRevisionActionRollback 回滚配置
+	ConfigurationRevisionActionRollback = "rollback"
+)
+
+// ConfigurationRevision 配置的修订版本，每次修改后记录配置的完整数据，仅允许添加
+type ConfigurationRevision struct {
+	ent.Schema
+}
+
+// Mixin 配置修订版本的mixin
+func (ConfigurationRevision) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 配置修订版本的相关字段
+func (ConfigurationRevision) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("configuration_id").
+			StructTag(`json:"configurationID"`).
+			Positive().
+			Immutable().
+			Comment("配置ID"),
+		field.Int("version").
+			Positive().
+			Immutable().
+			Comment("版本号"),
+		field.Enum("action").
+			Values(
+				ConfigurationRevisionActionAdd,
+				ConfigurationRevisionActionUpdate,
+				ConfigurationRevisionActionDelete,
+				ConfigurationRevisionActionRollback,
+			).
+			Immutable().
+			Comment("修改类型"),
+		field.String("operator").
+			Optional().
+			Immutable().
+			Comment("修改者，系统修改则为空"),
+		field.Int("rollback_version").
+			StructTag(`json:"rollbackVersion,omitempty"`).
+			Optional().
+			Immutable().
+			Comment("回滚时对应的版本号"),
+		field.String("name").
+			NotEmpty().
+			Immutable().
+			Comment("配置名称"),
+		field.String("category").
+			NotEmpty().
+			Immutable().
+			Comment("配置分类"),
+		field.Int8("status").
+			GoType(Status(StatusEnabled)).
+			Immutable().
+			Comment("配置状态"),
+		field.Text("data").
+			Immutable().
+			Comment("配置信息"),
+		field.Time("started_at").
+			StructTag(`json:"startedAt"`).
+			Immutable().
+			Comment("配置启用时间"),
+		field.Time("ended_at").
+			StructTag(`json:"endedAt"`).
+			Immutable().
+			Comment("配置停用时间"),
+		field.String("description").
+			Optional().
+			Immutable().
+			Comment("配置说明"),
+	}
+}
+
+// Edges of the ConfigurationRevision.
+func (ConfigurationRevision) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 配置修订版本表索引
+func (ConfigurationRevision) Indexes() []ent.Index {
+	return []ent.Index{
+		// 同时修改时版本号的唯一索引冲突，仅一个成功
+		index.Fields("configuration_id", "version").Unique(),
+	}
+}
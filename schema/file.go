@@ -57,6 +57,13 @@ func (File) Fields() []ent.Field {
 			Comment("创建者"),
 		field.Bytes("data").
 			Comment("文件数据"),
+		field.String("checksum").
+			Optional().
+			Comment("文件数据的sha256"),
+		field.Int("version").
+			Positive().
+			Default(1).
+			Comment("版本号，每次覆盖时加1"),
 	}
 }
 
@@ -0,0 +1,60 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// FileBlob 去重后的文件数据，相同bucket中数据相同的文件只保存一份
+type FileBlob struct {
+	ent.Schema
+}
+
+// Mixin 文件数据表的mixin
+func (FileBlob) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 文件数据表的字段配置
+func (FileBlob) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("bucket").
+			NotEmpty().
+			Immutable().
+			Comment("文件所在bucket"),
+		field.String("checksum").
+			NotEmpty().
+			Immutable().
+			Comment("文件数据的sha256"),
+		field.Int64("size").
+			NonNegative().
+			Comment("文件长度"),
+		field.Int("ref_count").
+			StructTag(`json:"refCount"`).
+			Comment("引用次数"),
+	}
+}
+
+// Indexes 文件数据表索引
+func (FileBlob) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("bucket", "checksum").Unique(),
+	}
+}
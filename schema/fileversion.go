@@ -0,0 +1,91 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"net/http"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// FileVersion 文件被覆盖前的历史版本
+type FileVersion struct {
+	ent.Schema
+}
+
+// Mixin 文件历史版本表的mixin
+func (FileVersion) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 文件历史版本表的字段配置
+func (FileVersion) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("bucket").
+			NotEmpty().
+			Immutable().
+			Comment("文件所在bucket"),
+		field.String("filename").
+			NotEmpty().
+			Immutable().
+			Comment("文件名"),
+		field.Int("version").
+			Positive().
+			Immutable().
+			Comment("版本号"),
+		field.String("contentType").
+			NotEmpty().
+			Immutable().
+			Comment("文件数据类型"),
+		field.Int64("size").
+			NonNegative().
+			Immutable().
+			Comment("文件长度"),
+		field.JSON("metadata", &http.Header{}).
+			Immutable().
+			Comment("metadata"),
+		field.String("creator").
+			NotEmpty().
+			Immutable().
+			Comment("创建者"),
+		field.Bytes("data").
+			Immutable().
+			Comment("文件数据"),
+		field.String("checksum").
+			Optional().
+			Immutable().
+			Comment("文件数据的sha256"),
+		field.Time("version_created_at").
+			StructTag(`json:"versionCreatedAt"`).
+			Immutable().
+			Comment("该版本的创建时间"),
+		field.String("replaced_by").
+			StructTag(`json:"replacedBy"`).
+			NotEmpty().
+			Immutable().
+			Comment("覆盖该版本的用户"),
+	}
+}
+
+// Indexes 文件历史版本表索引
+func (FileVersion) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("bucket", "filename", "version").Unique(),
+	}
+}
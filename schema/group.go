@@ -0,0 +1,67 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"regexp"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// Group holds the schema definition for the Group entity.
+type Group struct {
+	ent.Schema
+}
+
+// Mixin 用户分组表的mixin
+func (Group) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+		StatusMixin{},
+	}
+}
+
+// Fields 用户分组表的字段配置
+func (Group) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").
+			Match(regexp.MustCompile("^[a-zA-Z_0-9]+$")).
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("分组名称，用户的分组保存的是该名称"),
+		field.String("description").
+			Optional().
+			Comment("分组说明"),
+		field.String("owner").
+			NotEmpty().
+			Comment("创建者"),
+	}
+}
+
+// Edges of the Group.
+func (Group) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 用户分组表索引
+func (Group) Indexes() []ent.Index {
+	return []ent.Index{
+		// 分组名称唯一索引
+		index.Fields("name").Unique(),
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"regexp"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// 权限，格式为资源:操作
+const (
+	// PermissionAll 所有权限
+	PermissionAll = "*"
+	// PermissionUserRead 查询用户
+	PermissionUserRead = "user:read"
+	// PermissionUserWrite 更新用户
+	PermissionUserWrite = "user:write"
+	// PermissionRoleRead 查询角色
+	PermissionRoleRead = "role:read"
+	// PermissionRoleWrite 添加、更新与删除角色
+	PermissionRoleWrite = "role:write"
+	// PermissionGroupRead 查询用户分组
+	PermissionGroupRead = "group:read"
+	// PermissionGroupWrite 添加、更新与删除用户分组，以及调整分组成员
+	PermissionGroupWrite = "group:write"
+	// PermissionConfigurationRead 查询配置
+	PermissionConfigurationRead = "configuration:read"
+	// PermissionConfigurationWrite 添加与更新配置
+	PermissionConfigurationWrite = "configuration:write"
+	// PermissionFileRead 查询所有文件
+	PermissionFileRead = "file:read"
+	// PermissionFileWrite 更新与删除所有文件
+	PermissionFileWrite = "file:write"
+	// PermissionFluxRead 查询influxdb中的统计
+	PermissionFluxRead = "flux:read"
+	// PermissionCacheRead 查询缓存
+	PermissionCacheRead = "cache:read"
+	// PermissionCacheWrite 清除缓存
+	PermissionCacheWrite = "cache:write"
+	// PermissionSystemRead 查询系统性能指标
+	PermissionSystemRead = "system:read"
+	// PermissionAuditLogRead 查询审计日志
+	PermissionAuditLogRead = "auditLog:read"
+)
+
+// PermissionInfo 权限信息
+type PermissionInfo struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Role holds the schema definition for the Role entity.
+type Role struct {
+	ent.Schema
+}
+
+// GetPermissionList 获取权限列表
+func GetPermissionList() []*PermissionInfo {
+	return []*PermissionInfo{
+		{
+			Name:  "所有权限",
+			Value: PermissionAll,
+		},
+		{
+			Name:  "查询用户",
+			Value: PermissionUserRead,
+		},
+		{
+			Name:  "更新用户",
+			Value: PermissionUserWrite,
+		},
+		{
+			Name:  "查询角色",
+			Value: PermissionRoleRead,
+		},
+		{
+			Name:  "更新角色",
+			Value: PermissionRoleWrite,
+		},
+		{
+			Name:  "查询分组",
+			Value: PermissionGroupRead,
+		},
+		{
+			Name:  "更新分组",
+			Value: PermissionGroupWrite,
+		},
+		{
+			Name:  "查询配置",
+			Value: PermissionConfigurationRead,
+		},
+		{
+			Name:  "更新配置",
+			Value: PermissionConfigurationWrite,
+		},
+		{
+			Name:  "查询文件",
+			Value: PermissionFileRead,
+		},
+		{
+			Name:  "更新文件",
+			Value: PermissionFileWrite,
+		},
+		{
+			Name:  "查询统计",
+			Value: PermissionFluxRead,
+		},
+		{
+			Name:  "查询缓存",
+			Value: PermissionCacheRead,
+		},
+		{
+			Name:  "清除缓存",
+			Value: PermissionCacheWrite,
+		},
+		{
+			Name:  "查询系统指标",
+			Value: PermissionSystemRead,
+		},
+		{
+			Name:  "查询审计日志",
+			Value: PermissionAuditLogRead,
+		},
+	}
+}
+
+// Mixin 角色表的mixin
+func (Role) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+		StatusMixin{},
+	}
+}
+
+// Fields 角色表的字段配置
+func (Role) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").
+			Match(regexp.MustCompile("^[a-zA-Z_0-9]+$")).
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("角色名称，用户的角色保存的是该名称"),
+		field.String("description").
+			Optional().
+			Comment("角色说明"),
+		field.Strings("permissions").
+			Optional().
+			Comment("角色拥有的权限"),
+		field.Bool("require_totp").
+			StructTag(`json:"requireTOTP"`).
+			Default(false).
+			Comment("是否要求用户启用两步验证，未验证时不拥有该角色的权限"),
+	}
+}
+
+// Edges of the Role.
+func (Role) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 角色表索引
+func (Role) Indexes() []ent.Index {
+	return []ent.Index{
+		// 角色名称唯一索引
+		index.Fields("name").Unique(),
+	}
+}
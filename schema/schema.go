@@ -15,9 +15,12 @@
 package schema
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"entgo.io/ent"
+	"entgo.io/ent/dialect/sql"
 	"entgo.io/ent/schema/field"
 	"entgo.io/ent/schema/index"
 	"entgo.io/ent/schema/mixin"
@@ -95,3 +98,75 @@ func (StatusMixin) Fields() []ent.Field {
 			Comment("状态，默认为启用状态"),
 	}
 }
+
+// FieldDeletedAt 软删除的删除时间字段
+const FieldDeletedAt = "deleted_at"
+
+type softDeleteKey struct{}
+
+// SkipSoftDelete 返回跳过软删除的context，
+// 查询时包括已删除的记录，删除时则直接删除记录
+func SkipSoftDelete(ctx context.Context) context.Context {
+	return context.WithValue(ctx, softDeleteKey{}, true)
+}
+
+// IsSoftDeleteSkipped 判断是否跳过软删除
+func IsSoftDeleteSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(softDeleteKey{}).(bool)
+	return skip
+}
+
+// SoftDeleteMixin 软删除的schema，查询时默认过滤已删除的记录，
+// 删除时转换为设置删除时间由helper中的hook处理（schema不可依赖生成的ent代码）
+type SoftDeleteMixin struct {
+	mixin.Schema
+}
+
+// Fields 软删除的删除时间字段
+func (SoftDeleteMixin) Fields() []ent.Field {
+	return []ent.Field{
+		field.Time(FieldDeletedAt).
+			StructTag(`json:"deletedAt,omitempty" sql:"deleted_at"`).
+			Optional().
+			Nillable().
+			Comment("删除时间，删除记录时由程序自动生成"),
+	}
+}
+
+// Interceptors 查询时过滤已删除的记录
+func (SoftDeleteMixin) Interceptors() []ent.Interceptor {
+	return []ent.Interceptor{
+		ent.TraverseFunc(func(ctx context.Context, q ent.Query) error {
+			if IsSoftDeleteSkipped(ctx) {
+				return nil
+			}
+			return whereNotDeleted(q)
+		}),
+	}
+}
+
+// PredicateQuery 可添加sql查询条件的query
+type PredicateQuery interface {
+	WhereP(...func(*sql.Selector))
+}
+
+// NewPredicateQuery 将生成的query转换为PredicateQuery，生成的query的Where参数类型各不相同，
+// 由于schema不可依赖生成的ent代码，因此由helper使用生成的intercept.NewQuery设置
+var NewPredicateQuery func(q ent.Query) (PredicateQuery, error)
+
+// whereNotDeleted 添加未删除的查询条件
+func whereNotDeleted(q ent.Query) error {
+	pq, ok := q.(PredicateQuery)
+	if !ok {
+		if NewPredicateQuery == nil {
+			return fmt.Errorf("unexpected query type %T", q)
+		}
+		var err error
+		pq, err = NewPredicateQuery(q)
+		if err != nil {
+			return err
+		}
+	}
+	pq.WhereP(sql.FieldIsNull(FieldDeletedAt))
+	return nil
+}
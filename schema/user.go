@@ -32,40 +32,17 @@ const (
 	UserRoleAdmin = "admin"
 )
 
-// UserRoleInfo 用户角色信息
-type UserRoleInfo struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
-}
-
 // User holds the schema definition for the User entity.
 type User struct {
 	ent.Schema
 }
 
-// GetUserRoleList 获取用户角色列表
-func GetUserRoleList() []*UserRoleInfo {
-	return []*UserRoleInfo{
-		{
-			Name:  "普通用户",
-			Value: UserRoleNormal,
-		},
-		{
-			Name:  "管理员用户",
-			Value: UserRoleAdmin,
-		},
-		{
-			Name:  "超级用户",
-			Value: UserRoleSu,
-		},
-	}
-}
-
 // Mixin 用户表的mixin
 func (User) Mixin() []ent.Mixin {
 	return []ent.Mixin{
 		TimeMixin{},
 		StatusMixin{},
+		SoftDeleteMixin{},
 	}
 }
 
@@ -94,6 +71,38 @@ func (User) Fields() []ent.Field {
 		field.String("email").
 			Optional().
 			Comment("用户邮箱"),
+		field.String("totp_secret").
+			Sensitive().
+			Optional().
+			Comment("两步验证(TOTP)的密钥"),
+		field.Bool("totp_enabled").
+			StructTag(`json:"totpEnabled"`).
+			Default(false).
+			Comment("是否已启用两步验证"),
+		field.Strings("recovery_codes").
+			Sensitive().
+			Optional().
+			Comment("两步验证的恢复码，保存sha256之后的值，每个仅可使用一次"),
+		field.Time("locked_until").
+			StructTag(`json:"lockedUntil,omitempty"`).
+			Optional().
+			Nillable().
+			Comment("账户锁定截止时间，登录失败次数过多时锁定"),
+		field.String("oidc_subject").
+			StructTag(`json:"oidcSubject,omitempty"`).
+			Optional().
+			Unique().
+			Comment("单点登录时认证服务中的用户标识，首次登录时通过邮箱关联"),
+		field.Time("deletion_scheduled_at").
+			StructTag(`json:"deletionScheduledAt,omitempty"`).
+			Optional().
+			Nillable().
+			Comment("账户注销的执行时间，在此之前可撤销注销"),
+		field.Time("anonymized_at").
+			StructTag(`json:"anonymizedAt,omitempty"`).
+			Optional().
+			Nillable().
+			Comment("账户注销后匿名化处理的时间"),
 	}
 }
 
@@ -70,6 +70,9 @@ func (UserLogin) Fields() []ent.Field {
 		field.String("isp").
 			Optional().
 			Comment("用户登录IP的网络服务商"),
+		field.Bool("suspicious").
+			Default(false).
+			Comment("是否可疑登录，与近期登录记录的国家、省份或网络服务商不一致"),
 	}
 }
 
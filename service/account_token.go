@@ -0,0 +1,103 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	accountTokenKeyPrefix = "accountToken:"
+
+	errAccountTokenCategory = "accountToken"
+)
+
+const (
+	// AccountTokenResetPassword 找回密码
+	AccountTokenResetPassword = "resetPassword"
+	// AccountTokenVerifyEmail 邮箱验证
+	AccountTokenVerifyEmail = "verifyEmail"
+)
+
+type (
+	// AccountToken 账户一次性令牌对应的信息
+	AccountToken struct {
+		Category string `json:"category"`
+		Account  string `json:"account"`
+		// 邮箱验证时待确认的邮箱
+		Email string `json:"email,omitempty"`
+	}
+)
+
+// 用于令牌签名的key，使用session cookie的签名key
+var accountTokenSignKey = config.MustGetSessionConfig().Keys[0]
+
+// signAccountToken 对令牌id签名
+func signAccountToken(category, id string) string {
+	return util.HmacSha256(accountTokenSignKey, category+":"+id)
+}
+
+// CreateAccountToken 创建一次性令牌，令牌信息保存于redis中，
+// 返回的令牌为id.签名的形式，用于邮件链接中
+func CreateAccountToken(ctx context.Context, info AccountToken, ttl time.Duration) (string, error) {
+	id := util.SecureRandomString(32)
+	buf, err := json.Marshal(&info)
+	if err != nil {
+		return "", err
+	}
+	err = redisSrv.Set(ctx, accountTokenKeyPrefix+info.Category+":"+id, buf, ttl)
+	if err != nil {
+		return "", err
+	}
+	return id + "." + signAccountToken(info.Category, id), nil
+}
+
+// ConsumeAccountToken 校验并使用令牌，令牌仅能使用一次
+func ConsumeAccountToken(ctx context.Context, category, token string) (*AccountToken, error) {
+	errTokenInvalid := hes.New("链接无效或已过期", errAccountTokenCategory)
+	id, sign, found := strings.Cut(token, ".")
+	if !found {
+		return nil, errTokenInvalid
+	}
+	expected := signAccountToken(category, id)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(sign)) != 1 {
+		return nil, errTokenInvalid
+	}
+	buf, err := redisSrv.GetAndDel(ctx, accountTokenKeyPrefix+category+":"+id)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = errTokenInvalid
+		}
+		return nil, err
+	}
+	info := AccountToken{}
+	err = json.Unmarshal(buf, &info)
+	if err != nil {
+		return nil, err
+	}
+	if info.Category != category {
+		return nil, errTokenInvalid
+	}
+	return &info, nil
+}
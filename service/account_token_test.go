@@ -0,0 +1,41 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/hes"
+)
+
+func TestConsumeAccountTokenInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	id := "abc"
+	sign := signAccountToken(AccountTokenResetPassword, id)
+	assert.NotEqual(sign, signAccountToken(AccountTokenVerifyEmail, id))
+
+	// 签名不匹配时直接返回出错，无需查询redis
+	for _, token := range []string{
+		"abc",
+		id + ".123",
+		id + "." + sign,
+	} {
+		_, err := ConsumeAccountToken(context.Background(), AccountTokenVerifyEmail, token)
+		assert.Equal("链接无效或已过期", hes.Wrap(err).Message)
+	}
+}
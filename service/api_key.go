@@ -0,0 +1,53 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"time"
+
+	"github.com/vicanso/forest/util"
+)
+
+const (
+	// API key的前缀，便于识别及密钥扫描
+	apiKeyPrefix = "fk_"
+	// API key随机部分的长度
+	apiKeyRandomLen = 40
+	// 展示时使用的前缀长度
+	apiKeyDisplayLen = 12
+
+	// 最近使用记录的更新间隔，避免每次请求均更新数据库
+	apiKeyUsageInterval = time.Minute
+)
+
+// GenerateAPIKey 生成API key，返回key、用于展示的前缀以及保存的hash
+func GenerateAPIKey() (key, prefix, hash string) {
+	key = apiKeyPrefix + util.SecureRandomString(apiKeyRandomLen)
+	return key, key[:apiKeyDisplayLen], HashAPIKey(key)
+}
+
+// HashAPIKey 生成API key的hash，用于保存及查询
+func HashAPIKey(key string) string {
+	return util.Sha256(key)
+}
+
+// ShouldRecordAPIKeyUsage 判断是否需要更新API key的最近使用记录，
+// IP变化或距离上次更新超过间隔时才更新
+func ShouldRecordAPIKeyUsage(lastUsedAt *time.Time, lastUsedIP, ip string) bool {
+	if lastUsedAt == nil || lastUsedIP != ip {
+		return true
+	}
+	return time.Since(*lastUsedAt) > apiKeyUsageInterval
+}
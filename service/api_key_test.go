@@ -0,0 +1,45 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key, prefix, hash := GenerateAPIKey()
+	assert.True(strings.HasPrefix(key, apiKeyPrefix))
+	assert.Equal(len(apiKeyPrefix)+apiKeyRandomLen, len(key))
+	assert.True(strings.HasPrefix(key, prefix))
+	assert.Equal(HashAPIKey(key), hash)
+	assert.NotEqual(key, hash)
+}
+
+func TestShouldRecordAPIKeyUsage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(ShouldRecordAPIKeyUsage(nil, "", "1.1.1.1"))
+	now := time.Now()
+	assert.False(ShouldRecordAPIKeyUsage(&now, "1.1.1.1", "1.1.1.1"))
+	assert.True(ShouldRecordAPIKeyUsage(&now, "1.1.1.1", "2.2.2.2"))
+	before := now.Add(-2 * time.Minute)
+	assert.True(ShouldRecordAPIKeyUsage(&before, "1.1.1.1", "1.1.1.1"))
+}
@@ -0,0 +1,282 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	refreshTokenKeyPrefix = "refreshToken:"
+	// 撤销时保留的token会话，值为保留时的代数
+	authTokenKeptKeyPrefix = "authTokenKept:"
+
+	errAuthTokenCategory = "authToken"
+)
+
+const (
+	// AuthTokenTypeAccess access token，用于接口认证
+	AuthTokenTypeAccess = "access"
+	// AuthTokenTypeRefresh refresh token，用于获取新的token
+	AuthTokenTypeRefresh = "refresh"
+)
+
+type (
+	// AuthTokenClaims token中的用户信息
+	AuthTokenClaims struct {
+		jwt.RegisteredClaims
+		// token类型
+		Type string `json:"typ"`
+		// 用户ID
+		UserID int `json:"uid"`
+		// 用户账号
+		Account string `json:"account"`
+		// 用户角色列表
+		Roles []string `json:"roles,omitempty"`
+		// 用户分组列表
+		Groups []string `json:"groups,omitempty"`
+		// 是否已通过两步验证
+		TOTPVerified bool `json:"totpVerified,omitempty"`
+		// token会话id，登录时生成，刷新token时保持不变
+		SessionID string `json:"sid,omitempty"`
+		// 签发时账户token的代数，撤销token时代数增加，之前签发的token均失效
+		Generation int64 `json:"gen,omitempty"`
+	}
+	// AuthTokens 登录后返回的token
+	AuthTokens struct {
+		AccessToken  string `json:"accessToken"`
+		RefreshToken string `json:"refreshToken"`
+		TokenType    string `json:"tokenType"`
+		// access token的有效期，单位秒
+		ExpiresIn int `json:"expiresIn"`
+	}
+)
+
+// newErrAuthTokenInvalid 创建token无效的出错
+func newErrAuthTokenInvalid() error {
+	return hes.NewWithStatusCode("登录令牌无效或已过期", http.StatusUnauthorized, errAuthTokenCategory)
+}
+
+// signAuthToken 使用当前的signed keys中的第一个key签名
+func signAuthToken(claims *AuthTokenClaims) (string, error) {
+	keys := sessionSignedKeys.GetKeys()
+	if len(keys) == 0 {
+		return "", hes.New("signed keys is empty", errAuthTokenCategory)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(keys[0]))
+}
+
+// parseAuthToken 解析token，依次使用signed keys校验，
+// 因此更新signed keys时，旧key签名的token在移除旧key之前仍有效
+func parseAuthToken(token, tokenType string) (*AuthTokenClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	for _, key := range sessionSignedKeys.GetKeys() {
+		claims := &AuthTokenClaims{}
+		_, err := parser.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+			return []byte(key), nil
+		})
+		if err != nil {
+			continue
+		}
+		if claims.Type != tokenType || claims.Account == "" {
+			break
+		}
+		return claims, nil
+	}
+	return nil, newErrAuthTokenInvalid()
+}
+
+// 账户token的代数，以计数的形式保存，撤销token时增加
+var authTokenGenerationKeyPrefix = config.MustGetRedisConfig().Prefix + "authTokenGeneration:"
+
+// getAuthTokenGeneration 获取账户当前token的代数
+func getAuthTokenGeneration(ctx context.Context, account string) (int64, error) {
+	generation, err := helper.RedisGetClient().Get(ctx, authTokenGenerationKeyPrefix+account).Int64()
+	if err != nil && !helper.RedisIsNilError(err) {
+		return 0, err
+	}
+	return generation, nil
+}
+
+// IssueAuthTokens 生成access token与refresh token，
+// refresh token的id保存于redis中，每个refresh token仅能使用一次。
+// 未指定token会话id（登录时）则生成新的会话id
+func IssueAuthTokens(ctx context.Context, claims AuthTokenClaims) (*AuthTokens, error) {
+	now := time.Now()
+	if claims.SessionID == "" {
+		claims.SessionID = util.GenXID()
+	}
+	generation, err := getAuthTokenGeneration(ctx, claims.Account)
+	if err != nil {
+		return nil, err
+	}
+	claims.Generation = generation
+	// 代数需要在此次签发的token过期后才可失效
+	if generation != 0 {
+		err = helper.RedisGetClient().Expire(ctx, authTokenGenerationKeyPrefix+claims.Account, sessionConfig.RefreshTokenTTL).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	accessClaims := claims
+	accessClaims.Type = AuthTokenTypeAccess
+	accessClaims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        util.GenXID(),
+		Subject:   claims.Account,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(sessionConfig.AccessTokenTTL)),
+	}
+	accessToken, err := signAuthToken(&accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshClaims := claims
+	refreshClaims.Type = AuthTokenTypeRefresh
+	refreshClaims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        util.GenXID(),
+		Subject:   claims.Account,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(sessionConfig.RefreshTokenTTL)),
+	}
+	refreshToken, err := signAuthToken(&refreshClaims)
+	if err != nil {
+		return nil, err
+	}
+	err = redisSrv.Set(ctx, refreshTokenKeyPrefix+refreshClaims.ID, claims.Account, sessionConfig.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(sessionConfig.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// ParseAccessToken 解析access token，仅校验签名与有效期，不查询redis，
+// 认证请求时应使用ValidateAccessToken，同时校验是否已被撤销
+func ParseAccessToken(token string) (*AuthTokenClaims, error) {
+	return parseAuthToken(token, AuthTokenTypeAccess)
+}
+
+// ValidateAccessToken 解析access token并校验是否已被撤销
+func ValidateAccessToken(ctx context.Context, token string) (*AuthTokenClaims, error) {
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := IsAuthTokenRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, newErrAuthTokenInvalid()
+	}
+	return claims, nil
+}
+
+// ConsumeRefreshToken 校验并使用refresh token，使用后则失效，
+// 账户的token被撤销之前签发的refresh token也无效
+func ConsumeRefreshToken(ctx context.Context, token string) (*AuthTokenClaims, error) {
+	claims, err := parseAuthToken(token, AuthTokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	_, err = redisSrv.GetAndDel(ctx, refreshTokenKeyPrefix+claims.ID)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = newErrAuthTokenInvalid()
+		}
+		return nil, err
+	}
+	revoked, err := IsAuthTokenRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, newErrAuthTokenInvalid()
+	}
+	return claims, nil
+}
+
+// IsAuthTokenRevoked 判断token是否在账户的token被撤销之前签发，
+// 撤销时保留的token会话则仍有效
+func IsAuthTokenRevoked(ctx context.Context, claims *AuthTokenClaims) (bool, error) {
+	generation, err := getAuthTokenGeneration(ctx, claims.Account)
+	if err != nil {
+		return false, err
+	}
+	if claims.Generation >= generation {
+		return false, nil
+	}
+	if claims.SessionID == "" {
+		return true, nil
+	}
+	data, err := redisSrv.GetIgnoreNilErr(ctx, authTokenKeptKeyPrefix+claims.Account+":"+claims.SessionID)
+	if err != nil {
+		return false, err
+	}
+	kept, _ := strconv.ParseInt(string(data), 10, 64)
+	return kept != generation, nil
+}
+
+// RevokeRefreshToken 撤销refresh token
+func RevokeRefreshToken(ctx context.Context, token string) error {
+	claims, err := parseAuthToken(token, AuthTokenTypeRefresh)
+	if err != nil {
+		return err
+	}
+	_, err = redisSrv.Del(ctx, refreshTokenKeyPrefix+claims.ID)
+	return err
+}
+
+// RevokeAuthTokens 撤销账户当前已签发的所有access token与refresh token，
+// excludes为保留的token会话id（如当前请求使用的token）
+func RevokeAuthTokens(ctx context.Context, account string, excludes ...string) error {
+	key := authTokenGenerationKeyPrefix + account
+	pipe := helper.RedisGetClient().TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	// 代数在最后签发的token过期后失效，之后重新从0开始
+	pipe.Expire(ctx, key, sessionConfig.RefreshTokenTTL)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return err
+	}
+	generation := strconv.FormatInt(incr.Val(), 10)
+	for _, id := range excludes {
+		if id == "" {
+			continue
+		}
+		err = redisSrv.Set(ctx, authTokenKeptKeyPrefix+account+":"+id, generation, sessionConfig.RefreshTokenTTL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
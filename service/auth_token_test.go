@@ -0,0 +1,69 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccessToken(t *testing.T) {
+	assert := assert.New(t)
+
+	newClaims := func(tokenType string, expiresAt time.Time) *AuthTokenClaims {
+		return &AuthTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+			Type:    tokenType,
+			UserID:  1,
+			Account: "treexie",
+			Roles:   []string{"su"},
+		}
+	}
+
+	token, err := signAuthToken(newClaims(AuthTokenTypeAccess, time.Now().Add(time.Minute)))
+	assert.Nil(err)
+	claims, err := ParseAccessToken(token)
+	assert.Nil(err)
+	assert.Equal("treexie", claims.Account)
+	assert.Equal([]string{"su"}, claims.Roles)
+
+	// 篡改的token
+	_, err = ParseAccessToken(token + "a")
+	assert.NotNil(err)
+
+	// refresh token不可用于接口认证
+	token, err = signAuthToken(newClaims(AuthTokenTypeRefresh, time.Now().Add(time.Minute)))
+	assert.Nil(err)
+	_, err = ParseAccessToken(token)
+	assert.NotNil(err)
+
+	// 已过期
+	token, err = signAuthToken(newClaims(AuthTokenTypeAccess, time.Now().Add(-time.Minute)))
+	assert.Nil(err)
+	_, err = ParseAccessToken(token)
+	assert.NotNil(err)
+
+	// 非signed keys签名的token
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(AuthTokenTypeAccess, time.Now().Add(time.Minute))).
+		SignedString([]byte("abc"))
+	assert.Nil(err)
+	_, err = ParseAccessToken(token)
+	assert.NotNil(err)
+}
@@ -104,6 +104,8 @@ func (srv *ConfigurationSrv) Refresh(ctx context.Context) error {
 	httpServerInterceptors := make([]string, 0)
 	httpRequestInterceptors := make([]string, 0)
 
+	filePolicies := make([]string, 0)
+
 	requestLimitConfigs := make(map[string]int)
 	for _, item := range configs {
 		switch item.Category {
@@ -141,6 +143,8 @@ func (srv *ConfigurationSrv) Refresh(ctx context.Context) error {
 			httpServerInterceptors = append(httpServerInterceptors, item.Data)
 		case schema.ConfigurationHTTPRequestInterceptor:
 			httpRequestInterceptors = append(httpRequestInterceptors, item.Data)
+		case schema.ConfigurationCategoryFilePolicy:
+			filePolicies = append(filePolicies, item.Data)
 		}
 	}
 
@@ -182,5 +186,8 @@ func (srv *ConfigurationSrv) Refresh(ctx context.Context) error {
 	interceptor.UpdateHTTPServer(httpServerInterceptors)
 	interceptor.UpdateHTTPRequest(httpRequestInterceptors)
 
+	// 更新文件上传策略
+	UpdateFilePolicies(filePolicies)
+
 	return nil
 }
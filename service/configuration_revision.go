@@ -0,0 +1,161 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/configuration"
+	"github.com/vicanso/forest/ent/configurationrevision"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	errConfigurationRevisionCategory = "configurationRevision"
+)
+
+// getLatestConfigurationRevisionVersion 获取配置最新的版本号，无版本时返回0
+func getLatestConfigurationRevisionVersion(ctx context.Context, client *ent.Client, id int) (int, error) {
+	result, err := client.ConfigurationRevision.Query().
+		Where(configurationrevision.ConfigurationID(id)).
+		Order(ent.Desc(configurationrevision.FieldVersion)).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return result.Version, nil
+}
+
+// addConfigurationRevision 记录配置当前数据为新的修订版本
+func addConfigurationRevision(ctx context.Context, client *ent.Client, conf *ent.Configuration, action configurationrevision.Action, operator string, rollbackVersion int) (*ent.ConfigurationRevision, error) {
+	version, err := getLatestConfigurationRevisionVersion(ctx, client, conf.ID)
+	if err != nil {
+		return nil, err
+	}
+	create := client.ConfigurationRevision.Create().
+		SetConfigurationID(conf.ID).
+		SetVersion(version + 1).
+		SetAction(action).
+		SetOperator(operator).
+		SetName(conf.Name).
+		SetCategory(conf.Category.String()).
+		SetStatus(conf.Status).
+		SetData(conf.Data).
+		SetStartedAt(conf.StartedAt).
+		SetEndedAt(conf.EndedAt).
+		SetDescription(conf.Description)
+	if rollbackVersion != 0 {
+		create = create.SetRollbackVersion(rollbackVersion)
+	}
+	return create.Save(ctx)
+}
+
+// AddConfigurationRevision 配置修改后记录修订版本，修改者为当前登录账户，
+// 需要与配置的修改在同一事务中执行
+func AddConfigurationRevision(ctx context.Context, client *ent.Client, conf *ent.Configuration, action configurationrevision.Action) (*ent.ConfigurationRevision, error) {
+	return addConfigurationRevision(ctx, client, conf, action, util.GetAccount(ctx), 0)
+}
+
+// InitConfigurationRevision 配置修改前如果无修订版本（修订版本功能之前添加的配置），
+// 则先将当前数据记录为添加的版本，保证可回滚至修改前的数据
+func InitConfigurationRevision(ctx context.Context, client *ent.Client, conf *ent.Configuration) error {
+	version, err := getLatestConfigurationRevisionVersion(ctx, client, conf.ID)
+	if err != nil || version != 0 {
+		return err
+	}
+	_, err = addConfigurationRevision(ctx, client, conf, configurationrevision.ActionAdd, conf.Owner, 0)
+	return err
+}
+
+// GetConfigurationRevision 获取配置的指定修订版本
+func GetConfigurationRevision(ctx context.Context, id, version int) (*ent.ConfigurationRevision, error) {
+	return helper.EntGetClient().ConfigurationRevision.Query().
+		Where(
+			configurationrevision.ConfigurationID(id),
+			configurationrevision.Version(version),
+		).
+		Only(ctx)
+}
+
+// DiffConfigurationRevision 对比两个修订版本，返回有修改的字段
+func DiffConfigurationRevision(from, to *ent.ConfigurationRevision) map[string]*schema.AuditLogDiff {
+	fields := []struct {
+		name string
+		old  any
+		new  any
+	}{
+		{configurationrevision.FieldName, from.Name, to.Name},
+		{configurationrevision.FieldCategory, from.Category, to.Category},
+		{configurationrevision.FieldStatus, from.Status, to.Status},
+		{configurationrevision.FieldData, from.Data, to.Data},
+		{configurationrevision.FieldStartedAt, from.StartedAt, to.StartedAt},
+		{configurationrevision.FieldEndedAt, from.EndedAt, to.EndedAt},
+		{configurationrevision.FieldDescription, from.Description, to.Description},
+	}
+	result := make(map[string]*schema.AuditLogDiff)
+	for _, item := range fields {
+		if reflect.DeepEqual(item.old, item.new) {
+			continue
+		}
+		result[item.name] = &schema.AuditLogDiff{
+			Old: item.old,
+			New: item.new,
+		}
+	}
+	return result
+}
+
+// RollbackConfiguration 将配置回滚至指定修订版本，回滚后生成新的修订版本，
+// 更新时间为当前时间，下次刷新配置时生效
+func RollbackConfiguration(ctx context.Context, id, version int) (*ent.Configuration, error) {
+	revision, err := GetConfigurationRevision(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	if revision.Action == configurationrevision.ActionDelete {
+		return nil, hes.New("不能回滚至删除的版本", errConfigurationRevisionCategory)
+	}
+	var result *ent.Configuration
+	err = helper.EntWithTx(ctx, func(client *ent.Client) error {
+		// 已删除的配置不允许回滚
+		result, err = client.Configuration.UpdateOneID(id).
+			Where(configuration.DeletedAtIsNil()).
+			SetName(revision.Name).
+			SetCategory(configuration.Category(revision.Category)).
+			SetStatus(revision.Status).
+			SetData(revision.Data).
+			SetStartedAt(revision.StartedAt).
+			SetEndedAt(revision.EndedAt).
+			SetDescription(revision.Description).
+			Save(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = addConfigurationRevision(ctx, client, result, configurationrevision.ActionRollback, util.GetAccount(ctx), version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/schema"
+)
+
+func TestDiffConfigurationRevision(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	from := &ent.ConfigurationRevision{
+		Name:      "test",
+		Category:  schema.ConfigurationCategoryRouterConcurrency,
+		Status:    schema.StatusEnabled,
+		Data:      "GET /users/v1/me 100",
+		StartedAt: now,
+		EndedAt:   now.Add(time.Hour),
+	}
+	to := *from
+	assert.Empty(DiffConfigurationRevision(from, &to))
+
+	to.Status = schema.StatusDisabled
+	to.Data = "GET /users/v1/me 10"
+	to.EndedAt = now.Add(2 * time.Hour)
+	diff := DiffConfigurationRevision(from, &to)
+	assert.Equal(3, len(diff))
+	assert.Equal(schema.StatusEnabled, diff["status"].Old)
+	assert.Equal(schema.StatusDisabled, diff["status"].New)
+	assert.Equal("GET /users/v1/me 100", diff["data"].Old)
+	assert.Equal("GET /users/v1/me 10", diff["data"].New)
+	assert.Equal(now.Add(time.Hour), diff["ended_at"].Old)
+}
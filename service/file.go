@@ -0,0 +1,178 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/log"
+	"github.com/vicanso/hes"
+	"go.uber.org/atomic"
+)
+
+const (
+	presignedUploadKeyPrefix = "presignedUpload:"
+	fileUploadCountKeyPrefix = "fileUploadCount:"
+
+	// 未配置策略时默认的最大文件大小
+	defaultFileMaxSize = 10 * 1024 * 1024
+
+	errFileCategory = "file"
+)
+
+type (
+	// PresignedUpload 预签名上传的记录
+	PresignedUpload struct {
+		Bucket      string `json:"bucket"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"contentType"`
+		Account     string `json:"account"`
+	}
+	// FilePolicy 文件上传策略，按bucket配置
+	FilePolicy struct {
+		Bucket string `json:"bucket"`
+		// 允许的文件类型，支持image/*的形式，为空则不限制
+		ContentTypes []string `json:"contentTypes"`
+		// 文件最大字节数
+		MaxSize int64 `json:"maxSize"`
+		// 每个用户每天最多上传文件数，0表示不限制
+		MaxFilesPerDay int64 `json:"maxFilesPerDay"`
+		// 上传图片时生成的缩略图
+		Thumbnails []ImageOptions `json:"thumbnails"`
+		// 是否允许匿名读取文件，否则仅允许创建者或管理员读取
+		Public bool `json:"public"`
+	}
+)
+
+// 当前的文件上传策略
+var currentFilePolicies = atomic.Value{}
+
+// UpdateFilePolicies 更新文件上传策略
+func UpdateFilePolicies(arr []string) {
+	policies := make(map[string]*FilePolicy)
+	for _, item := range arr {
+		policy := FilePolicy{}
+		err := json.Unmarshal([]byte(item), &policy)
+		if err != nil || policy.Bucket == "" {
+			log.Error(context.Background()).
+				Err(err).
+				Str("data", item).
+				Msg("file policy is invalid")
+			continue
+		}
+		policies[policy.Bucket] = &policy
+	}
+	currentFilePolicies.Store(policies)
+}
+
+// GetFilePolicy 获取bucket对应的文件上传策略，如果未配置则返回默认策略
+func GetFilePolicy(bucket string) *FilePolicy {
+	policies, _ := currentFilePolicies.Load().(map[string]*FilePolicy)
+	policy := FilePolicy{
+		Bucket: bucket,
+	}
+	// 策略为共享的数据，因此复制后再设置默认值
+	if item := policies[bucket]; item != nil {
+		policy = *item
+	}
+	if policy.MaxSize <= 0 {
+		policy.MaxSize = defaultFileMaxSize
+	}
+	return &policy
+}
+
+// isAllowedContentType 判断文件类型是否允许
+func (policy *FilePolicy) isAllowedContentType(contentType string) bool {
+	if len(policy.ContentTypes) == 0 {
+		return true
+	}
+	for _, item := range policy.ContentTypes {
+		if item == contentType {
+			return true
+		}
+		// 支持image/*的形式
+		prefix, ok := strings.CutSuffix(item, "/*")
+		if ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateContentType 校验文件类型是否符合策略
+func (policy *FilePolicy) ValidateContentType(contentType string) error {
+	if !policy.isAllowedContentType(contentType) {
+		return hes.NewWithStatusCode(fmt.Sprintf("不支持该文件类型：%s", contentType), http.StatusUnsupportedMediaType, errFileCategory)
+	}
+	return nil
+}
+
+// ValidateSize 校验文件大小是否符合策略
+func (policy *FilePolicy) ValidateSize(size int64) error {
+	if size <= 0 {
+		return hes.New("文件不能为空", errFileCategory)
+	}
+	if size > policy.MaxSize {
+		return hes.NewWithStatusCode(fmt.Sprintf("文件大小不能超过%s", humanize.Bytes(uint64(policy.MaxSize))), http.StatusRequestEntityTooLarge, errFileCategory)
+	}
+	return nil
+}
+
+// IncUploadCount 增加用户当天的上传次数，如果超过限制则返回出错
+func (policy *FilePolicy) IncUploadCount(ctx context.Context, account string) error {
+	if policy.MaxFilesPerDay <= 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s%s:%s:%s", fileUploadCountKeyPrefix, time.Now().Format("20060102"), policy.Bucket, account)
+	count, err := redisSrv.IncWith(ctx, key, 1, 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	if count > policy.MaxFilesPerDay {
+		return hes.NewWithStatusCode(fmt.Sprintf("每天最多只能上传%d个文件", policy.MaxFilesPerDay), http.StatusTooManyRequests, errFileCategory)
+	}
+	return nil
+}
+
+// AddPresignedUpload 添加预签名上传记录，用于上传完成时校验
+func AddPresignedUpload(ctx context.Context, upload PresignedUpload, ttl time.Duration) error {
+	return redisSrv.SetStruct(ctx, presignedUploadKeyPrefix+upload.Filename, &upload, ttl)
+}
+
+// GetPresignedUpload 获取预签名上传记录
+func GetPresignedUpload(ctx context.Context, filename string) (*PresignedUpload, error) {
+	upload := PresignedUpload{}
+	err := redisSrv.GetStruct(ctx, presignedUploadKeyPrefix+filename, &upload)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = hes.New("上传记录不存在或已过期", errFileCategory)
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// DelPresignedUpload 删除预签名上传记录
+func DelPresignedUpload(ctx context.Context, filename string) error {
+	_, err := redisSrv.Del(ctx, presignedUploadKeyPrefix+filename)
+	return err
+}
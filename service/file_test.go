@@ -0,0 +1,51 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/hes"
+)
+
+func TestFilePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	UpdateFilePolicies([]string{
+		`{"bucket": "avatar", "contentTypes": ["image/*", "application/pdf"], "maxSize": 1024}`,
+		`{"contentTypes": ["image/png"]}`,
+	})
+
+	policy := GetFilePolicy("test")
+	assert.Equal(int64(defaultFileMaxSize), policy.MaxSize)
+	assert.Nil(policy.ValidateContentType("text/plain"))
+
+	policy = GetFilePolicy("avatar")
+	assert.Nil(policy.ValidateContentType("image/png"))
+	assert.Nil(policy.ValidateContentType("application/pdf"))
+	err := policy.ValidateContentType("text/plain")
+	assert.Equal(http.StatusUnsupportedMediaType, hes.Wrap(err).StatusCode)
+
+	assert.Nil(policy.ValidateSize(1024))
+	assert.NotNil(policy.ValidateSize(0))
+	err = policy.ValidateSize(1025)
+	assert.Equal(http.StatusRequestEntityTooLarge, hes.Wrap(err).StatusCode)
+
+	// 修改获取的策略不影响当前的策略
+	policy.MaxSize = 1
+	assert.Equal(int64(1024), GetFilePolicy("avatar").MaxSize)
+}
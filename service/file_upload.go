@@ -0,0 +1,203 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/storage"
+	"github.com/vicanso/hes"
+)
+
+const (
+	// UploadSessionTTL 上传会话的有效期
+	UploadSessionTTL = 24 * time.Hour
+
+	uploadSessionKeyPrefix = "uploadSession:"
+	uploadSessionLockTTL   = 5 * time.Second
+	// 获取锁的最大重试次数
+	uploadSessionLockRetries = 50
+)
+
+type (
+	// UploadSession 分块上传的会话
+	UploadSession struct {
+		ID          string `json:"id"`
+		Bucket      string `json:"bucket"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"contentType"`
+		Account     string `json:"account"`
+		// 存储中的分块上传id
+		UploadID string `json:"uploadID"`
+		// 文件大小
+		Size int64 `json:"size"`
+		// 分块大小
+		ChunkSize int64 `json:"chunkSize"`
+		// 已上传的分块，key为分块序号
+		Parts map[int]storage.FilePart `json:"parts"`
+
+		CreatedAt time.Time `json:"createdAt"`
+		ExpiredAt time.Time `json:"expiredAt"`
+	}
+	// UploadRange 已上传的数据范围
+	UploadRange struct {
+		Start int64 `json:"start"`
+		// 包括end
+		End int64 `json:"end"`
+	}
+)
+
+// Chunks 获取分块的总数
+func (session *UploadSession) Chunks() int {
+	return int((session.Size + session.ChunkSize - 1) / session.ChunkSize)
+}
+
+// GetChunkSize 获取分块的大小，最后一个分块可能小于分块大小，
+// 如果分块序号不合法则返回0
+func (session *UploadSession) GetChunkSize(number int) int64 {
+	chunks := session.Chunks()
+	if number < 1 || number > chunks {
+		return 0
+	}
+	if number < chunks {
+		return session.ChunkSize
+	}
+	return session.Size - int64(chunks-1)*session.ChunkSize
+}
+
+// MissingChunks 获取未上传的分块序号
+func (session *UploadSession) MissingChunks() []int {
+	result := make([]int, 0)
+	for i := 1; i <= session.Chunks(); i++ {
+		if _, ok := session.Parts[i]; !ok {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// ReceivedRanges 获取已上传的数据范围，连续的分块合并为一个范围
+func (session *UploadSession) ReceivedRanges() []UploadRange {
+	numbers := make([]int, 0, len(session.Parts))
+	for number := range session.Parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	result := make([]UploadRange, 0)
+	for _, number := range numbers {
+		start := int64(number-1) * session.ChunkSize
+		end := start + session.GetChunkSize(number) - 1
+		count := len(result)
+		if count != 0 && result[count-1].End+1 == start {
+			result[count-1].End = end
+			continue
+		}
+		result = append(result, UploadRange{
+			Start: start,
+			End:   end,
+		})
+	}
+	return result
+}
+
+// SortedParts 获取按序号排序的分块
+func (session *UploadSession) SortedParts() []storage.FilePart {
+	parts := make([]storage.FilePart, 0, len(session.Parts))
+	for _, part := range session.Parts {
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+	return parts
+}
+
+// saveUploadSession 保存上传会话，有效期为会话的过期时间
+func saveUploadSession(ctx context.Context, session *UploadSession) error {
+	ttl := time.Until(session.ExpiredAt)
+	if ttl <= 0 {
+		return hes.New("上传会话已过期", errFileCategory)
+	}
+	return redisSrv.SetStruct(ctx, uploadSessionKeyPrefix+session.ID, session, ttl)
+}
+
+// AddUploadSession 添加上传会话
+func AddUploadSession(ctx context.Context, session *UploadSession) error {
+	if session.Parts == nil {
+		session.Parts = make(map[int]storage.FilePart)
+	}
+	return saveUploadSession(ctx, session)
+}
+
+// GetUploadSession 获取上传会话
+func GetUploadSession(ctx context.Context, id string) (*UploadSession, error) {
+	session := UploadSession{}
+	err := redisSrv.GetStruct(ctx, uploadSessionKeyPrefix+id, &session)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = hes.NewWithStatusCode("上传会话不存在或已过期", http.StatusNotFound, errFileCategory)
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// AddUploadSessionPart 记录已上传的分块，由于分块可并发上传，因此更新时需加锁
+func AddUploadSessionPart(ctx context.Context, id string, part storage.FilePart) (*UploadSession, error) {
+	key := uploadSessionKeyPrefix + id + ":lock"
+	for i := 0; i < uploadSessionLockRetries; i++ {
+		ok, done, err := redisSrv.LockWithDone(ctx, key, uploadSessionLockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		defer func() {
+			_ = done()
+		}()
+		session, err := GetUploadSession(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		session.Parts[part.Number] = part
+		err = saveUploadSession(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+	return nil, hes.NewWithStatusCode("上传会话繁忙，请稍后重试", http.StatusConflict, errFileCategory)
+}
+
+// DelUploadSession 删除上传会话
+func DelUploadSession(ctx context.Context, id string) error {
+	_, err := redisSrv.Del(ctx, uploadSessionKeyPrefix+id)
+	return err
+}
+
+// AbortExpiredUploads 终止已过期会话对应的分块上传，清除已上传的分块
+func AbortExpiredUploads(ctx context.Context) (int, error) {
+	uploader := storage.MultipartUploader()
+	if uploader == nil {
+		return 0, nil
+	}
+	return uploader.AbortExpiredMultipartUploads(ctx, time.Now().Add(-UploadSessionTTL))
+}
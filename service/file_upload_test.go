@@ -0,0 +1,57 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/storage"
+)
+
+func TestUploadSession(t *testing.T) {
+	assert := assert.New(t)
+
+	session := UploadSession{
+		Size:      25,
+		ChunkSize: 10,
+		Parts:     make(map[int]storage.FilePart),
+	}
+	assert.Equal(3, session.Chunks())
+	assert.Equal(int64(10), session.GetChunkSize(1))
+	assert.Equal(int64(5), session.GetChunkSize(3))
+	assert.Equal(int64(0), session.GetChunkSize(0))
+	assert.Equal(int64(0), session.GetChunkSize(4))
+
+	assert.Equal([]int{1, 2, 3}, session.MissingChunks())
+	assert.Empty(session.ReceivedRanges())
+
+	session.Parts[3] = storage.FilePart{Number: 3}
+	session.Parts[1] = storage.FilePart{Number: 1}
+	assert.Equal([]int{2}, session.MissingChunks())
+	assert.Equal([]UploadRange{
+		{Start: 0, End: 9},
+		{Start: 20, End: 24},
+	}, session.ReceivedRanges())
+
+	session.Parts[2] = storage.FilePart{Number: 2}
+	assert.Empty(session.MissingChunks())
+	assert.Equal([]UploadRange{
+		{Start: 0, End: 24},
+	}, session.ReceivedRanges())
+	parts := session.SortedParts()
+	assert.Equal(1, parts[0].Number)
+	assert.Equal(3, parts[2].Number)
+}
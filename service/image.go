@@ -0,0 +1,215 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	// 注册gif的解码
+	_ "image/gif"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/vicanso/hes"
+	"golang.org/x/image/draw"
+	// 注册webp的解码
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	errImageCategory = "image"
+
+	// 允许处理的图片最大像素数，避免超大图片占用过多内存
+	maxImagePixels = 50 * 1000 * 1000
+
+	defaultImageQuality = 80
+)
+
+const (
+	// ImageFitCover 等比缩放后裁剪，填满指定尺寸
+	ImageFitCover = "cover"
+	// ImageFitContain 等比缩放至指定尺寸内
+	ImageFitContain = "contain"
+	// ImageFitFill 拉伸至指定尺寸
+	ImageFitFill = "fill"
+
+	// ImageTypeJPEG jpeg
+	ImageTypeJPEG = "jpeg"
+	// ImageTypePNG png
+	ImageTypePNG = "png"
+	// ImageTypeWEBP webp（无损压缩）
+	ImageTypeWEBP = "webp"
+)
+
+// ImageOptions 图片处理参数
+type ImageOptions struct {
+	// 宽度，为0则根据高度等比缩放
+	Width int `json:"w"`
+	// 高度，为0则根据宽度等比缩放
+	Height int `json:"h"`
+	// 缩放方式
+	Fit string `json:"fit"`
+	// 转换的图片类型，为空则与原图一致
+	Type string `json:"type"`
+	// 图片质量，仅jpeg有效
+	Quality int `json:"quality"`
+}
+
+// IsImageContentType 判断是否支持处理的图片类型
+func IsImageContentType(contentType string) bool {
+	switch contentType {
+	case "image/jpeg",
+		"image/png",
+		"image/gif",
+		"image/webp":
+		return true
+	}
+	return false
+}
+
+// IsEmpty 判断是否未指定任何处理参数
+func (opts *ImageOptions) IsEmpty() bool {
+	return opts.Width == 0 &&
+		opts.Height == 0 &&
+		opts.Type == "" &&
+		opts.Quality == 0
+}
+
+// normalize 根据原图类型设置默认值
+func (opts *ImageOptions) normalize(contentType string) {
+	if opts.Fit == "" {
+		opts.Fit = ImageFitContain
+	}
+	if opts.Type == "" {
+		// gif仅支持解码（无对应的编码），默认转换为png
+		switch contentType {
+		case "image/jpeg":
+			opts.Type = ImageTypeJPEG
+		case "image/webp":
+			opts.Type = ImageTypeWEBP
+		default:
+			opts.Type = ImageTypePNG
+		}
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = defaultImageQuality
+	}
+}
+
+// VariantName 根据原文件名与处理参数生成衍生图片的文件名，
+// 如abc.png@200x200_cover_q80.jpeg
+func (opts ImageOptions) VariantName(filename, contentType string) string {
+	opts.normalize(contentType)
+	return fmt.Sprintf("%s@%dx%d_%s_q%d.%s", filename, opts.Width, opts.Height, opts.Fit, opts.Quality, opts.Type)
+}
+
+// getImageSize 根据原图尺寸与处理参数计算缩放后的尺寸以及需要截取的区域
+func (opts *ImageOptions) getImageSize(bounds image.Rectangle) (int, int, image.Rectangle) {
+	srcWidth := bounds.Dx()
+	srcHeight := bounds.Dy()
+	width := opts.Width
+	height := opts.Height
+	// 未指定尺寸则不缩放
+	if width == 0 && height == 0 {
+		return srcWidth, srcHeight, bounds
+	}
+	// 仅指定其中一个则等比缩放
+	if width == 0 {
+		width = max(1, srcWidth*height/srcHeight)
+		return width, height, bounds
+	}
+	if height == 0 {
+		height = max(1, srcHeight*width/srcWidth)
+		return width, height, bounds
+	}
+	switch opts.Fit {
+	case ImageFitFill:
+		return width, height, bounds
+	case ImageFitCover:
+		// 截取原图中与目标尺寸比例一致的居中区域
+		cropWidth := srcWidth
+		cropHeight := srcWidth * height / width
+		if cropHeight > srcHeight {
+			cropHeight = srcHeight
+			cropWidth = srcHeight * width / height
+		}
+		x := bounds.Min.X + (srcWidth-cropWidth)/2
+		y := bounds.Min.Y + (srcHeight-cropHeight)/2
+		return width, height, image.Rect(x, y, x+cropWidth, y+cropHeight)
+	default:
+		// contain，以缩放比例较小的为准
+		if srcWidth*height > srcHeight*width {
+			height = max(1, srcHeight*width/srcWidth)
+		} else {
+			width = max(1, srcWidth*height/srcHeight)
+		}
+		return width, height, bounds
+	}
+}
+
+// ProcessImage 根据参数缩放、裁剪图片并转换格式，返回转换后的数据与类型
+func ProcessImage(r io.Reader, contentType string, opts ImageOptions) ([]byte, string, error) {
+	if !IsImageContentType(contentType) {
+		return nil, "", hes.New("该文件类型不支持图片处理", errImageCategory)
+	}
+	opts.normalize(contentType)
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	conf, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, "", hes.Wrap(err)
+	}
+	if conf.Width*conf.Height > maxImagePixels {
+		return nil, "", hes.New("图片尺寸过大，不支持处理", errImageCategory)
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, "", hes.Wrap(err)
+	}
+	width, height, src := opts.getImageSize(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	// jpeg不支持透明，以白色为背景
+	if opts.Type == ImageTypeJPEG {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Over, nil)
+
+	b := bytes.Buffer{}
+	switch opts.Type {
+	case ImageTypeJPEG:
+		err = jpeg.Encode(&b, dst, &jpeg.Options{
+			Quality: opts.Quality,
+		})
+	case ImageTypePNG:
+		err = png.Encode(&b, dst)
+	case ImageTypeWEBP:
+		// webp仅支持无损编码，图片质量参数无效
+		err = nativewebp.Encode(&b, dst, nil)
+	default:
+		err = hes.New(fmt.Sprintf("不支持转换为%s", strings.ToUpper(opts.Type)), errImageCategory)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return b.Bytes(), "image/" + opts.Type, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := ImageOptions{}
+	assert.True(opts.IsEmpty())
+	opts.Width = 100
+	assert.False(opts.IsEmpty())
+	assert.Equal("a.png@100x0_contain_q80.png", opts.VariantName("a.png", "image/png"))
+	assert.Equal("a.jpg@100x0_contain_q80.jpeg", opts.VariantName("a.jpg", "image/jpeg"))
+	assert.Equal("a.webp@100x0_contain_q80.webp", opts.VariantName("a.webp", "image/webp"))
+
+	bounds := image.Rect(0, 0, 400, 200)
+	width, height, _ := opts.getImageSize(bounds)
+	assert.Equal(100, width)
+	assert.Equal(50, height)
+
+	opts = ImageOptions{
+		Width:  100,
+		Height: 100,
+		Fit:    ImageFitContain,
+	}
+	width, height, _ = opts.getImageSize(bounds)
+	assert.Equal(100, width)
+	assert.Equal(50, height)
+
+	opts.Fit = ImageFitCover
+	width, height, src := opts.getImageSize(bounds)
+	assert.Equal(100, width)
+	assert.Equal(100, height)
+	assert.Equal(image.Rect(100, 0, 300, 200), src)
+
+	opts.Fit = ImageFitFill
+	width, height, src = opts.getImageSize(bounds)
+	assert.Equal(100, width)
+	assert.Equal(100, height)
+	assert.Equal(bounds, src)
+}
+
+func TestProcessImage(t *testing.T) {
+	assert := assert.New(t)
+
+	b := bytes.Buffer{}
+	err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 400, 200)))
+	assert.Nil(err)
+
+	data, contentType, err := ProcessImage(bytes.NewReader(b.Bytes()), "image/png", ImageOptions{
+		Width:  100,
+		Height: 100,
+		Fit:    ImageFitCover,
+		Type:   ImageTypeJPEG,
+	})
+	assert.Nil(err)
+	assert.Equal("image/jpeg", contentType)
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	assert.Nil(err)
+	assert.Equal("jpeg", format)
+	assert.Equal(100, conf.Width)
+	assert.Equal(100, conf.Height)
+
+	data, contentType, err = ProcessImage(bytes.NewReader(b.Bytes()), "image/png", ImageOptions{
+		Width: 100,
+		Type:  ImageTypeWEBP,
+	})
+	assert.Nil(err)
+	assert.Equal("image/webp", contentType)
+	conf, format, err = image.DecodeConfig(bytes.NewReader(data))
+	assert.Nil(err)
+	assert.Equal("webp", format)
+	assert.Equal(100, conf.Width)
+	assert.Equal(50, conf.Height)
+
+	_, _, err = ProcessImage(bytes.NewReader(b.Bytes()), "text/plain", ImageOptions{})
+	assert.NotNil(err)
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/email"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/userlogin"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/log"
+)
+
+const (
+	loginFailureKeyPrefix = "loginFailure:"
+
+	// 用于判断是否可疑登录的近期登录记录数
+	recentLoginCount = 10
+)
+
+var accountConfig = config.MustGetAccountConfig()
+
+// IsAccountLocked 判断账户是否处于锁定状态
+func IsAccountLocked(u *ent.User) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
+}
+
+// AddLoginFailure 增加账户登录失败次数，在统计周期内达到限制次数则锁定账户，
+// 并发送邮件通知用户，返回账户是否已锁定
+func AddLoginFailure(ctx context.Context, u *ent.User) (bool, error) {
+	count, err := redisSrv.IncWith(ctx, loginFailureKeyPrefix+u.Account, 1, accountConfig.LockWindow)
+	if err != nil {
+		return false, err
+	}
+	if count < int64(accountConfig.LockMaxFailures) {
+		return false, nil
+	}
+	lockedUntil := time.Now().Add(accountConfig.LockDuration)
+	_, err = u.Update().
+		SetLockedUntil(lockedUntil).
+		Save(ctx)
+	if err != nil {
+		return false, err
+	}
+	// 锁定后重新统计
+	_, _ = redisSrv.Del(ctx, loginFailureKeyPrefix+u.Account)
+	log.Warn(ctx).
+		Str("account", u.Account).
+		Time("lockedUntil", lockedUntil).
+		Msg("account is locked")
+	if u.Email != "" {
+		message := fmt.Sprintf("您的账户%s登录失败次数过多，已锁定至%s。如非本人操作，请尽快修改密码。",
+			u.Account,
+			lockedUntil.Format(time.RFC3339),
+		)
+		email.Send(ctx, "账户已锁定", message, u.Email)
+	}
+	return true, nil
+}
+
+// ResetLoginFailure 清除账户登录失败次数
+func ResetLoginFailure(ctx context.Context, account string) error {
+	_, err := redisSrv.Del(ctx, loginFailureKeyPrefix+account)
+	return err
+}
+
+// UnlockAccount 解除账户锁定，并清除登录失败次数
+func UnlockAccount(ctx context.Context, u *ent.User) (*ent.User, error) {
+	result, err := u.Update().
+		ClearLockedUntil().
+		Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = ResetLoginFailure(ctx, u.Account)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isSuspiciousLocation 判断登录定位是否可疑，与近期登录记录相比，
+// 国家、省份或网络服务商任一未出现过则为可疑，定位失败的字段则忽略
+func isSuspiciousLocation(records []*ent.UserLogin, country, province, isp string) bool {
+	// 无历史记录（首次登录）不判断
+	if len(records) == 0 {
+		return false
+	}
+	isNew := func(value string, get func(*ent.UserLogin) string) bool {
+		if value == "" {
+			return false
+		}
+		for _, item := range records {
+			if get(item) == value {
+				return false
+			}
+		}
+		return true
+	}
+	return isNew(country, func(item *ent.UserLogin) string {
+		return item.Country
+	}) || isNew(province, func(item *ent.UserLogin) string {
+		return item.Province
+	}) || isNew(isp, func(item *ent.UserLogin) string {
+		return item.Isp
+	})
+}
+
+// IsSuspiciousLogin 根据近期登录记录判断此次登录是否可疑，需要在保存此次登录记录前调用
+func IsSuspiciousLogin(ctx context.Context, account, country, province, isp string) (bool, error) {
+	records, err := helper.EntGetClient().UserLogin.Query().
+		Where(userlogin.Account(account)).
+		Order(ent.Desc(userlogin.FieldCreatedAt)).
+		Limit(recentLoginCount).
+		All(ctx)
+	if err != nil {
+		return false, err
+	}
+	return isSuspiciousLocation(records, country, province, isp), nil
+}
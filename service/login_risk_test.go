@@ -0,0 +1,64 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/ent"
+)
+
+func TestIsAccountLocked(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(IsAccountLocked(&ent.User{}))
+	expired := time.Now().Add(-time.Minute)
+	assert.False(IsAccountLocked(&ent.User{
+		LockedUntil: &expired,
+	}))
+	lockedUntil := time.Now().Add(time.Minute)
+	assert.True(IsAccountLocked(&ent.User{
+		LockedUntil: &lockedUntil,
+	}))
+}
+
+func TestIsSuspiciousLocation(t *testing.T) {
+	assert := assert.New(t)
+
+	records := []*ent.UserLogin{
+		{
+			Country:  "中国",
+			Province: "广东",
+			Isp:      "电信",
+		},
+		{
+			Country:  "中国",
+			Province: "北京",
+			Isp:      "联通",
+		},
+	}
+	// 首次登录
+	assert.False(isSuspiciousLocation(nil, "中国", "广东", "电信"))
+
+	assert.False(isSuspiciousLocation(records, "中国", "北京", "电信"))
+	// 定位失败
+	assert.False(isSuspiciousLocation(records, "", "", ""))
+
+	assert.True(isSuspiciousLocation(records, "美国", "", ""))
+	assert.True(isSuspiciousLocation(records, "中国", "上海", "电信"))
+	assert.True(isSuspiciousLocation(records, "中国", "广东", "移动"))
+}
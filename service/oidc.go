@@ -0,0 +1,387 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/samber/lo"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	oidcStateKeyPrefix = "oidcState:"
+
+	errOIDCCategory = "oidc"
+
+	// 未知的key id时重新拉取jwks的最小间隔，避免被恶意token频繁触发
+	oidcKeysRefreshInterval = time.Minute
+)
+
+type (
+	// OIDCState 认证流程的状态信息，保存于redis中，回调时校验
+	OIDCState struct {
+		State string `json:"state"`
+		// PKCE的code verifier
+		Verifier string `json:"verifier"`
+		Nonce    string `json:"nonce"`
+		// 登录成功后跳转的地址
+		Redirect string `json:"redirect"`
+	}
+	// OIDCClaims id token中的用户信息
+	OIDCClaims struct {
+		Subject           string
+		Email             string
+		EmailVerified     bool
+		Name              string
+		PreferredUsername string
+		Groups            []string
+	}
+	// oidcMetadata 认证服务的配置信息
+	oidcMetadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	// oidcTokenResp 获取token的响应
+	oidcTokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	// oidcJWKS 认证服务的公钥列表
+	oidcJWKS struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	// OIDCProvider OIDC认证服务
+	OIDCProvider struct {
+		conf *config.OIDCConfig
+		// token响应包含敏感数据，因此不使用request中的实例（会记录响应数据）
+		client *http.Client
+
+		mutex         sync.RWMutex
+		metadata      *oidcMetadata
+		keys          map[string]*rsa.PublicKey
+		keysFetchedAt time.Time
+	}
+)
+
+func newErrOIDC(message string) *hes.Error {
+	return hes.NewWithStatusCode(message, http.StatusUnauthorized, errOIDCCategory)
+}
+
+// NewOIDCProvider 创建OIDC认证服务
+func NewOIDCProvider(conf *config.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		conf: conf,
+		client: &http.Client{
+			Timeout: conf.Timeout,
+		},
+	}
+}
+
+// NewOIDCState 生成新的认证状态
+func NewOIDCState(redirect string) *OIDCState {
+	return &OIDCState{
+		State:    util.SecureRandomString(32),
+		Verifier: util.SecureRandomString(64),
+		Nonce:    util.SecureRandomString(32),
+		Redirect: redirect,
+	}
+}
+
+// CodeChallenge 获取PKCE的code challenge(S256)
+func (s *OIDCState) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(s.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SaveOIDCState 保存认证状态
+func SaveOIDCState(ctx context.Context, s *OIDCState, ttl time.Duration) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return redisSrv.Set(ctx, oidcStateKeyPrefix+s.State, buf, ttl)
+}
+
+// ConsumeOIDCState 获取并删除认证状态，每个状态仅能使用一次
+func ConsumeOIDCState(ctx context.Context, state string) (*OIDCState, error) {
+	buf, err := redisSrv.GetAndDel(ctx, oidcStateKeyPrefix+state)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = newErrOIDC("认证已过期，请重新登录")
+		}
+		return nil, err
+	}
+	s := &OIDCState{}
+	err = json.Unmarshal(buf, s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Enabled 是否已配置OIDC认证
+func (p *OIDCProvider) Enabled() bool {
+	return p.conf.Issuer != ""
+}
+
+// getJSON 获取json数据
+func (p *OIDCProvider) getJSON(ctx context.Context, uri string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	return p.do(req, v)
+}
+
+// do 发送请求并解析json响应
+func (p *OIDCProvider) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		he := hes.NewWithStatusCode("认证服务请求失败", http.StatusBadGateway, errOIDCCategory)
+		he.Exception = true
+		return he
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getMetadata 获取认证服务的配置信息，成功后缓存
+func (p *OIDCProvider) getMetadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mutex.RLock()
+	metadata := p.metadata
+	p.mutex.RUnlock()
+	if metadata != nil {
+		return metadata, nil
+	}
+	metadata = &oidcMetadata{}
+	err := p.getJSON(ctx, strings.TrimSuffix(p.conf.Issuer, "/")+"/.well-known/openid-configuration", metadata)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Issuer != p.conf.Issuer {
+		return nil, hes.New("认证服务的issuer与配置不一致", errOIDCCategory)
+	}
+	p.mutex.Lock()
+	p.metadata = metadata
+	p.mutex.Unlock()
+	return metadata, nil
+}
+
+// getKey 获取key id对应的公钥，未找到时重新拉取jwks
+func (p *OIDCProvider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mutex.RLock()
+	key := p.keys[kid]
+	fetchedAt := p.keysFetchedAt
+	p.mutex.RUnlock()
+	if key != nil {
+		return key, nil
+	}
+	if time.Since(fetchedAt) < oidcKeysRefreshInterval {
+		return nil, newErrOIDC("id token的签名key不存在")
+	}
+	metadata, err := p.getMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jwks := &oidcJWKS{}
+	err = p.getJSON(ctx, metadata.JWKSURI, jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, item := range jwks.Keys {
+		if item.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(item.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(item.E)
+		if err != nil {
+			continue
+		}
+		keys[item.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.mutex.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mutex.Unlock()
+	key = keys[kid]
+	if key == nil {
+		return nil, newErrOIDC("id token的签名key不存在")
+	}
+	return key, nil
+}
+
+// AuthorizeURL 获取跳转至认证服务的地址
+func (p *OIDCProvider) AuthorizeURL(ctx context.Context, s *OIDCState) (string, error) {
+	metadata, err := p.getMetadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.conf.ClientID)
+	query.Set("redirect_uri", p.conf.RedirectURL)
+	query.Set("scope", strings.Join(p.conf.Scopes, " "))
+	query.Set("state", s.State)
+	query.Set("nonce", s.Nonce)
+	query.Set("code_challenge", s.CodeChallenge())
+	query.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange 使用授权码获取id token，校验后返回用户信息
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, s *OIDCState) (*OIDCClaims, error) {
+	metadata, err := p.getMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.conf.RedirectURL)
+	form.Set("code_verifier", s.Verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	resp := &oidcTokenResp{}
+	err = p.do(req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IDToken == "" {
+		return nil, newErrOIDC("认证服务未返回id token")
+	}
+	return p.verifyIDToken(ctx, resp.IDToken, s.Nonce)
+}
+
+// verifyIDToken 校验id token的签名、issuer、audience、有效期以及nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (*OIDCClaims, error) {
+	metadata, err := p.getMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.conf.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	claims := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	})
+	if err != nil {
+		// 获取公钥时的出错直接返回
+		he, ok := lo.ErrorsAs[*hes.Error](err)
+		if ok {
+			return nil, he
+		}
+		return nil, newErrOIDC("id token校验失败")
+	}
+	if value, _ := claims["nonce"].(string); value != nonce {
+		return nil, newErrOIDC("id token的nonce不匹配")
+	}
+	result := &OIDCClaims{
+		Groups: getOIDCClaimStrings(claims, p.conf.GroupsClaim),
+	}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	// 部分认证服务返回的email_verified为字符串
+	switch value := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = value
+	case string:
+		result.EmailVerified = value == "true"
+	}
+	if result.Subject == "" {
+		return nil, newErrOIDC("id token缺少用户标识")
+	}
+	return result, nil
+}
+
+// getOIDCClaimStrings 获取claim对应的字符串列表，支持字符串或字符串数组
+func getOIDCClaimStrings(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// MapRoles 根据用户的分组同步角色，配置中涉及的角色以认证服务为准，
+// 其它角色（如管理员手动分配的）保持不变
+func (p *OIDCProvider) MapRoles(roles, groups []string) []string {
+	mappedRoles := lo.Values(p.conf.RoleMappings)
+	result := lo.Filter(roles, func(role string, _ int) bool {
+		return !lo.Contains(mappedRoles, role)
+	})
+	for _, group := range groups {
+		role, ok := p.conf.RoleMappings[group]
+		if ok && !lo.Contains(result, role) {
+			result = append(result, role)
+		}
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/hes"
+)
+
+// testOIDCServer 用于测试的认证服务，授权码固定为code
+type testOIDCServer struct {
+	*httptest.Server
+	conf *config.OIDCConfig
+	// 授权时的code challenge
+	challenge string
+	// id token中的信息
+	claims jwt.MapClaims
+}
+
+func newTestOIDCServer(t *testing.T) *testOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	mux := http.NewServeMux()
+	ts := &testOIDCServer{
+		Server: httptest.NewServer(mux),
+	}
+	ts.conf = &config.OIDCConfig{
+		Issuer:       ts.URL,
+		ClientID:     "forest",
+		ClientSecret: "secret",
+		RedirectURL:  "http://127.0.0.1:7001/users/v1/me/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+		GroupsClaim:  "groups",
+		Timeout:      time.Second,
+	}
+	writeJSON := func(w http.ResponseWriter, data any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(data)
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 ts.URL,
+			"authorization_endpoint": ts.URL + "/authorize",
+			"token_endpoint":         ts.URL + "/token",
+			"jwks_uri":               ts.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"keys": []map[string]string{
+				{
+					"kid": "test",
+					"kty": "RSA",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != ts.conf.ClientID || clientSecret != ts.conf.ClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s := OIDCState{
+			Verifier: r.FormValue("code_verifier"),
+		}
+		if r.FormValue("code") != "code" || s.CodeChallenge() != ts.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, ts.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]string{
+			"id_token": idToken,
+		})
+	})
+	return ts
+}
+
+func TestOIDCState(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewOIDCState("/profile")
+	assert.Equal(32, len(s.State))
+	assert.Equal(64, len(s.Verifier))
+	assert.Equal("/profile", s.Redirect)
+
+	// RFC 7636 Appendix B
+	s.Verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	assert.Equal("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", s.CodeChallenge())
+}
+
+func TestOIDCProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := newTestOIDCServer(t)
+	defer ts.Close()
+	ctx := context.Background()
+
+	p := NewOIDCProvider(ts.conf)
+	assert.True(p.Enabled())
+	assert.False(NewOIDCProvider(&config.OIDCConfig{}).Enabled())
+
+	s := NewOIDCState("/")
+	authorizeURL, err := p.AuthorizeURL(ctx, s)
+	assert.Nil(err)
+	urlInfo, err := url.Parse(authorizeURL)
+	assert.Nil(err)
+	assert.Equal("/authorize", urlInfo.Path)
+	query := urlInfo.Query()
+	assert.Equal("code", query.Get("response_type"))
+	assert.Equal("forest", query.Get("client_id"))
+	assert.Equal(ts.conf.RedirectURL, query.Get("redirect_uri"))
+	assert.Equal("openid email", query.Get("scope"))
+	assert.Equal(s.State, query.Get("state"))
+	assert.Equal(s.Nonce, query.Get("nonce"))
+	assert.Equal(s.CodeChallenge(), query.Get("code_challenge"))
+	assert.Equal("S256", query.Get("code_challenge_method"))
+
+	ts.challenge = query.Get("code_challenge")
+	ts.claims = jwt.MapClaims{
+		"iss":            ts.URL,
+		"aud":            "forest",
+		"sub":            "10001",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          s.Nonce,
+		"email":          "tree.xie@outlook.com",
+		"email_verified": true,
+		"groups":         []string{"forest-admins", "developers"},
+	}
+	claims, err := p.Exchange(ctx, "code", s)
+	assert.Nil(err)
+	assert.Equal("10001", claims.Subject)
+	assert.Equal("tree.xie@outlook.com", claims.Email)
+	assert.True(claims.EmailVerified)
+	assert.Equal([]string{"forest-admins", "developers"}, claims.Groups)
+
+	// 授权码错误
+	_, err = p.Exchange(ctx, "invalid", s)
+	assert.Equal("认证服务请求失败", hes.Wrap(err).Message)
+
+	// code verifier不匹配
+	_, err = p.Exchange(ctx, "code", NewOIDCState("/"))
+	assert.Equal("认证服务请求失败", hes.Wrap(err).Message)
+
+	// nonce不匹配
+	ts.claims["nonce"] = "other"
+	_, err = p.Exchange(ctx, "code", s)
+	assert.Equal("id token的nonce不匹配", hes.Wrap(err).Message)
+	ts.claims["nonce"] = s.Nonce
+
+	// audience不匹配
+	ts.claims["aud"] = "other"
+	_, err = p.Exchange(ctx, "code", s)
+	assert.Equal("id token校验失败", hes.Wrap(err).Message)
+	ts.claims["aud"] = "forest"
+
+	// 已过期
+	ts.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.Exchange(ctx, "code", s)
+	assert.Equal("id token校验失败", hes.Wrap(err).Message)
+}
+
+func TestOIDCMapRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewOIDCProvider(&config.OIDCConfig{
+		RoleMappings: map[string]string{
+			"forest-admins": "admin",
+			"forest-ops":    "ops",
+		},
+	})
+	// 添加分组对应的角色
+	assert.Equal([]string{"normal", "admin"}, p.MapRoles([]string{"normal"}, []string{"forest-admins", "developers"}))
+	// 不再属于分组则移除对应的角色，其它角色保留
+	assert.Equal([]string{"su"}, p.MapRoles([]string{"su", "admin"}, []string{"developers"}))
+	assert.Equal([]string{"ops"}, p.MapRoles(nil, []string{"forest-ops", "forest-ops"}))
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/role"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/hes"
+	"go.uber.org/atomic"
+)
+
+const (
+	errRoleCategory = "role"
+)
+
+// RoleInfo 角色信息
+type RoleInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	// 是否要求启用两步验证
+	RequireTOTP bool `json:"requireTOTP"`
+}
+
+// 当前启用的角色，key为角色名称
+var currentRoles = atomic.Value{}
+
+// getBuiltinRoles 获取内置角色，启动时如果不存在则创建
+func getBuiltinRoles() []*RoleInfo {
+	return []*RoleInfo{
+		{
+			Name:        schema.UserRoleNormal,
+			Description: "普通用户",
+		},
+		{
+			Name:        schema.UserRoleAdmin,
+			Description: "管理员用户",
+			Permissions: []string{
+				schema.PermissionUserRead,
+				schema.PermissionUserWrite,
+				schema.PermissionRoleRead,
+				schema.PermissionGroupRead,
+				schema.PermissionGroupWrite,
+				schema.PermissionFileRead,
+				schema.PermissionFileWrite,
+				schema.PermissionFluxRead,
+				schema.PermissionCacheRead,
+				schema.PermissionCacheWrite,
+				schema.PermissionSystemRead,
+			},
+		},
+		{
+			Name:        schema.UserRoleSu,
+			Description: "超级用户",
+			Permissions: []string{
+				schema.PermissionAll,
+			},
+		},
+	}
+}
+
+// IsBuiltinSuRole 判断是否超级用户角色，该角色拥有所有权限且不允许修改
+func IsBuiltinSuRole(name string) bool {
+	return name == schema.UserRoleSu
+}
+
+// InitRoles 创建不存在的内置角色
+func InitRoles(ctx context.Context) error {
+	client := helper.EntGetClient().Role
+	for _, item := range getBuiltinRoles() {
+		exists, err := client.Query().
+			Where(role.Name(item.Name)).
+			Exist(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = client.Create().
+			SetName(item.Name).
+			SetDescription(item.Description).
+			SetPermissions(item.Permissions).
+			Save(ctx)
+		// 多实例同时启动时可能已由其它实例创建
+		if err != nil && !ent.IsConstraintError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshRoles 从数据库中重新加载启用的角色
+func RefreshRoles(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := helper.EntGetClient().Role.Query().
+		Where(role.StatusEQ(schema.StatusEnabled)).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	updateRoles(result)
+	return nil
+}
+
+// updateRoles 更新当前启用的角色
+func updateRoles(result []*ent.Role) {
+	roles := make(map[string]*RoleInfo)
+	for _, item := range result {
+		roles[item.Name] = &RoleInfo{
+			Name:        item.Name,
+			Description: item.Description,
+			Permissions: item.Permissions,
+			RequireTOTP: item.RequireTotp,
+		}
+	}
+	currentRoles.Store(roles)
+}
+
+// getRoles 获取当前启用的角色
+func getRoles() map[string]*RoleInfo {
+	roles, ok := currentRoles.Load().(map[string]*RoleInfo)
+	if !ok {
+		return nil
+	}
+	return roles
+}
+
+// ListRoles 获取当前启用的角色列表，按名称排序
+func ListRoles() []*RoleInfo {
+	result := lo.Values(getRoles())
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// ValidateRoles 校验角色是否均存在且启用
+func ValidateRoles(names []string) error {
+	roles := getRoles()
+	for _, name := range names {
+		if _, ok := roles[name]; !ok {
+			return hes.New("角色不存在或已禁用："+name, errRoleCategory)
+		}
+	}
+	return nil
+}
+
+// ValidateGrantRoles 校验是否允许分配角色，角色需均存在且启用，
+// 而且分配者需拥有角色的所有权限，避免分配高于自身权限的角色
+func ValidateGrantRoles(operatorRoles, names []string) error {
+	err := ValidateRoles(names)
+	if err != nil {
+		return err
+	}
+	for _, permission := range GetPermissions(names) {
+		if !HasPermission(operatorRoles, permission) {
+			return hes.NewWithStatusCode("无权限分配拥有"+permission+"权限的角色", http.StatusForbidden, errRoleCategory)
+		}
+	}
+	return nil
+}
+
+// ValidateManageUser 校验是否允许管理用户（如调整角色、禁用或删除），
+// 操作者需拥有该用户所有角色的权限，避免降级或禁用权限高于自身的用户
+func ValidateManageUser(operatorRoles, userRoles []string) error {
+	for _, permission := range GetPermissions(userRoles) {
+		if !HasPermission(operatorRoles, permission) {
+			return hes.NewWithStatusCode("无权限管理拥有"+permission+"权限的用户", http.StatusForbidden, errRoleCategory)
+		}
+	}
+	return nil
+}
+
+// FilterTOTPRoles 过滤要求两步验证的角色，
+// 未通过两步验证时这些角色的权限均不生效
+func FilterTOTPRoles(names []string, verified bool) []string {
+	if verified {
+		return names
+	}
+	roles := getRoles()
+	return lo.Filter(names, func(name string, _ int) bool {
+		item, ok := roles[name]
+		return !ok || !item.RequireTOTP
+	})
+}
+
+// GetPermissions 获取角色列表对应的所有权限
+func GetPermissions(names []string) []string {
+	roles := getRoles()
+	result := make([]string, 0)
+	for _, name := range names {
+		// 超级用户拥有所有权限，避免因误操作导致无法再管理角色
+		if IsBuiltinSuRole(name) {
+			result = append(result, schema.PermissionAll)
+			continue
+		}
+		item, ok := roles[name]
+		if !ok {
+			continue
+		}
+		result = append(result, item.Permissions...)
+	}
+	return lo.Uniq(result)
+}
+
+// HasPermission 判断角色列表中是否有角色拥有该权限
+func HasPermission(names []string, permission string) bool {
+	for _, item := range GetPermissions(names) {
+		if item == schema.PermissionAll || item == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/schema"
+)
+
+func TestRolePermission(t *testing.T) {
+	assert := assert.New(t)
+
+	updateRoles([]*ent.Role{
+		{
+			Name: "editor",
+			Permissions: []string{
+				schema.PermissionConfigurationRead,
+				schema.PermissionConfigurationWrite,
+			},
+		},
+		{
+			Name: "viewer",
+			Permissions: []string{
+				schema.PermissionConfigurationRead,
+				schema.PermissionUserRead,
+			},
+		},
+	})
+
+	assert.Equal(2, len(ListRoles()))
+	assert.Equal("editor", ListRoles()[0].Name)
+	assert.Nil(ValidateRoles([]string{"editor", "viewer"}))
+	assert.NotNil(ValidateRoles([]string{"editor", "unknown"}))
+
+	assert.Equal([]string{
+		schema.PermissionConfigurationRead,
+		schema.PermissionConfigurationWrite,
+		schema.PermissionUserRead,
+	}, GetPermissions([]string{"editor", "viewer"}))
+
+	assert.True(HasPermission([]string{"viewer"}, schema.PermissionUserRead))
+	assert.False(HasPermission([]string{"viewer"}, schema.PermissionConfigurationWrite))
+	assert.False(HasPermission([]string{"unknown"}, schema.PermissionUserRead))
+	assert.False(HasPermission(nil, schema.PermissionUserRead))
+	// 超级用户拥有所有权限
+	assert.True(HasPermission([]string{schema.UserRoleSu}, schema.PermissionRoleWrite))
+}
+
+func TestValidateGrantRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	updateRoles([]*ent.Role{
+		{
+			Name: "editor",
+			Permissions: []string{
+				schema.PermissionConfigurationRead,
+				schema.PermissionConfigurationWrite,
+			},
+		},
+		{
+			Name: "viewer",
+			Permissions: []string{
+				schema.PermissionConfigurationRead,
+			},
+		},
+		{
+			Name:        schema.UserRoleSu,
+			Permissions: []string{schema.PermissionAll},
+		},
+	})
+
+	assert.Nil(ValidateGrantRoles([]string{"editor"}, []string{"viewer"}))
+	assert.NotNil(ValidateGrantRoles([]string{"viewer"}, []string{"editor"}))
+	assert.NotNil(ValidateGrantRoles([]string{"editor"}, []string{schema.UserRoleSu}))
+	assert.Nil(ValidateGrantRoles([]string{schema.UserRoleSu}, []string{schema.UserRoleSu}))
+	assert.NotNil(ValidateGrantRoles([]string{schema.UserRoleSu}, []string{"unknown"}))
+
+	assert.Nil(ValidateManageUser([]string{"editor"}, []string{"viewer"}))
+	assert.Nil(ValidateManageUser([]string{"editor"}, nil))
+	assert.NotNil(ValidateManageUser([]string{"viewer"}, []string{"editor"}))
+	assert.NotNil(ValidateManageUser([]string{"editor"}, []string{schema.UserRoleSu}))
+	assert.Nil(ValidateManageUser([]string{schema.UserRoleSu}, []string{schema.UserRoleSu}))
+}
+
+func TestFilterTOTPRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	updateRoles([]*ent.Role{
+		{
+			Name:        "editor",
+			RequireTotp: true,
+		},
+		{
+			Name: "viewer",
+		},
+	})
+	names := []string{"editor", "viewer"}
+	assert.Equal(names, FilterTOTPRoles(names, true))
+	assert.Equal([]string{"viewer"}, FilterTOTPRoles(names, false))
+}
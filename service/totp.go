@@ -0,0 +1,137 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/util"
+	"github.com/vicanso/hes"
+)
+
+const (
+	totpEnrollKeyPrefix = "totpEnroll:"
+	totpStepKeyPrefix   = "totpStep:"
+
+	errTOTPCategory = "totp"
+
+	// 恢复码的数量与长度
+	totpRecoveryCodeCount = 10
+	totpRecoveryCodeLen   = 10
+)
+
+type (
+	// TOTPEnrollInfo 两步验证绑定信息
+	TOTPEnrollInfo struct {
+		ExpiredAt time.Time `json:"expiredAt"`
+		// 密钥，用于无法扫描二维码时手动输入
+		Secret string `json:"secret"`
+		// otpauth地址
+		URI string `json:"uri"`
+		// 二维码图片
+		Data []byte `json:"data"`
+		Type string `json:"type"`
+	}
+)
+
+// 两步验证的发行者名称，显示于验证器App中
+var totpIssuer = config.MustGetBasicConfig().Name
+
+// NewTOTPEnroll 生成两步验证的密钥与二维码，密钥暂存于redis中，
+// 在用户校验验证码后才保存至用户信息
+func NewTOTPEnroll(ctx context.Context, account string) (*TOTPEnrollInfo, error) {
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	uri := util.TOTPURI(totpIssuer, account, secret)
+	data, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	ttl := 10 * time.Minute
+	err = redisSrv.Set(ctx, totpEnrollKeyPrefix+account, secret, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollInfo{
+		ExpiredAt: time.Now().Add(ttl),
+		Secret:    secret,
+		URI:       uri,
+		Data:      data,
+		Type:      "png",
+	}, nil
+}
+
+// GetTOTPEnrollSecret 获取暂存的两步验证密钥
+func GetTOTPEnrollSecret(ctx context.Context, account string) (string, error) {
+	data, err := redisSrv.Get(ctx, totpEnrollKeyPrefix+account)
+	if err != nil {
+		if helper.RedisIsNilError(err) {
+			err = hes.New("两步验证绑定已过期，请重新绑定", errTOTPCategory)
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DelTOTPEnrollSecret 删除暂存的两步验证密钥
+func DelTOTPEnrollSecret(ctx context.Context, account string) error {
+	_, err := redisSrv.Del(ctx, totpEnrollKeyPrefix+account)
+	return err
+}
+
+// ValidateTOTP 校验两步验证码，每个周期的验证码仅允许使用一次，避免被重放
+func ValidateTOTP(ctx context.Context, account, secret, code string) (bool, error) {
+	step, err := util.ValidateTOTPCode(secret, code, time.Now())
+	if err != nil || step == 0 {
+		return false, err
+	}
+	key := fmt.Sprintf("%s%s:%d", totpStepKeyPrefix, account, step)
+	// 验证码在前后偏差的周期内均有效，因此锁定时长需覆盖
+	return redisSrv.Lock(ctx, key, 3*util.TOTPPeriod)
+}
+
+// GenerateRecoveryCodes 生成恢复码，返回恢复码以及对应的hash（用于保存）
+func GenerateRecoveryCodes() ([]string, []string) {
+	codes := make([]string, totpRecoveryCodeCount)
+	hashes := make([]string, totpRecoveryCodeCount)
+	for index := range codes {
+		codes[index] = util.SecureRandomString(totpRecoveryCodeLen)
+		hashes[index] = util.Sha256(codes[index])
+	}
+	return codes, hashes
+}
+
+// MatchRecoveryCode 判断恢复码是否匹配，返回匹配的hash所在位置，不匹配则返回-1
+func MatchRecoveryCode(hashes []string, code string) int {
+	code = strings.TrimSpace(code)
+	if len(code) != totpRecoveryCodeLen {
+		return -1
+	}
+	hash := util.Sha256(code)
+	for index, item := range hashes {
+		if item == hash {
+			return index
+		}
+	}
+	return -1
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	codes, hashes := GenerateRecoveryCodes()
+	assert.Equal(totpRecoveryCodeCount, len(codes))
+	assert.Equal(totpRecoveryCodeCount, len(hashes))
+	assert.NotEqual(codes[0], hashes[0])
+
+	assert.Equal(2, MatchRecoveryCode(hashes, codes[2]))
+	assert.Equal(-1, MatchRecoveryCode(hashes, "abc"))
+	assert.Equal(-1, MatchRecoveryCode(hashes[1:], codes[0]))
+}
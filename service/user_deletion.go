@@ -0,0 +1,307 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"entgo.io/ent/dialect/sql"
+	"github.com/vicanso/forest/email"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/apikey"
+	"github.com/vicanso/forest/ent/auditlog"
+	"github.com/vicanso/forest/ent/configuration"
+	"github.com/vicanso/forest/ent/file"
+	"github.com/vicanso/forest/ent/fileversion"
+	"github.com/vicanso/forest/ent/user"
+	"github.com/vicanso/forest/ent/userlogin"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/log"
+	"github.com/vicanso/forest/schema"
+	"github.com/vicanso/forest/session"
+	"github.com/vicanso/forest/util"
+)
+
+const (
+	// 每次处理的记录数，查询的数量限制为200
+	anonymizeBatchSize = 100
+)
+
+// AnonymousAccount 获取注销后的匿名账号，使用用户id保证唯一
+func AnonymousAccount(id int) string {
+	return fmt.Sprintf("deleted_%d", id)
+}
+
+// IsUserDeletionDue 判断账户是否已到注销时间且未匿名化
+func IsUserDeletionDue(u *ent.User, now time.Time) bool {
+	return u.AnonymizedAt == nil &&
+		u.DeletionScheduledAt != nil &&
+		!u.DeletionScheduledAt.After(now)
+}
+
+// ScheduleUserDeletion 申请注销账户，等待期后执行，并邮件通知用户
+func ScheduleUserDeletion(ctx context.Context, u *ent.User) (*ent.User, error) {
+	scheduledAt := time.Now().Add(accountConfig.DeletionGracePeriod)
+	result, err := u.Update().
+		SetDeletionScheduledAt(scheduledAt).
+		Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if u.Email != "" {
+		message := fmt.Sprintf("您的账户%s已申请注销，将于%s执行，在此之前登录并撤销注销即可继续使用。如非本人操作，请尽快撤销并修改密码。",
+			u.Account,
+			scheduledAt.Format(time.RFC3339),
+		)
+		email.Send(ctx, "账户注销申请", message, u.Email)
+	}
+	return result, nil
+}
+
+// CancelUserDeletion 撤销注销账户
+func CancelUserDeletion(ctx context.Context, u *ent.User) (*ent.User, error) {
+	return u.Update().
+		ClearDeletionScheduledAt().
+		Save(ctx)
+}
+
+// anonymizeUserLogins 匿名化用户的登录记录
+func anonymizeUserLogins(ctx context.Context, client *ent.Client, account, anonymousAccount string) error {
+	ctx = helper.EntWithBulkMutation(ctx, "anonymize user logins")
+	// 账号不允许修改，因此通过modifier更新
+	return client.UserLogin.Update().
+		Where(userlogin.Account(account)).
+		Modify(func(u *sql.UpdateBuilder) {
+			u.Set(userlogin.FieldAccount, anonymousAccount)
+		}).
+		ClearUserAgent().
+		ClearIP().
+		ClearTrackID().
+		ClearSessionID().
+		ClearXForwardedFor().
+		ClearCountry().
+		ClearProvince().
+		ClearCity().
+		ClearIsp().
+		Exec(ctx)
+}
+
+// deleteUserAPIKeys 删除用户的API key
+func deleteUserAPIKeys(ctx context.Context, client *ent.Client, account string) error {
+	ctx = helper.EntWithBulkMutation(ctx, "delete user api keys")
+	_, err := client.APIKey.Delete().
+		Where(apikey.Account(account)).
+		Exec(ctx)
+	return err
+}
+
+// anonymizeUserOwnerships 将用户创建的文件、文件历史版本以及配置替换为匿名账户，
+// 文件与配置属于业务数据，仅替换账户而不删除。
+// minio与本地存储的文件创建者保存于文件的metadata中，无法批量修改，因此仅处理数据库中的记录
+func anonymizeUserOwnerships(ctx context.Context, client *ent.Client, account, anonymousAccount string) error {
+	ctx = helper.EntWithBulkMutation(ctx, "anonymize user ownerships")
+	_, err := client.File.Update().
+		Where(file.Creator(account)).
+		SetCreator(anonymousAccount).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	// 历史版本的字段不允许修改，因此通过modifier更新
+	_, err = client.FileVersion.Update().
+		Where(fileversion.Creator(account)).
+		Modify(func(u *sql.UpdateBuilder) {
+			u.Set(fileversion.FieldCreator, anonymousAccount)
+		}).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.FileVersion.Update().
+		Where(fileversion.ReplacedBy(account)).
+		Modify(func(u *sql.UpdateBuilder) {
+			u.Set(fileversion.FieldReplacedBy, anonymousAccount)
+		}).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.Configuration.Update().
+		Where(configuration.Owner(account)).
+		SetOwner(anonymousAccount).
+		Save(ctx)
+	return err
+}
+
+// anonymizeUserAuditLogs 匿名化用户相关的审计日志，
+// 用户、登录记录以及API key的修改内容清除，账户替换为匿名账户
+func anonymizeUserAuditLogs(ctx context.Context, client *ent.Client, id int, account, anonymousAccount string) error {
+	ctx = helper.EntWithBulkMutation(ctx, "anonymize user audit logs")
+	// 登录记录的账户已匿名化，通过子查询筛选
+	isUserLogin := func(s *sql.Selector) {
+		t := sql.Table(userlogin.Table)
+		s.Where(sql.In(
+			s.C(auditlog.FieldEntityID),
+			sql.Select(t.C(userlogin.FieldID)).
+				From(t).
+				Where(sql.EQ(t.C(userlogin.FieldAccount), anonymousAccount)),
+		))
+	}
+	_, err := client.AuditLog.Update().
+		Where(auditlog.Or(
+			auditlog.And(
+				auditlog.EntityType(ent.TypeUser),
+				auditlog.EntityID(id),
+			),
+			auditlog.And(
+				auditlog.EntityType(ent.TypeUserLogin),
+				isUserLogin,
+			),
+			auditlog.And(
+				auditlog.EntityType(ent.TypeAPIKey),
+				auditlog.Account(account),
+			),
+		)).
+		ClearDiff().
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	// 账户不允许修改，因此通过modifier更新
+	_, err = client.AuditLog.Update().
+		Where(auditlog.Account(account)).
+		Modify(func(u *sql.UpdateBuilder) {
+			u.Set(auditlog.FieldAccount, anonymousAccount)
+		}).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.AuditLog.Update().
+		Where(auditlog.Impersonator(account)).
+		Modify(func(u *sql.UpdateBuilder) {
+			u.Set(auditlog.FieldImpersonator, anonymousAccount)
+		}).
+		Save(ctx)
+	return err
+}
+
+// DeleteUser 删除账户（软删除），使所有登录状态失效并删除API key，
+// 登录记录等数据保留，账号也不可再被注册
+func DeleteUser(ctx context.Context, u *ent.User) error {
+	err := session.DestroyUserSessions(ctx, u.Account)
+	if err != nil {
+		return err
+	}
+	err = RevokeAuthTokens(ctx, u.Account)
+	if err != nil {
+		return err
+	}
+	client := helper.EntGetClient()
+	err = deleteUserAPIKeys(ctx, client, u.Account)
+	if err != nil {
+		return err
+	}
+	return client.User.DeleteOneID(u.ID).Exec(ctx)
+}
+
+// AnonymizeUser 匿名化注销的账户，清除个人信息而非删除数据，
+// 登录记录同样匿名化，API key直接删除，并使所有登录状态失效。
+// 上传的文件与配置属于业务数据，保留数据但创建者替换为匿名账户。
+// 数据库的修改在同一事务中，任一步骤失败则全部回滚，匿名化时间未设置，下次定时任务会重新处理
+func AnonymizeUser(ctx context.Context, u *ent.User) error {
+	account := u.Account
+	anonymousAccount := AnonymousAccount(u.ID)
+	err := session.DestroyUserSessions(ctx, account)
+	if err != nil {
+		return err
+	}
+	err = RevokeAuthTokens(ctx, account)
+	if err != nil {
+		return err
+	}
+	// 密码使用随机值，无法再登录
+	password, err := util.HashPassword(util.SecureRandomString(32))
+	if err != nil {
+		return err
+	}
+	return helper.EntWithTx(ctx, func(client *ent.Client) error {
+		err := deleteUserAPIKeys(ctx, client, account)
+		if err != nil {
+			return err
+		}
+		err = anonymizeUserLogins(ctx, client, account, anonymousAccount)
+		if err != nil {
+			return err
+		}
+		err = anonymizeUserOwnerships(ctx, client, account, anonymousAccount)
+		if err != nil {
+			return err
+		}
+		err = client.User.UpdateOneID(u.ID).
+			Modify(func(u *sql.UpdateBuilder) {
+				u.Set(user.FieldAccount, anonymousAccount)
+			}).
+			SetPassword(password).
+			SetStatus(schema.StatusDisabled).
+			ClearName().
+			ClearEmail().
+			ClearRoles().
+			ClearGroups().
+			ClearTotpSecret().
+			SetTotpEnabled(false).
+			ClearRecoveryCodes().
+			ClearLockedUntil().
+			ClearOidcSubject().
+			SetAnonymizedAt(time.Now()).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return anonymizeUserAuditLogs(ctx, client, u.ID, account, anonymousAccount)
+	})
+}
+
+// AnonymizeDueUsers 匿名化已到注销时间的账户（包括已删除的账户），返回处理的数量
+func AnonymizeDueUsers(ctx context.Context) (int, error) {
+	now := time.Now()
+	users, err := helper.EntGetClient().User.Query().
+		Where(
+			user.DeletionScheduledAtLTE(now),
+			user.AnonymizedAtIsNil(),
+		).
+		Limit(anonymizeBatchSize).
+		All(schema.SkipSoftDelete(ctx))
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, u := range users {
+		if !IsUserDeletionDue(u, now) {
+			continue
+		}
+		err = AnonymizeUser(ctx, u)
+		if err != nil {
+			return count, err
+		}
+		log.Info(ctx).
+			Int("id", u.ID).
+			Msg("anonymize user success")
+		count++
+	}
+	return count, nil
+}
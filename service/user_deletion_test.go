@@ -0,0 +1,50 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/forest/ent"
+)
+
+func TestAnonymousAccount(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("deleted_12", AnonymousAccount(12))
+}
+
+func TestIsUserDeletionDue(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+
+	assert.False(IsUserDeletionDue(&ent.User{}, now))
+	// 等待期内
+	assert.False(IsUserDeletionDue(&ent.User{
+		DeletionScheduledAt: &after,
+	}, now))
+	assert.True(IsUserDeletionDue(&ent.User{
+		DeletionScheduledAt: &before,
+	}, now))
+	// 已匿名化
+	assert.False(IsUserDeletionDue(&ent.User{
+		DeletionScheduledAt: &before,
+		AnonymizedAt:        &before,
+	}, now))
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vicanso/forest/cache"
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/forest/helper"
+)
+
+type (
+	// SessionInfo 用户登录的session信息，登录时添加至账户的session索引中
+	SessionInfo struct {
+		// session id
+		ID string `json:"id"`
+		// 登录IP
+		IP string `json:"ip"`
+		// 登录时的user-agent
+		UserAgent string `json:"userAgent"`
+		// 登录时间
+		CreatedAt time.Time `json:"createdAt"`
+	}
+)
+
+// 账户的session索引，以hash的形式保存，field为session id
+var userSessionsKeyPrefix = config.MustGetRedisConfig().Prefix + "userSessions:"
+
+func getUserSessionsKey(account string) string {
+	return userSessionsKeyPrefix + account
+}
+
+// AddUserSession 添加session至账户的session索引中
+func AddUserSession(ctx context.Context, account string, info SessionInfo) error {
+	buf, err := json.Marshal(&info)
+	if err != nil {
+		return err
+	}
+	err = helper.RedisGetClient().HSet(ctx, getUserSessionsKey(account), info.ID, buf).Err()
+	if err != nil {
+		return err
+	}
+	return RefreshUserSessions(ctx, account)
+}
+
+// RefreshUserSessions 刷新账户session索引的有效期，
+// 索引的有效期与session一致，登录以及session刷新时均需要刷新，
+// 避免session仍有效而索引已过期，删除账户的所有session时遗漏
+func RefreshUserSessions(ctx context.Context, account string) error {
+	return helper.RedisGetClient().Expire(ctx, getUserSessionsKey(account), scf.TTL).Err()
+}
+
+// ListUserSessions 获取账户的所有有效session，已过期的session从索引中删除
+func ListUserSessions(ctx context.Context, account string) ([]*SessionInfo, error) {
+	key := getUserSessionsKey(account)
+	client := helper.RedisGetClient()
+	result, err := client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	store := cache.GetRedisSession()
+	sessions := make([]*SessionInfo, 0, len(result))
+	for id, value := range result {
+		data, err := store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		// session已过期
+		if len(data) == 0 {
+			err = client.HDel(ctx, key, id).Err()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		info := SessionInfo{}
+		err = json.Unmarshal([]byte(value), &info)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// DestroyUserSession 从账户的session索引中删除并清除该session，
+// 不属于该账户的session则忽略
+func DestroyUserSession(ctx context.Context, account, id string) error {
+	count, err := helper.RedisGetClient().HDel(ctx, getUserSessionsKey(account), id).Result()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	return cache.GetRedisSession().Destroy(ctx, id)
+}
+
+// DestroyUserSessions 删除账户的所有session，可指定保留的session（如当前session）
+func DestroyUserSessions(ctx context.Context, account string, excludes ...string) error {
+	ids, err := helper.RedisGetClient().HKeys(ctx, getUserSessionsKey(account)).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if lo.Contains(excludes, id) {
+			continue
+		}
+		err = DestroyUserSession(ctx, account, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
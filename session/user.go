@@ -33,8 +33,6 @@ const (
 type (
 	// UserInfo 用户session中的信息
 	UserInfo struct {
-		// 登录时使用的Token，此字段不返回
-		Token string `json:"token"`
 		// 用户账号
 		Account string `json:"account"`
 		// 用户ID
@@ -43,8 +41,28 @@ type (
 		Roles []string `json:"roles"`
 		// 用户分组列表
 		Groups []string `json:"groups"`
+		// 是否已通过两步验证
+		TOTPVerified bool `json:"totpVerified"`
+		// 等待两步验证的账号，密码校验通过后设置，通过两步验证后才为登录状态
+		TOTPAccount string `json:"totpAccount,omitempty"`
+		// 两步验证的截止时间（unix时间戳）
+		TOTPExpiredAt int64 `json:"totpExpiredAt,omitempty"`
+		// token认证时的token会话id
+		TokenSessionID string `json:"tokenSessionID,omitempty"`
+		// 使用API key认证时的key id
+		APIKeyID int `json:"apiKeyID,omitempty"`
+		// 使用API key认证时允许的权限，为空则不限制
+		Scopes []string `json:"scopes,omitempty"`
+		// 模拟登录时的原用户，为空表示非模拟登录
+		Impersonator *ImpersonatorInfo `json:"impersonator,omitempty"`
 	}
-	// UserSession 用户session
+	// ImpersonatorInfo 模拟登录的原用户信息，结束模拟登录时恢复
+	ImpersonatorInfo struct {
+		Account      string `json:"account"`
+		ID           int    `json:"id"`
+		TOTPVerified bool   `json:"totpVerified"`
+	}
+	// UserSession 用户session，bearer token认证时se为空，用户信息来自token
 	UserSession struct {
 		unmarshalDone bool
 		se            *se.Session
@@ -52,6 +70,14 @@ type (
 	}
 )
 
+// SessionAccount 获取session所属的账号，模拟登录时为原用户的账号
+func (info UserInfo) SessionAccount() string {
+	if info.Impersonator != nil {
+		return info.Impersonator.Account
+	}
+	return info.Account
+}
+
 // GetUserInfo 获取用户信息
 // 避免修改了session中的数据，因此返回非指针的形式
 func (us *UserSession) GetInfo() (UserInfo, error) {
@@ -96,6 +122,10 @@ func (us *UserSession) IsLogin() bool {
 func (us *UserSession) SetInfo(ctx context.Context, info UserInfo) error {
 	us.info = info
 	us.unmarshalDone = true
+	// token认证的用户信息不保存
+	if us.se == nil {
+		return nil
+	}
 	buf, err := json.Marshal(&info)
 	if err != nil {
 		return err
@@ -104,21 +134,57 @@ func (us *UserSession) SetInfo(ctx context.Context, info UserInfo) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	// 保存session时会刷新其有效期，因此同时刷新账户的session索引
+	return us.refreshIndex(ctx)
+}
+
+// refreshIndex 刷新session所属账户的session索引有效期
+func (us *UserSession) refreshIndex(ctx context.Context) error {
+	account := us.info.SessionAccount()
+	// 未生成id的session不会在索引中
+	if account == "" || us.ID() == "" {
+		return nil
+	}
+	return RefreshUserSessions(ctx, account)
+}
+
+// ID 获取session id
+func (us *UserSession) ID() string {
+	if us.se == nil {
+		return ""
+	}
+	return us.se.ID
 }
 
 // Destroy 清除用户session
 func (us *UserSession) Destroy(ctx context.Context) error {
+	if us.se == nil {
+		return nil
+	}
 	return us.se.Destroy(ctx)
 }
 
 // Refresh 刷新用户session ttl
 func (us *UserSession) Refresh(ctx context.Context) error {
-	return us.se.Refresh(ctx)
+	if us.se == nil {
+		return nil
+	}
+	err := us.se.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = us.GetInfo()
+	if err != nil {
+		return err
+	}
+	return us.refreshIndex(ctx)
 }
 
-// AutoRefresh 判断session是否准备过期，如果是，则刷新 
+// AutoRefresh 判断session是否准备过期，如果是，则刷新
 func (us *UserSession) AutoRefresh(ctx context.Context) error {
+	if us.se == nil {
+		return nil
+	}
 	value := us.se.GetUpdatedAt()
 	t, _ := time.Parse(value, time.RFC3339)
 	// 如果上一次更新时间在12小时之前
@@ -128,6 +194,22 @@ func (us *UserSession) AutoRefresh(ctx context.Context) error {
 	return nil
 }
 
+// IsTokenAuth 判断是否bearer token认证
+func (us *UserSession) IsTokenAuth() bool {
+	return us.se == nil
+}
+
+// NewTokenUserSession 创建bearer token认证的用户session对象，
+// 用户信息来自token，不保存至session存储中
+func NewTokenUserSession(c *elton.Context, info UserInfo) *UserSession {
+	us := &UserSession{
+		unmarshalDone: true,
+		info:          info,
+	}
+	c.Set(cs.UserSession, us)
+	return us
+}
+
 // NewUserSession 创建新的用户session对象
 func NewUserSession(c *elton.Context) *UserSession {
 	if data, ok := c.Get(cs.UserSession); ok {
@@ -49,6 +49,12 @@ func TestUserSession(t *testing.T) {
 		assert.Equal("treexie", info.Account)
 	})
 
+	t.Run("id", func(t *testing.T) {
+		us := newUserSession(`{}`)
+		us.se.ID = "abc"
+		assert.Equal("abc", us.ID())
+	})
+
 	t.Run("is logined", func(t *testing.T) {
 		us := newUserSession(`{}`)
 		assert.False(us.IsLogin())
@@ -87,3 +93,39 @@ func TestNewUserSession(t *testing.T) {
 	assert.NotNil(us)
 	assert.NotNil(us.se)
 }
+
+func TestNewTokenUserSession(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	c := elton.NewContext(nil, nil)
+
+	us := NewTokenUserSession(c, UserInfo{
+		Account: "treexie",
+	})
+	assert.True(us.IsTokenAuth())
+	assert.True(us.IsLogin())
+	assert.Empty(us.ID())
+	assert.Nil(us.Refresh(ctx))
+	assert.Nil(us.SetInfo(ctx, UserInfo{
+		Account: "tree",
+	}))
+	assert.Equal("tree", us.MustGetInfo().Account)
+
+	// 从context中读取的为token认证的user session
+	assert.Equal(us, NewUserSession(c))
+}
+
+func TestUserInfoSessionAccount(t *testing.T) {
+	assert := assert.New(t)
+
+	info := UserInfo{
+		Account: "tree",
+	}
+	assert.Equal("tree", info.SessionAccount())
+
+	// 模拟登录时session属于原用户
+	info.Impersonator = &ImpersonatorInfo{
+		Account: "treexie",
+	}
+	assert.Equal("treexie", info.SessionAccount())
+}
@@ -0,0 +1,367 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+
+	"entgo.io/ent/dialect/sql"
+	"github.com/vicanso/forest/ent"
+	"github.com/vicanso/forest/ent/fileblob"
+	"github.com/vicanso/forest/helper"
+	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/hes"
+)
+
+// dedupeStorage 对文件数据去重，同一bucket中数据相同的文件只保存一份数据文件，
+// 文件只保存数据文件的引用，数据文件的引用次数记录在数据库中
+type dedupeStorage struct {
+	FileStorage
+}
+
+// versionKeeper 覆盖文件时保留历史版本的存储
+type versionKeeper interface {
+	keepsVersions() bool
+}
+
+func newDedupeStorage(fileStorage FileStorage) *dedupeStorage {
+	return &dedupeStorage{
+		FileStorage: fileStorage,
+	}
+}
+
+// findBlob 查询数据文件的引用记录并锁定直至事务结束，不存在时返回nil
+func findBlob(ctx context.Context, client *ent.Client, bucket, checksum string) (*ent.FileBlob, error) {
+	query := client.FileBlob.Query().
+		Where(fileblob.Bucket(bucket)).
+		Where(fileblob.Checksum(checksum))
+	query.Modify(func(s *sql.Selector) {
+		s.ForUpdate()
+	})
+	blob, err := query.First(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// 获取数据文件时并发冲突的最大尝试次数
+const maxAcquireBlobAttempts = 5
+
+// acquireBlob 保存数据文件（如果不存在），并增加引用次数，数据文件由putBlob保存。
+// 在事务中更新引用次数，更新时锁定记录直至事务结束，避免与释放数据文件并发
+func (d *dedupeStorage) acquireBlob(ctx context.Context, file File, putBlob func(blob File) error) error {
+	var err error
+	for i := 0; i < maxAcquireBlobAttempts; i++ {
+		err = helper.EntWithTx(ctx, func(client *ent.Client) error {
+			blob, err := findBlob(ctx, client, file.Bucket, file.Checksum)
+			if err != nil {
+				return err
+			}
+			if blob != nil {
+				_, err = client.FileBlob.UpdateOneID(blob.ID).
+					AddRefCount(1).
+					Save(ctx)
+				return err
+			}
+			// 先创建记录再保存数据文件，释放数据文件的事务未结束前，创建记录会等待其完成
+			_, err = client.FileBlob.Create().
+				SetBucket(file.Bucket).
+				SetChecksum(file.Checksum).
+				SetSize(file.Size).
+				SetRefCount(1).
+				Save(ctx)
+			if err != nil {
+				return err
+			}
+			blobFile := file
+			blobFile.Filename = blobPrefix + file.Checksum
+			return putBlob(blobFile)
+		})
+		// 并发保存相同数据时唯一索引冲突，或者记录在更新前已被删除，则重新获取
+		if !ent.IsConstraintError(err) && !ent.IsNotFound(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// releaseBlob 减少数据文件的引用次数，如果已无引用则删除。
+// 删除数据文件在事务提交前完成，并发获取该数据文件时会等待事务结束后重新保存
+func (d *dedupeStorage) releaseBlob(ctx context.Context, bucket, checksum string) error {
+	return helper.EntWithTx(ctx, func(client *ent.Client) error {
+		blob, err := findBlob(ctx, client, bucket, checksum)
+		if err != nil || blob == nil {
+			return err
+		}
+		blob, err = client.FileBlob.UpdateOneID(blob.ID).
+			AddRefCount(-1).
+			Save(ctx)
+		if err != nil {
+			// 记录已被并发删除
+			if ent.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if blob.RefCount > 0 {
+			return nil
+		}
+		err = client.FileBlob.DeleteOneID(blob.ID).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		err = d.FileStorage.Delete(ctx, bucket, blobPrefix+checksum)
+		if err != nil && !IsFileNotFound(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// getBlobChecksum 获取文件引用的数据文件的sha256，如果文件不存在或非引用则返回空
+func (d *dedupeStorage) getBlobChecksum(ctx context.Context, bucket, filename string) (string, error) {
+	f, r, err := d.FileStorage.Open(ctx, bucket, filename)
+	if err != nil {
+		if IsFileNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	_ = r.Close()
+	if getMetadata(f.Metadata, metadataBlob) == "" {
+		return "", nil
+	}
+	return f.Checksum, nil
+}
+
+// keepsVersions 判断存储是否保留历史版本，如果保留则历史版本也引用数据文件
+func (d *dedupeStorage) keepsVersions() bool {
+	keeper, ok := d.FileStorage.(versionKeeper)
+	return ok && keeper.keepsVersions()
+}
+
+// Put saves the data as blob file and puts the file which refers to the blob
+func (d *dedupeStorage) Put(ctx context.Context, file File) error {
+	err := validate.Struct(&file)
+	if err != nil {
+		return err
+	}
+	file.Checksum = sha256Hex(file.Data)
+	file.Size = int64(len(file.Data))
+	// 覆盖已存在的文件时，需要释放原有的数据文件，
+	// 如果保留历史版本则由历史版本继续引用
+	prevChecksum := ""
+	if !d.keepsVersions() {
+		prevChecksum, err = d.getBlobChecksum(ctx, file.Bucket, file.Filename)
+		if err != nil {
+			return err
+		}
+	}
+	err = d.acquireBlob(ctx, file, func(blob File) error {
+		return d.FileStorage.Put(ctx, blob)
+	})
+	if err != nil {
+		return err
+	}
+	err = d.putBlobRef(ctx, file)
+	if err != nil {
+		return err
+	}
+	if prevChecksum != "" {
+		return d.releaseBlob(ctx, file.Bucket, prevChecksum)
+	}
+	return nil
+}
+
+// putBlobRef 保存引用数据文件的文件，保存失败则释放数据文件
+func (d *dedupeStorage) putBlobRef(ctx context.Context, file File) error {
+	metadata := file.Metadata.Clone()
+	if metadata == nil {
+		metadata = make(map[string][]string)
+	}
+	metadata.Set(metadataBlob, blobPrefix+file.Checksum)
+	metadata.Set(metadataBlobSize, strconv.FormatInt(file.Size, 10))
+	file.Metadata = metadata
+	// 数据保存在数据文件中，因此文件本身不保存数据
+	file.Data = []byte{}
+	err := d.FileStorage.Put(ctx, file)
+	if err != nil {
+		_ = d.releaseBlob(ctx, file.Bucket, file.Checksum)
+		return err
+	}
+	return nil
+}
+
+// completeUpload 将直接上传至存储的文件转换为去重后的文件，以流的方式计算sha256，
+// 数据文件在存储内复制生成，文件本身替换为数据文件的引用，数据不重新上传
+func (d *dedupeStorage) completeUpload(ctx context.Context, bucket, filename, contentType string) (*File, error) {
+	copier, ok := d.FileStorage.(fileCopier)
+	if !ok {
+		return nil, hes.NewWithStatusCode("当前文件存储不支持直接上传", http.StatusNotImplemented, errFileCategory)
+	}
+	f, r, err := d.FileStorage.Open(ctx, bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	_ = r.Close()
+	if err != nil {
+		return nil, err
+	}
+	file := File{
+		Bucket:      bucket,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		Creator:     f.Creator,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+	}
+	err = d.acquireBlob(ctx, file, func(blob File) error {
+		return copier.copyFile(ctx, filename, blob)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = d.putBlobRef(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	info, r, err := d.Open(ctx, bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Close()
+	return info, nil
+}
+
+// CompleteUpload 完成直接上传至存储的文件（预签名或分块上传），
+// 计算sha256并去重，同时以指定的文件类型保存，返回保存后的文件信息
+func CompleteUpload(ctx context.Context, bucket, filename, contentType string) (*File, error) {
+	return defaultStorageClient.completeUpload(ctx, bucket, filename, contentType)
+}
+
+// Get gets the file and loads the data from the blob file
+func (d *dedupeStorage) Get(ctx context.Context, bucket, filename string) (*File, error) {
+	f, err := d.FileStorage.Get(ctx, bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+	blobName := getMetadata(f.Metadata, metadataBlob)
+	if blobName == "" {
+		return f, nil
+	}
+	blob, err := d.FileStorage.Get(ctx, bucket, blobName)
+	if err != nil {
+		return nil, err
+	}
+	f.Data = blob.Data
+	f.Size = blob.Size
+	f.ETag = blob.ETag
+	return f, nil
+}
+
+// Open opens the file and returns the reader of the blob file,
+// the checksum is verified when the data is read to the end
+func (d *dedupeStorage) Open(ctx context.Context, bucket, filename string) (*File, io.ReadSeekCloser, error) {
+	f, r, err := d.FileStorage.Open(ctx, bucket, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	blobName := getMetadata(f.Metadata, metadataBlob)
+	if blobName == "" {
+		return f, newChecksumReader(r, f.Checksum), nil
+	}
+	_ = r.Close()
+	blob, r, err := d.FileStorage.Open(ctx, bucket, blobName)
+	if err != nil {
+		return nil, nil, err
+	}
+	f.Size = blob.Size
+	// 使用数据文件的etag，相同数据的etag一致
+	f.ETag = blob.ETag
+	return f, newChecksumReader(r, f.Checksum), nil
+}
+
+// GetVersion gets the version of file and loads the data from the blob file
+func (d *dedupeStorage) GetVersion(ctx context.Context, bucket, filename string, version int) (*File, error) {
+	f, err := d.FileStorage.GetVersion(ctx, bucket, filename, version)
+	if err != nil {
+		return nil, err
+	}
+	blobName := getMetadata(f.Metadata, metadataBlob)
+	if blobName == "" {
+		return f, nil
+	}
+	blob, err := d.FileStorage.Get(ctx, bucket, blobName)
+	if err != nil {
+		return nil, err
+	}
+	f.Data = blob.Data
+	f.Size = blob.Size
+	return f, nil
+}
+
+// getBlobChecksums 获取文件（包括历史版本）引用的所有数据文件
+func (d *dedupeStorage) getBlobChecksums(ctx context.Context, bucket, filename string) ([]string, error) {
+	if !d.keepsVersions() {
+		checksum, err := d.getBlobChecksum(ctx, bucket, filename)
+		if err != nil || checksum == "" {
+			return nil, err
+		}
+		return []string{
+			checksum,
+		}, nil
+	}
+	versions, err := d.FileStorage.ListVersions(ctx, bucket, filename)
+	if err != nil {
+		if IsFileNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	checksums := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if getMetadata(version.Metadata, metadataBlob) != "" {
+			checksums = append(checksums, version.Checksum)
+		}
+	}
+	return checksums, nil
+}
+
+// Delete deletes the file and releases the blob files
+func (d *dedupeStorage) Delete(ctx context.Context, bucket, filename string) error {
+	checksums, err := d.getBlobChecksums(ctx, bucket, filename)
+	if err != nil {
+		return err
+	}
+	err = d.FileStorage.Delete(ctx, bucket, filename)
+	if err != nil {
+		return err
+	}
+	for _, checksum := range checksums {
+		err = d.releaseBlob(ctx, bucket, checksum)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
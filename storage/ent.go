@@ -15,12 +15,21 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 
+	"github.com/iancoleman/strcase"
+	"github.com/samber/lo"
 	"github.com/vicanso/forest/ent"
 	"github.com/vicanso/forest/ent/file"
+	"github.com/vicanso/forest/ent/fileversion"
 	"github.com/vicanso/forest/helper"
 	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/hes"
 )
 
 type entStorage struct {
@@ -34,65 +43,343 @@ func mustNewEntStorage() FileStorage {
 }
 
 func convertToFile(data *ent.File) *File {
-	return &File{
+	f := &File{
+		ID:          data.ID,
 		Bucket:      data.Bucket,
 		Filename:    data.Filename,
 		ContentType: data.ContentType,
 		Size:        data.Size,
-		Metadata:    *data.Metadata,
 		Creator:     data.Creator,
 		Data:        data.Data,
+		CreatedAt:   data.CreatedAt,
+		Checksum:    data.Checksum,
+		Version:     data.Version,
+		// 以长度与更新时间生成弱etag
+		ETag: fmt.Sprintf(`W/"%x-%x"`, data.Size, data.UpdatedAt.UnixNano()),
 	}
+	// 如果查询时未选择metadata，则为nil
+	if data.Metadata != nil {
+		f.Metadata = *data.Metadata
+	}
+	return f
 }
 
-// Get gets file from ent(mysql or postgres)
-func (e *entStorage) Get(ctx context.Context, bucket, filename string) (*File, error) {
+// where 将筛选参数转换为对应的where条件
+func (e *entStorage) where(query *ent.FileQuery, params FileFilterParams) *ent.FileQuery {
+	// 数据文件仅内部使用
+	query.Where(file.Not(file.FilenameHasPrefix(blobPrefix)))
+	if params.Bucket != "" {
+		query.Where(file.Bucket(params.Bucket))
+	}
+	if params.Prefix != "" {
+		query.Where(file.FilenameHasPrefix(params.Prefix))
+	}
+	if params.Creator != "" {
+		query.Where(file.Creator(params.Creator))
+	}
+	if params.ContentType != "" {
+		query.Where(file.ContentType(params.ContentType))
+	}
+	if !params.Begin.IsZero() {
+		query.Where(file.CreatedAtGTE(params.Begin))
+	}
+	if !params.End.IsZero() {
+		query.Where(file.CreatedAtLTE(params.End))
+	}
+	return query
+}
+
+// getSelectFields 获取查询的字段，默认不查询文件数据
+func (e *entStorage) getSelectFields(params FileFilterParams) []string {
+	if params.Fields == "" {
+		return lo.Without(file.Columns, file.FieldData)
+	}
+	arr := strings.Split(params.Fields, ",")
+	fields := make([]string, 0, len(arr))
+	for _, item := range arr {
+		name := strcase.ToSnake(item)
+		if file.ValidColumn(name) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// first 根据bucket与filename查询文件
+func (e *entStorage) first(ctx context.Context, bucket, filename string) (*ent.File, error) {
 	result, err := e.client.File.Query().
 		Where(file.Bucket(bucket)).
 		Where(file.Filename(filename)).
 		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = newFileNotFoundError()
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get gets file from ent(mysql or postgres)
+func (e *entStorage) Get(ctx context.Context, bucket, filename string) (*File, error) {
+	result, err := e.first(ctx, bucket, filename)
 	if err != nil {
 		return nil, err
 	}
-	return convertToFile(result), nil
+	f := convertToFile(result)
+	err = verifyChecksum(f)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// nopSeekCloser 为bytes.Reader添加空的close函数
+type nopSeekCloser struct {
+	*bytes.Reader
 }
 
-// Put puts file to ent(mysql or postgres)
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// Open opens the file from ent(mysql or postgres), the data is loaded into memory
+func (e *entStorage) Open(ctx context.Context, bucket, filename string) (*File, io.ReadSeekCloser, error) {
+	f, err := e.Get(ctx, bucket, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := nopSeekCloser{
+		Reader: bytes.NewReader(f.Data),
+	}
+	f.Data = nil
+	return f, r, nil
+}
+
+// Delete deletes file and all its versions from ent(mysql or postgres)
+func (e *entStorage) Delete(ctx context.Context, bucket, filename string) error {
+	result, err := e.first(ctx, bucket, filename)
+	if err != nil {
+		return err
+	}
+	ids, err := e.client.FileVersion.Query().
+		Where(fileversion.Bucket(bucket)).
+		Where(fileversion.Filename(filename)).
+		IDs(ctx)
+	if err != nil {
+		return err
+	}
+	// 不允许批量删除，因此逐个删除历史版本
+	for _, id := range ids {
+		err = e.client.FileVersion.DeleteOneID(id).Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return e.client.File.DeleteOneID(result.ID).Exec(ctx)
+}
+
+// Put puts file to ent(mysql or postgres), if the file exists,
+// the current data is saved as a version and then be replaced.
 func (e *entStorage) Put(ctx context.Context, data File) error {
 	err := validate.Struct(&data)
 	if err != nil {
 		return err
 	}
-	// 如果指定了id，则是更新
-	if data.ID != 0 {
-		_, err = e.client.File.UpdateOneID(data.ID).
+	setChecksum(&data)
+	tx, err := e.client.Tx(ctx)
+	if err != nil {
+		return err
+	}
+	err = e.upsert(ctx, tx.Client(), data)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsert 根据bucket与filename新增或更新文件，更新前保存当前版本
+func (e *entStorage) upsert(ctx context.Context, client *ent.Client, data File) error {
+	current, err := client.File.Query().
+		Where(file.Bucket(data.Bucket)).
+		Where(file.Filename(data.Filename)).
+		First(ctx)
+	if err != nil && !ent.IsNotFound(err) {
+		return err
+	}
+	if current == nil {
+		_, err = client.File.Create().
+			SetBucket(data.Bucket).
+			SetFilename(data.Filename).
 			SetContentType(data.ContentType).
 			SetSize(data.Size).
 			SetMetadata(&data.Metadata).
+			SetCreator(data.Creator).
 			SetData(data.Data).
+			SetChecksum(data.Checksum).
 			Save(ctx)
-		if err != nil {
-			return err
-		}
+		return err
 	}
-	_, err = e.client.File.Create().
-		SetBucket(data.Bucket).
-		SetFilename(data.Filename).
+	// 同时覆盖时版本号的唯一索引冲突，仅一个成功
+	_, err = client.FileVersion.Create().
+		SetBucket(current.Bucket).
+		SetFilename(current.Filename).
+		SetVersion(current.Version).
+		SetContentType(current.ContentType).
+		SetSize(current.Size).
+		SetMetadata(current.Metadata).
+		SetCreator(current.Creator).
+		SetData(current.Data).
+		SetChecksum(current.Checksum).
+		SetVersionCreatedAt(current.UpdatedAt).
+		SetReplacedBy(data.Creator).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.File.UpdateOneID(current.ID).
 		SetContentType(data.ContentType).
 		SetSize(data.Size).
 		SetMetadata(&data.Metadata).
 		SetCreator(data.Creator).
 		SetData(data.Data).
+		SetChecksum(data.Checksum).
+		AddVersion(1).
 		Save(ctx)
 	return err
 }
 
+// getHeader 获取header，如果为nil则返回空的header
+func getHeader(header *http.Header) http.Header {
+	if header == nil {
+		return http.Header{}
+	}
+	return *header
+}
+
+// keepsVersions 覆盖文件时保留历史版本
+func (e *entStorage) keepsVersions() bool {
+	return true
+}
+
+// convertVersionToFile 将历史版本转换为file
+func convertVersionToFile(data *ent.FileVersion) *File {
+	f := &File{
+		Bucket:      data.Bucket,
+		Filename:    data.Filename,
+		ContentType: data.ContentType,
+		Size:        data.Size,
+		Creator:     data.Creator,
+		Data:        data.Data,
+		CreatedAt:   data.VersionCreatedAt,
+		Checksum:    data.Checksum,
+		Version:     data.Version,
+		ETag:        fmt.Sprintf(`W/"%x-%x"`, data.Size, data.VersionCreatedAt.UnixNano()),
+		Metadata:    getHeader(data.Metadata),
+	}
+	return f
+}
+
+// GetVersion gets the version of file from ent(mysql or postgres)
+func (e *entStorage) GetVersion(ctx context.Context, bucket, filename string, version int) (*File, error) {
+	current, err := e.Get(ctx, bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+	if current.Version == version {
+		return current, nil
+	}
+	result, err := e.client.FileVersion.Query().
+		Where(fileversion.Bucket(bucket)).
+		Where(fileversion.Filename(filename)).
+		Where(fileversion.Version(version)).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = hes.NewWithStatusCode("文件版本不存在", http.StatusNotFound, errFileCategory)
+		}
+		return nil, err
+	}
+	f := convertVersionToFile(result)
+	err = verifyChecksum(f)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ListVersions lists the versions of file from ent(mysql or postgres), the data isn't loaded
+func (e *entStorage) ListVersions(ctx context.Context, bucket, filename string) ([]*FileVersion, error) {
+	current, err := e.client.File.Query().
+		Where(file.Bucket(bucket)).
+		Where(file.Filename(filename)).
+		Select(lo.Without(file.Columns, file.FieldData)...).
+		First(ctx)
+	if err != nil {
+		if ent.IsNotFound(err) {
+			err = newFileNotFoundError()
+		}
+		return nil, err
+	}
+	result, err := e.client.FileVersion.Query().
+		Where(fileversion.Bucket(bucket)).
+		Where(fileversion.Filename(filename)).
+		Order(ent.Desc(fileversion.FieldVersion)).
+		Select(lo.Without(fileversion.Columns, fileversion.FieldData)...).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]*FileVersion, 0, len(result)+1)
+	versions = append(versions, &FileVersion{
+		Version:     current.Version,
+		ContentType: current.ContentType,
+		Size:        current.Size,
+		Metadata:    getHeader(current.Metadata),
+		Creator:     current.Creator,
+		Checksum:    current.Checksum,
+		CreatedAt:   current.UpdatedAt,
+	})
+	for _, item := range result {
+		versions = append(versions, &FileVersion{
+			Version:     item.Version,
+			ContentType: item.ContentType,
+			Size:        item.Size,
+			Metadata:    getHeader(item.Metadata),
+			Creator:     item.Creator,
+			Checksum:    item.Checksum,
+			CreatedAt:   item.VersionCreatedAt,
+			ReplacedBy:  item.ReplacedBy,
+		})
+	}
+	return versions, nil
+}
+
 // Query gets the files from ent(mysql or postgres)
-func (e *entStorage) Query(ctx context.Context, param FileFilterParams) ([]*File, error) {
-	return nil, nil
+func (e *entStorage) Query(ctx context.Context, params FileFilterParams) ([]*File, error) {
+	query := e.client.File.Query().
+		Limit(params.getLimit()).
+		Offset(params.Offset).
+		Order(ent.Desc(file.FieldCreatedAt))
+	query = e.where(query, params)
+	result, err := query.Select(e.getSelectFields(params)...).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*File, len(result))
+	for index, item := range result {
+		files[index] = convertToFile(item)
+	}
+	return files, nil
 }
 
 // Count counts the files from ent(mysql or postgres)
 func (e *entStorage) Count(ctx context.Context, params FileFilterParams) (int64, error) {
-	return -1, nil
+	query := e.where(e.client.File.Query(), params)
+	count, err := query.Count(ctx)
+	if err != nil {
+		return -1, err
+	}
+	return int64(count), nil
 }
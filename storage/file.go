@@ -16,11 +16,34 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vicanso/forest/config"
+	"github.com/vicanso/hes"
 )
 
 const creatorField = "creator"
 
+const (
+	// 保存数据sha256的metadata
+	metadataChecksum = "Checksum"
+	// 去重后文件对应的数据文件的metadata
+	metadataBlob = "Blob"
+	// 去重后文件的大小，minio中文件本身的大小为0，因此需要记录
+	metadataBlobSize = "Blob-Size"
+	// 去重后的数据文件名前缀，后接sha256
+	blobPrefix = "sha256-"
+)
+
+const errFileCategory = "file"
+
 // 文件
 type File struct {
 	// 文件id
@@ -37,7 +60,30 @@ type File struct {
 	// 创建者
 	Creator string `json:"creator" validate:"required"`
 	// 数据
-	Data []byte `json:"data" validate:"required"`
+	Data []byte `json:"data,omitempty" validate:"required"`
+	// 创建时间
+	CreatedAt time.Time `json:"createdAt"`
+	// 文件的etag
+	ETag string `json:"etag,omitempty"`
+	// 文件数据的sha256
+	Checksum string `json:"checksum,omitempty"`
+	// 版本号，仅支持版本的存储有此值
+	Version int `json:"version,omitempty"`
+}
+
+// FileVersion 文件的版本信息（不包括数据）
+type FileVersion struct {
+	Version     int         `json:"version"`
+	ContentType string      `json:"contentType"`
+	Size        int64       `json:"size"`
+	Metadata    http.Header `json:"metadata"`
+	// 该版本的创建者
+	Creator  string `json:"creator"`
+	Checksum string `json:"checksum,omitempty"`
+	// 该版本的创建时间
+	CreatedAt time.Time `json:"createdAt"`
+	// 覆盖该版本的用户，当前版本为空
+	ReplacedBy string `json:"replacedBy,omitempty"`
 }
 type FileFilterParams struct {
 	// 筛选的字段
@@ -46,22 +92,288 @@ type FileFilterParams struct {
 	Limit int `json:"limit"`
 	// 偏移量
 	Offset int `json:"offset"`
+	// 文件所在bucket
+	Bucket string `json:"bucket"`
+	// 文件名前缀
+	Prefix string `json:"prefix"`
+	// 创建者
+	Creator string `json:"creator"`
+	// 文件类型
+	ContentType string `json:"contentType"`
+	// 创建时间的开始时间
+	Begin time.Time `json:"begin"`
+	// 创建时间的结束时间
+	End time.Time `json:"end"`
+}
+
+// PresignedURL 预签名的地址
+type PresignedURL struct {
+	// 请求地址
+	URL string `json:"url"`
+	// 请求方法
+	Method string `json:"method"`
+	// 请求时必须设置的请求头
+	Headers map[string]string `json:"headers,omitempty"`
+	// 过期时间
+	ExpiredAt time.Time `json:"expiredAt"`
+}
+
+// FilePresigner 生成预签名地址，客户端可直接通过该地址上传或下载文件
+type FilePresigner interface {
+	// PresignedPut 生成上传地址，仅使用文件的bucket、filename、contentType与creator
+	PresignedPut(ctx context.Context, file File, ttl time.Duration) (*PresignedURL, error)
+	PresignedGet(ctx context.Context, bucket, filename string, ttl time.Duration) (*PresignedURL, error)
+}
+
+// FilePart 分块上传的分块信息
+type FilePart struct {
+	// 分块序号，从1开始
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// FileMultipartUploader 分块上传，所有分块上传完成后合并为一个文件
+type FileMultipartUploader interface {
+	// NewMultipartUpload 创建分块上传，仅使用文件的bucket、filename、contentType与creator
+	NewMultipartUpload(ctx context.Context, file File) (string, error)
+	PutPart(ctx context.Context, bucket, filename, uploadID string, number int, r io.Reader, size int64) (*FilePart, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, filename, uploadID string, parts []FilePart) error
+	AbortMultipartUpload(ctx context.Context, bucket, filename, uploadID string) error
+	// AbortExpiredMultipartUploads 终止在指定时间前创建且未完成的分块上传
+	AbortExpiredMultipartUploads(ctx context.Context, before time.Time) (int, error)
+}
+
+// fileCopier 在存储内复制文件，数据不经过应用，
+// 用于将直接上传至存储的文件转换为去重后的数据文件
+type fileCopier interface {
+	// copyFile 复制bucket中的src为file指定的文件，使用file的文件信息（不包括数据）
+	copyFile(ctx context.Context, src string, file File) error
 }
 
 type FileStorage interface {
 	Get(ctx context.Context, bucket, filename string) (*File, error)
+	// Open 打开文件，返回的文件信息不包括数据，数据需要从reader中读取
+	Open(ctx context.Context, bucket, filename string) (*File, io.ReadSeekCloser, error)
+	// Put 保存文件，如果文件已存在则覆盖，支持版本的存储会保留覆盖前的版本
 	Put(ctx context.Context, file File) error
+	// Delete 删除文件（包括所有历史版本）
+	Delete(ctx context.Context, bucket, filename string) error
+	// GetVersion 获取文件指定版本的数据
+	GetVersion(ctx context.Context, bucket, filename string, version int) (*File, error)
+	// ListVersions 获取文件的所有版本，按版本号倒序，第一个为当前版本
+	ListVersions(ctx context.Context, bucket, filename string) ([]*FileVersion, error)
 	Query(ctx context.Context, params FileFilterParams) ([]*File, error)
 	Count(ctx context.Context, params FileFilterParams) (int64, error)
 }
 
-var minioStorageClient = mustNewMinioStorage()
+// newFileNotFoundError 文件不存在的出错
+func newFileNotFoundError() error {
+	return hes.NewWithStatusCode("文件不存在", http.StatusNotFound, errFileCategory)
+}
+
+// newFileVersionNotSupportedError 不支持文件版本的出错
+func newFileVersionNotSupportedError() error {
+	return hes.NewWithStatusCode("当前文件存储不支持文件版本", http.StatusNotImplemented, errFileCategory)
+}
+
+// sha256Hex 计算数据的sha256
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// getMetadata 获取metadata的值，minio返回的metadata包括X-Amz-Meta-前缀
+func getMetadata(metadata http.Header, key string) string {
+	value := metadata.Get(key)
+	if value == "" {
+		value = metadata.Get("X-Amz-Meta-" + key)
+	}
+	return value
+}
+
+// isBlobFile 判断是否去重后的数据文件
+func isBlobFile(filename string) bool {
+	return strings.HasPrefix(filename, blobPrefix)
+}
+
+// setChecksum 计算并设置文件数据的sha256（如果未设置），同时保存至metadata
+func setChecksum(file *File) {
+	if file.Checksum == "" {
+		file.Checksum = sha256Hex(file.Data)
+	}
+	if file.Metadata == nil {
+		file.Metadata = make(http.Header)
+	}
+	file.Metadata.Set(metadataChecksum, file.Checksum)
+}
+
+// newChecksumError 文件校验失败的出错
+func newChecksumError() error {
+	return hes.NewWithStatusCode("文件校验失败，数据可能已损坏", http.StatusInternalServerError, errFileCategory)
+}
+
+// checksumReader 读取数据时计算sha256，读取完成时校验，
+// 如果非从头开始读取则无法校验
+type checksumReader struct {
+	io.ReadSeekCloser
+	checksum string
+	hash     hash.Hash
+}
+
+// newChecksumReader 创建校验sha256的reader，如果未记录sha256则不校验
+func newChecksumReader(r io.ReadSeekCloser, checksum string) io.ReadSeekCloser {
+	if checksum == "" {
+		return r
+	}
+	return &checksumReader{
+		ReadSeekCloser: r,
+		checksum:       checksum,
+		hash:           sha256.New(),
+	}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	if r.hash == nil {
+		return n, err
+	}
+	_, _ = r.hash.Write(p[:n])
+	if err == io.EOF &&
+		hex.EncodeToString(r.hash.Sum(nil)) != r.checksum {
+		return n, newChecksumError()
+	}
+	return n, err
+}
+
+func (r *checksumReader) Seek(offset int64, whence int) (int64, error) {
+	n, err := r.ReadSeekCloser.Seek(offset, whence)
+	// 重新从头读取时重新计算，否则不再校验
+	if err == nil && n == 0 {
+		r.hash = sha256.New()
+	} else {
+		r.hash = nil
+	}
+	return n, err
+}
+
+// verifyChecksum 校验文件数据的sha256，如果未记录则不校验。
+// 去重后的文件不包括数据，因此也不校验
+func verifyChecksum(file *File) error {
+	if file.Checksum == "" ||
+		getMetadata(file.Metadata, metadataBlob) != "" {
+		return nil
+	}
+	if sha256Hex(file.Data) != file.Checksum {
+		return newChecksumError()
+	}
+	return nil
+}
+
+// IsFileNotFound 判断是否文件不存在的出错
+func IsFileNotFound(err error) bool {
+	he, ok := err.(*hes.Error)
+	return ok && he.StatusCode == http.StatusNotFound && he.Category == errFileCategory
+}
+
+// getLimit 获取limit的值，默认为10
+func (params *FileFilterParams) getLimit() int {
+	if params.Limit <= 0 {
+		return 10
+	}
+	return params.Limit
+}
+
+// match 判断文件是否符合筛选条件
+func (params *FileFilterParams) match(file *File) bool {
+	// 数据文件仅内部使用
+	if isBlobFile(file.Filename) {
+		return false
+	}
+	if params.Bucket != "" && file.Bucket != params.Bucket {
+		return false
+	}
+	if params.Prefix != "" && !strings.HasPrefix(file.Filename, params.Prefix) {
+		return false
+	}
+	if params.Creator != "" && file.Creator != params.Creator {
+		return false
+	}
+	if params.ContentType != "" && file.ContentType != params.ContentType {
+		return false
+	}
+	if !params.Begin.IsZero() && file.CreatedAt.Before(params.Begin) {
+		return false
+	}
+	if !params.End.IsZero() && file.CreatedAt.After(params.End) {
+		return false
+	}
+	return true
+}
+
+const (
+	// DriverLocal 本地文件存储
+	DriverLocal = "local"
+	// DriverMinio minio存储
+	DriverMinio = "minio"
+	// DriverEnt 数据库存储
+	DriverEnt = "ent"
+)
+
+var (
+	// minio仅在使用时才初始化，避免未配置时panic
+	newMinioOnce       = &sync.Once{}
+	minioStorageClient *minioStorage
+)
+
 var entStorageClient = mustNewEntStorage()
+var driverStorageClient = mustNewDriverStorage()
 
-func Minio() FileStorage {
+// 默认的文件存储对文件数据去重
+var defaultStorageClient = newDedupeStorage(driverStorageClient)
+
+// mustNewDriverStorage 根据配置的驱动创建文件存储
+func mustNewDriverStorage() FileStorage {
+	storageConfig := config.MustGetStorageConfig()
+	switch storageConfig.Driver {
+	case DriverLocal:
+		return mustNewLocalStorage(storageConfig.Path)
+	case DriverEnt:
+		return entStorageClient
+	default:
+		return getMinioStorage()
+	}
+}
+
+// getMinioStorage 获取minio存储，首次调用时初始化
+func getMinioStorage() *minioStorage {
+	newMinioOnce.Do(func() {
+		minioStorageClient = mustNewMinioStorage()
+	})
 	return minioStorageClient
 }
 
+// Default 获取根据配置storage.driver选择的文件存储，文件数据会去重保存
+func Default() FileStorage {
+	return defaultStorageClient
+}
+
+func Minio() FileStorage {
+	return getMinioStorage()
+}
+
 func Ent() FileStorage {
 	return entStorageClient
 }
+
+// MultipartUploader 获取默认文件存储的分块上传，如果不支持则返回nil
+func MultipartUploader() FileMultipartUploader {
+	uploader, _ := driverStorageClient.(FileMultipartUploader)
+	return uploader
+}
+
+// Presigner 获取默认文件存储的预签名地址生成，如果不支持则返回nil
+func Presigner() FilePresigner {
+	presigner, _ := driverStorageClient.(FilePresigner)
+	return presigner
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileFilterParams(t *testing.T) {
+	assert := assert.New(t)
+
+	params := FileFilterParams{}
+	assert.Equal(10, params.getLimit())
+	params.Limit = 20
+	assert.Equal(20, params.getLimit())
+
+	now := time.Now()
+	file := &File{
+		Bucket:      "files",
+		Creator:     "treexie",
+		ContentType: "image/png",
+		CreatedAt:   now,
+	}
+	assert.True(params.match(file))
+
+	params.Bucket = "files"
+	params.Creator = "treexie"
+	params.ContentType = "image/png"
+	params.Begin = now.Add(-time.Minute)
+	params.End = now.Add(time.Minute)
+	assert.True(params.match(file))
+
+	params.Creator = "tree"
+	assert.False(params.match(file))
+
+	params.Creator = ""
+	params.End = now.Add(-time.Second)
+	assert.False(params.match(file))
+}
+
+func TestGetUserMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("treexie", getUserMetadata(map[string]string{
+		"X-Amz-Meta-Creator": "treexie",
+	}, creatorField))
+	assert.Equal("treexie", getUserMetadata(map[string]string{
+		"Creator": "treexie",
+	}, creatorField))
+	assert.Empty(getUserMetadata(nil, creatorField))
+}
+
+func TestChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	file := File{
+		Data: []byte("abc"),
+	}
+	setChecksum(&file)
+	assert.Equal("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", file.Checksum)
+	assert.Equal(file.Checksum, getMetadata(file.Metadata, metadataChecksum))
+	assert.Nil(verifyChecksum(&file))
+
+	file.Data = []byte("abd")
+	assert.NotNil(verifyChecksum(&file))
+
+	// 去重后的文件不校验
+	file.Metadata.Set(metadataBlob, blobPrefix+file.Checksum)
+	assert.Nil(verifyChecksum(&file))
+
+	assert.Equal("1", getMetadata(http.Header{
+		"X-Amz-Meta-Blob-Size": []string{"1"},
+	}, metadataBlobSize))
+
+	params := FileFilterParams{}
+	assert.False(params.match(&File{
+		Filename: blobPrefix + file.Checksum,
+	}))
+
+	params.Prefix = "abc.png@"
+	assert.True(params.match(&File{
+		Filename: "abc.png@200x0_contain_q80.png",
+	}))
+	assert.False(params.match(&File{
+		Filename: "abc.png",
+	}))
+}
+
+func TestChecksumReader(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte("abc")
+	newReader := func(checksum string) io.ReadSeekCloser {
+		return newChecksumReader(nopSeekCloser{
+			Reader: bytes.NewReader(data),
+		}, checksum)
+	}
+
+	buf, err := io.ReadAll(newReader(sha256Hex(data)))
+	assert.Nil(err)
+	assert.Equal(data, buf)
+
+	_, err = io.ReadAll(newReader(sha256Hex([]byte("abd"))))
+	assert.Equal(newChecksumError(), err)
+
+	// 未记录sha256则不校验
+	_, err = io.ReadAll(newReader(""))
+	assert.Nil(err)
+
+	// 非从头读取则不校验
+	r := newReader(sha256Hex([]byte("abd")))
+	_, err = r.Seek(1, io.SeekStart)
+	assert.Nil(err)
+	buf, err = io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal([]byte("bc"), buf)
+}
@@ -0,0 +1,466 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/hes"
+)
+
+const errLocalCategory = "local"
+
+// 元数据文件的后缀
+const localMetaExt = ".meta.json"
+
+// 分块上传的临时目录
+const localMultipartDir = ".multipart"
+
+type localStorage struct {
+	// 保存文件的根目录
+	root string
+}
+
+func mustNewLocalStorage(root string) *localStorage {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		panic(err)
+	}
+	return &localStorage{
+		root: root,
+	}
+}
+
+// isInvalidName 判断bucket或文件名是否非法，避免访问根目录之外的文件
+func isInvalidName(name string) bool {
+	return name == "" ||
+		// 以.开头的为内部使用的目录，如分块上传
+		strings.HasPrefix(name, ".") ||
+		strings.ContainsAny(name, `/\`) ||
+		strings.HasSuffix(name, localMetaExt)
+}
+
+// getPath 获取文件保存的路径，根据文件名的md5分为两级目录，
+// 避免同一目录下文件过多
+func (l *localStorage) getPath(bucket, filename string) (string, error) {
+	if isInvalidName(bucket) || isInvalidName(filename) {
+		return "", hes.New("bucket or filename is invalid", errLocalCategory)
+	}
+	hash := md5.Sum([]byte(filename))
+	shard := hex.EncodeToString(hash[:2])
+	return filepath.Join(l.root, bucket, shard[:2], shard[2:], filename), nil
+}
+
+// readMeta 读取文件的元数据
+func (l *localStorage) readMeta(file string) (*File, error) {
+	buf, err := os.ReadFile(file + localMetaExt)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = newFileNotFoundError()
+		}
+		return nil, err
+	}
+	f := &File{}
+	err = json.Unmarshal(buf, f)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeFile 先写入临时文件再重命名，避免写入过程中读取到不完整的数据
+func writeFile(file string, data []byte) error {
+	tmp := file + ".tmp"
+	err := os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// list 遍历bucket下的所有文件的元数据，fn返回false则停止遍历
+func (l *localStorage) list(params FileFilterParams, fn func(file *File) bool) error {
+	if isInvalidName(params.Bucket) {
+		return hes.New("bucket can not be empty", errLocalCategory)
+	}
+	files := make([]*File, 0)
+	err := filepath.WalkDir(filepath.Join(l.root, params.Bucket), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// bucket目录不存在则为无文件
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, localMetaExt) {
+			return nil
+		}
+		file, err := l.readMeta(strings.TrimSuffix(path, localMetaExt))
+		if err != nil {
+			return err
+		}
+		if params.match(file) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 与ent一致，按创建时间倒序
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+	for _, file := range files {
+		if !fn(file) {
+			break
+		}
+	}
+	return nil
+}
+
+// Get gets file from local filesystem
+func (l *localStorage) Get(ctx context.Context, bucket, filename string) (*File, error) {
+	f, r, err := l.Open(ctx, bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f.Data = data
+	err = verifyChecksum(f)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Open opens the file from local filesystem, the data of file should be read from reader
+func (l *localStorage) Open(ctx context.Context, bucket, filename string) (*File, io.ReadSeekCloser, error) {
+	file, err := l.getPath(bucket, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := l.readMeta(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = newFileNotFoundError()
+		}
+		return nil, nil, err
+	}
+	return f, r, nil
+}
+
+// save 保存文件数据与元数据，数据从reader中读取
+func (l *localStorage) save(data File, r io.Reader) error {
+	file, err := l.getPath(data.Bucket, data.Filename)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	// 先写入临时文件再重命名，避免写入过程中读取到不完整的数据
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	hash := md5.New()
+	checksumHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash, checksumHash), r)
+	_ = f.Close()
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, file)
+	if err != nil {
+		return err
+	}
+	meta := data
+	meta.ID = 0
+	meta.Data = nil
+	// 去重后的文件本身无数据，使用指定的大小
+	if getMetadata(meta.Metadata, metadataBlob) == "" {
+		meta.Size = size
+	}
+	meta.CreatedAt = time.Now()
+	meta.ETag = hex.EncodeToString(hash.Sum(nil))
+	// 如果已指定（如去重后的文件）则不使用计算的值
+	if meta.Checksum == "" {
+		meta.Checksum = hex.EncodeToString(checksumHash.Sum(nil))
+	}
+	setChecksum(&meta)
+	buf, err := json.Marshal(&meta)
+	if err != nil {
+		return err
+	}
+	return writeFile(file+localMetaExt, buf)
+}
+
+// Put puts file to local filesystem, the metadata is saved as a sidecar json file
+func (l *localStorage) Put(ctx context.Context, data File) error {
+	err := validate.Struct(&data)
+	if err != nil {
+		return err
+	}
+	return l.save(data, bytes.NewReader(data.Data))
+}
+
+// copyFile copies the data of src file to the file, the file info is replaced
+func (l *localStorage) copyFile(ctx context.Context, src string, file File) error {
+	_, r, err := l.Open(ctx, file.Bucket, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return l.save(file, r)
+}
+
+// Delete deletes file from local filesystem
+func (l *localStorage) Delete(ctx context.Context, bucket, filename string) error {
+	file, err := l.getPath(bucket, filename)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(file + localMetaExt)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = newFileNotFoundError()
+		}
+		return err
+	}
+	err = os.Remove(file)
+	// 元数据已删除，数据文件不存在则忽略
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Query gets the files from local filesystem, the bucket of params is required.
+// The data of file isn't loaded, so the fields of params is ignored.
+func (l *localStorage) Query(ctx context.Context, params FileFilterParams) ([]*File, error) {
+	limit := params.getLimit()
+	files := make([]*File, 0, limit)
+	index := 0
+	err := l.list(params, func(file *File) bool {
+		index++
+		if index <= params.Offset {
+			return true
+		}
+		files = append(files, file)
+		return len(files) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Count counts the files from local filesystem, the bucket of params is required
+func (l *localStorage) Count(ctx context.Context, params FileFilterParams) (int64, error) {
+	var count int64
+	err := l.list(params, func(_ *File) bool {
+		count++
+		return true
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+// getMultipartPath 获取分块上传的临时目录
+func (l *localStorage) getMultipartPath(uploadID string) (string, error) {
+	if isInvalidName(uploadID) {
+		return "", hes.New("upload id is invalid", errLocalCategory)
+	}
+	return filepath.Join(l.root, localMultipartDir, uploadID), nil
+}
+
+// openMultipartUpload 获取分块上传的目录与文件信息，并校验bucket与filename是否一致
+func (l *localStorage) openMultipartUpload(bucket, filename, uploadID string) (string, *File, error) {
+	dir, err := l.getMultipartPath(uploadID)
+	if err != nil {
+		return "", nil, err
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, "file.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = hes.New("multipart upload is not found", errLocalCategory)
+		}
+		return "", nil, err
+	}
+	file := &File{}
+	err = json.Unmarshal(buf, file)
+	if err != nil {
+		return "", nil, err
+	}
+	if file.Bucket != bucket || file.Filename != filename {
+		return "", nil, hes.New("multipart upload is not match", errLocalCategory)
+	}
+	return dir, file, nil
+}
+
+// NewMultipartUpload creates a multipart upload of local filesystem,
+// the parts are saved in the temp directory until complete
+func (l *localStorage) NewMultipartUpload(ctx context.Context, file File) (string, error) {
+	_, err := l.getPath(file.Bucket, file.Filename)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(buf)
+	dir, err := l.getMultipartPath(uploadID)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(&file)
+	if err != nil {
+		return "", err
+	}
+	err = writeFile(filepath.Join(dir, "file.json"), data)
+	if err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+// PutPart saves the part of multipart upload to local filesystem
+func (l *localStorage) PutPart(ctx context.Context, bucket, filename, uploadID string, number int, r io.Reader, size int64) (*FilePart, error) {
+	dir, _, err := l.openMultipartUpload(bucket, filename, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, hes.New("the size of part is not match", errLocalCategory)
+	}
+	err = writeFile(filepath.Join(dir, strconv.Itoa(number)), data)
+	if err != nil {
+		return nil, err
+	}
+	hash := md5.Sum(data)
+	return &FilePart{
+		Number: number,
+		ETag:   hex.EncodeToString(hash[:]),
+		Size:   size,
+	}, nil
+}
+
+// CompleteMultipartUpload merges the parts to the file and removes the temp directory
+func (l *localStorage) CompleteMultipartUpload(ctx context.Context, bucket, filename, uploadID string, parts []FilePart) error {
+	dir, file, err := l.openMultipartUpload(bucket, filename, uploadID)
+	if err != nil {
+		return err
+	}
+	readers := make([]io.Reader, len(parts))
+	for index, part := range parts {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(part.Number)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers[index] = f
+	}
+	err = l.save(*file, io.MultiReader(readers...))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipartUpload removes the temp directory of multipart upload
+func (l *localStorage) AbortMultipartUpload(ctx context.Context, bucket, filename, uploadID string) error {
+	dir, _, err := l.openMultipartUpload(bucket, filename, uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// AbortExpiredMultipartUploads removes the temp directories of multipart upload which are created before the time
+func (l *localStorage) AbortExpiredMultipartUploads(ctx context.Context, before time.Time) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(l.root, localMultipartDir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return count, err
+		}
+		if info.ModTime().After(before) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(l.root, localMultipartDir, entry.Name()))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// GetVersion isn't supported by local filesystem
+func (l *localStorage) GetVersion(ctx context.Context, bucket, filename string, version int) (*File, error) {
+	return nil, newFileVersionNotSupportedError()
+}
+
+// ListVersions isn't supported by local filesystem
+func (l *localStorage) ListVersions(ctx context.Context, bucket, filename string) ([]*FileVersion, error) {
+	return nil, newFileVersionNotSupportedError()
+}
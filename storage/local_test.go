@@ -0,0 +1,166 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/hes"
+)
+
+func TestLocalStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	l := mustNewLocalStorage(t.TempDir())
+
+	_, err := l.getPath("test", "../a.txt")
+	assert.NotNil(err)
+	_, err = l.getPath("..", "a.txt")
+	assert.NotNil(err)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err = l.Put(ctx, File{
+			Bucket:      "test",
+			Filename:    name,
+			ContentType: "text/plain",
+			Size:        3,
+			Creator:     "tree",
+			Data:        []byte("abc"),
+		})
+		assert.Nil(err)
+	}
+
+	f, err := l.Get(ctx, "test", "a.txt")
+	assert.Nil(err)
+	assert.Equal("text/plain", f.ContentType)
+	assert.Equal("tree", f.Creator)
+	assert.Equal([]byte("abc"), f.Data)
+	assert.NotEmpty(f.ETag)
+
+	assert.Equal(sha256Hex([]byte("abc")), f.Checksum)
+
+	// 数据损坏时校验失败
+	file, _ := l.getPath("test", "a.txt")
+	err = os.WriteFile(file, []byte("abd"), 0644)
+	assert.Nil(err)
+	_, err = l.Get(ctx, "test", "a.txt")
+	assert.NotNil(err)
+
+	f, r, err := l.Open(ctx, "test", "b.txt")
+	assert.Nil(err)
+	assert.Empty(f.Data)
+	buf, _ := io.ReadAll(r)
+	_ = r.Close()
+	assert.Equal([]byte("abc"), buf)
+
+	// 复制时使用指定的文件信息
+	err = l.copyFile(ctx, "b.txt", File{
+		Bucket:      "test",
+		Filename:    "c.txt",
+		ContentType: "image/png",
+		Creator:     "treexie",
+	})
+	assert.Nil(err)
+	f, err = l.Get(ctx, "test", "c.txt")
+	assert.Nil(err)
+	assert.Equal("image/png", f.ContentType)
+	assert.Equal("treexie", f.Creator)
+	assert.Equal([]byte("abc"), f.Data)
+	assert.Equal(int64(3), f.Size)
+	err = l.Delete(ctx, "test", "c.txt")
+	assert.Nil(err)
+
+	count, err := l.Count(ctx, FileFilterParams{
+		Bucket: "test",
+	})
+	assert.Nil(err)
+	assert.Equal(int64(2), count)
+	files, err := l.Query(ctx, FileFilterParams{
+		Bucket: "test",
+		Limit:  1,
+		Offset: 1,
+	})
+	assert.Nil(err)
+	assert.Equal(1, len(files))
+	count, err = l.Count(ctx, FileFilterParams{
+		Bucket: "notfound",
+	})
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	_, err = l.ListVersions(ctx, "test", "a.txt")
+	assert.Equal(http.StatusNotImplemented, hes.Wrap(err).StatusCode)
+
+	err = l.Delete(ctx, "test", "a.txt")
+	assert.Nil(err)
+	_, err = l.Get(ctx, "test", "a.txt")
+	he, ok := err.(*hes.Error)
+	assert.True(ok)
+	assert.Equal(http.StatusNotFound, he.StatusCode)
+	err = l.Delete(ctx, "test", "a.txt")
+	assert.NotNil(err)
+}
+
+func TestLocalStorageMultipartUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	l := mustNewLocalStorage(t.TempDir())
+
+	uploadID, err := l.NewMultipartUpload(ctx, File{
+		Bucket:      "test",
+		Filename:    "a.txt",
+		ContentType: "text/plain",
+		Creator:     "tree",
+	})
+	assert.Nil(err)
+
+	_, err = l.PutPart(ctx, "test", "b.txt", uploadID, 1, strings.NewReader("abc"), 3)
+	assert.NotNil(err)
+
+	parts := make([]FilePart, 0)
+	for index, value := range []string{"abc", "de"} {
+		part, err := l.PutPart(ctx, "test", "a.txt", uploadID, index+1, strings.NewReader(value), int64(len(value)))
+		assert.Nil(err)
+		parts = append(parts, *part)
+	}
+	err = l.CompleteMultipartUpload(ctx, "test", "a.txt", uploadID, parts)
+	assert.Nil(err)
+
+	f, err := l.Get(ctx, "test", "a.txt")
+	assert.Nil(err)
+	assert.Equal([]byte("abcde"), f.Data)
+	assert.Equal(int64(5), f.Size)
+	assert.Equal("tree", f.Creator)
+
+	uploadID, err = l.NewMultipartUpload(ctx, File{
+		Bucket:   "test",
+		Filename: "b.txt",
+	})
+	assert.Nil(err)
+	count, err := l.AbortExpiredMultipartUploads(ctx, time.Now().Add(time.Minute))
+	assert.Nil(err)
+	assert.Equal(1, count)
+	err = l.AbortMultipartUpload(ctx, "test", "b.txt", uploadID)
+	assert.NotNil(err)
+}
@@ -18,15 +18,21 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/vicanso/forest/config"
 	"github.com/vicanso/forest/validate"
+	"github.com/vicanso/hes"
 )
 
-func mustNewMinioStorage() FileStorage {
+const errMinioCategory = "minio"
+
+func mustNewMinioStorage() *minioStorage {
 	minioConfig := config.MustGetMinioConfig()
 	c, err := minio.New(minioConfig.Endpoint, &minio.Options{
 		Secure: minioConfig.SSL,
@@ -44,6 +50,83 @@ type minioStorage struct {
 	client *minio.Client
 }
 
+// getUserMetadata 获取用户自定义的metadata
+// 查询列表时返回的key包括x-amz-meta-前缀，而stat时则已去除，因此忽略前缀与大小写
+func getUserMetadata(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		k = strings.TrimPrefix(strings.ToLower(k), "x-amz-meta-")
+		if k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// convertError 转换minio的出错，如果是文件不存在则转换为404出错
+func convertError(err error) error {
+	if err == nil {
+		return nil
+	}
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == http.StatusNotFound ||
+		resp.Code == "NoSuchKey" {
+		return newFileNotFoundError()
+	}
+	return err
+}
+
+// convertObjectToFile 将minio的object转换为file（不包括数据）
+func convertObjectToFile(bucket string, obj minio.ObjectInfo) *File {
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = getUserMetadata(obj.UserMetadata, "content-type")
+	}
+	size := obj.Size
+	// 去重后的文件本身无数据，大小记录在metadata中
+	if blobSize := getUserMetadata(obj.UserMetadata, strings.ToLower(metadataBlobSize)); blobSize != "" {
+		size, _ = strconv.ParseInt(blobSize, 10, 64)
+	}
+	return &File{
+		Bucket:      bucket,
+		Filename:    obj.Key,
+		ContentType: contentType,
+		Size:        size,
+		Metadata:    obj.Metadata,
+		Creator:     getUserMetadata(obj.UserMetadata, creatorField),
+		CreatedAt:   obj.LastModified,
+		ETag:        obj.ETag,
+		Checksum:    getUserMetadata(obj.UserMetadata, strings.ToLower(metadataChecksum)),
+	}
+}
+
+// list 遍历bucket下的所有文件，fn返回false则停止遍历
+func (m *minioStorage) list(ctx context.Context, params FileFilterParams, fn func(file *File) bool) error {
+	if params.Bucket == "" {
+		return hes.New("bucket can not be empty", errMinioCategory)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	// 提前结束遍历时，需要cancel才会停止list的goroutine
+	defer cancel()
+	objects := m.client.ListObjects(ctx, params.Bucket, minio.ListObjectsOptions{
+		WithMetadata: true,
+		Recursive:    true,
+		Prefix:       params.Prefix,
+	})
+	for obj := range objects {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		file := convertObjectToFile(params.Bucket, obj)
+		if !params.match(file) {
+			continue
+		}
+		if !fn(file) {
+			break
+		}
+	}
+	return nil
+}
+
 // Get gets file from minio
 func (m *minioStorage) Get(ctx context.Context, bucket, filename string) (*File, error) {
 	obj, err := m.client.GetObject(ctx, bucket, filename, minio.GetObjectOptions{})
@@ -52,22 +135,33 @@ func (m *minioStorage) Get(ctx context.Context, bucket, filename string) (*File,
 	}
 	statsInfo, err := obj.Stat()
 	if err != nil {
-		return nil, err
+		return nil, convertError(err)
 	}
 	data, err := io.ReadAll(obj)
 	if err != nil {
 		return nil, err
 	}
+	f := convertObjectToFile(bucket, statsInfo)
+	f.Data = data
+	err = verifyChecksum(f)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
 
-	return &File{
-		Bucket:      bucket,
-		Filename:    filename,
-		ContentType: statsInfo.ContentType,
-		Size:        statsInfo.Size,
-		Metadata:    statsInfo.Metadata,
-		Creator:     statsInfo.Metadata.Get(creatorField),
-		Data:        data,
-	}, nil
+// Open opens the file from minio, the data of file should be read from reader
+func (m *minioStorage) Open(ctx context.Context, bucket, filename string) (*File, io.ReadSeekCloser, error) {
+	obj, err := m.client.GetObject(ctx, bucket, filename, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, convertError(err)
+	}
+	statsInfo, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, nil, convertError(err)
+	}
+	return convertObjectToFile(bucket, statsInfo), obj, nil
 }
 
 // Put puts file to minio
@@ -76,13 +170,9 @@ func (m *minioStorage) Put(ctx context.Context, file File) error {
 	if err != nil {
 		return err
 	}
+	setChecksum(&file)
 	r := bytes.NewReader(file.Data)
 	size := int64(len(file.Data))
-	metadata := make(map[string]string)
-	for key, values := range file.Metadata {
-		metadata[key] = strings.Join(values, ",")
-	}
-	metadata[creatorField] = file.Creator
 
 	_, err = m.client.PutObject(
 		ctx,
@@ -92,18 +182,196 @@ func (m *minioStorage) Put(ctx context.Context, file File) error {
 		size,
 		minio.PutObjectOptions{
 			ContentType:  file.ContentType,
-			UserMetadata: metadata,
+			UserMetadata: getMinioUserMetadata(file),
 		},
 	)
 	return err
 }
 
-// Query gets the files from minio
-func (m *minioStorage) Query(ctx context.Context, param FileFilterParams) ([]*File, error) {
-	return nil, nil
+// getMinioUserMetadata 获取保存至minio的metadata，包括创建者
+func getMinioUserMetadata(file File) map[string]string {
+	metadata := make(map[string]string)
+	for key, values := range file.Metadata {
+		metadata[key] = strings.Join(values, ",")
+	}
+	metadata[creatorField] = file.Creator
+	return metadata
+}
+
+// copyFile copies the src object to the file in minio server side, the metadata is replaced
+func (m *minioStorage) copyFile(ctx context.Context, src string, file File) error {
+	setChecksum(&file)
+	metadata := getMinioUserMetadata(file)
+	// 复制时content type也通过metadata指定
+	metadata["Content-Type"] = file.ContentType
+	// 超过5GB的文件需要分块复制，因此使用compose
+	_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:          file.Bucket,
+		Object:          file.Filename,
+		ReplaceMetadata: true,
+		UserMetadata:    metadata,
+	}, minio.CopySrcOptions{
+		Bucket: file.Bucket,
+		Object: src,
+	})
+	return convertError(err)
+}
+
+// Delete deletes file from minio
+func (m *minioStorage) Delete(ctx context.Context, bucket, filename string) error {
+	err := m.client.RemoveObject(ctx, bucket, filename, minio.RemoveObjectOptions{})
+	return convertError(err)
 }
 
-// Count counts the files from minio
+// PresignedPut generates the presigned url for uploading file to minio,
+// the creator and content type are signed, so the request should set the same headers.
+func (m *minioStorage) PresignedPut(ctx context.Context, file File, ttl time.Duration) (*PresignedURL, error) {
+	headers := http.Header{}
+	headers.Set("Content-Type", file.ContentType)
+	headers.Set("X-Amz-Meta-"+creatorField, file.Creator)
+	expiredAt := time.Now().Add(ttl)
+	u, err := m.client.PresignHeader(ctx, http.MethodPut, file.Bucket, file.Filename, ttl, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	result := &PresignedURL{
+		URL:       u.String(),
+		Method:    http.MethodPut,
+		Headers:   make(map[string]string),
+		ExpiredAt: expiredAt,
+	}
+	for key := range headers {
+		result.Headers[key] = headers.Get(key)
+	}
+	return result, nil
+}
+
+// PresignedGet generates the presigned url for downloading file from minio
+func (m *minioStorage) PresignedGet(ctx context.Context, bucket, filename string, ttl time.Duration) (*PresignedURL, error) {
+	expiredAt := time.Now().Add(ttl)
+	u, err := m.client.PresignedGetObject(ctx, bucket, filename, ttl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedURL{
+		URL:       u.String(),
+		Method:    http.MethodGet,
+		ExpiredAt: expiredAt,
+	}, nil
+}
+
+// Query gets the files from minio, the bucket of params is required.
+// The data of file isn't loaded, so the fields of params is ignored.
+func (m *minioStorage) Query(ctx context.Context, params FileFilterParams) ([]*File, error) {
+	limit := params.getLimit()
+	files := make([]*File, 0, limit)
+	index := 0
+	err := m.list(ctx, params, func(file *File) bool {
+		index++
+		if index <= params.Offset {
+			return true
+		}
+		files = append(files, file)
+		return len(files) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Count counts the files from minio, the bucket of params is required
 func (m *minioStorage) Count(ctx context.Context, params FileFilterParams) (int64, error) {
-	return -1, nil
+	var count int64
+	err := m.list(ctx, params, func(_ *File) bool {
+		count++
+		return true
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+// core 获取minio的core client，用于分块上传
+func (m *minioStorage) core() *minio.Core {
+	return &minio.Core{
+		Client: m.client,
+	}
+}
+
+// NewMultipartUpload creates a multipart upload of minio
+func (m *minioStorage) NewMultipartUpload(ctx context.Context, file File) (string, error) {
+	return m.core().NewMultipartUpload(ctx, file.Bucket, file.Filename, minio.PutObjectOptions{
+		ContentType: file.ContentType,
+		UserMetadata: map[string]string{
+			creatorField: file.Creator,
+		},
+	})
+}
+
+// PutPart uploads the part of multipart upload to minio
+func (m *minioStorage) PutPart(ctx context.Context, bucket, filename, uploadID string, number int, r io.Reader, size int64) (*FilePart, error) {
+	part, err := m.core().PutObjectPart(ctx, bucket, filename, uploadID, number, r, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &FilePart{
+		Number: part.PartNumber,
+		ETag:   part.ETag,
+		Size:   part.Size,
+	}, nil
+}
+
+// CompleteMultipartUpload completes the multipart upload of minio
+func (m *minioStorage) CompleteMultipartUpload(ctx context.Context, bucket, filename, uploadID string, parts []FilePart) error {
+	completeParts := make([]minio.CompletePart, len(parts))
+	for index, part := range parts {
+		completeParts[index] = minio.CompletePart{
+			PartNumber: part.Number,
+			ETag:       part.ETag,
+		}
+	}
+	_, err := m.core().CompleteMultipartUpload(ctx, bucket, filename, uploadID, completeParts, minio.PutObjectOptions{})
+	return err
+}
+
+// AbortMultipartUpload aborts the multipart upload of minio
+func (m *minioStorage) AbortMultipartUpload(ctx context.Context, bucket, filename, uploadID string) error {
+	return m.core().AbortMultipartUpload(ctx, bucket, filename, uploadID)
+}
+
+// AbortExpiredMultipartUploads aborts the incomplete multipart uploads of all buckets which are initiated before the time
+func (m *minioStorage) AbortExpiredMultipartUploads(ctx context.Context, before time.Time) (int, error) {
+	buckets, err := m.client.ListBuckets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, bucket := range buckets {
+		for upload := range m.client.ListIncompleteUploads(ctx, bucket.Name, "", true) {
+			if upload.Err != nil {
+				return count, upload.Err
+			}
+			if upload.Initiated.After(before) {
+				continue
+			}
+			err = m.AbortMultipartUpload(ctx, bucket.Name, upload.Key, upload.UploadID)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetVersion isn't supported by minio
+func (m *minioStorage) GetVersion(ctx context.Context, bucket, filename string, version int) (*File, error) {
+	return nil, newFileVersionNotSupportedError()
+}
+
+// ListVersions isn't supported by minio
+func (m *minioStorage) ListVersions(ctx context.Context, bucket, filename string) ([]*FileVersion, error) {
+	return nil, newFileVersionNotSupportedError()
 }
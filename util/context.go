@@ -27,6 +27,8 @@ const (
 	deviceIDKey contextKey = "deviceID"
 	traceIDKey  contextKey = "traceID"
 	accountKey  contextKey = "account"
+	// 模拟登录的原用户账号
+	impersonatorKey contextKey = "impersonator"
 )
 
 var sessionConfig = config.MustGetSessionConfig()
@@ -91,3 +93,13 @@ func SetAccount(ctx context.Context, account string) context.Context {
 func GetAccount(ctx context.Context) string {
 	return getStringFromContext(ctx, accountKey)
 }
+
+// SetImpersonator sets impersonator to context
+func SetImpersonator(ctx context.Context, impersonator string) context.Context {
+	return context.WithValue(ctx, impersonatorKey, impersonator)
+}
+
+// GetImpersonator gets impersonator from context
+func GetImpersonator(ctx context.Context) string {
+	return getStringFromContext(ctx, impersonatorKey)
+}
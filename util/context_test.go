@@ -14,6 +14,7 @@
 package util
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -48,3 +49,13 @@ func TestGetSessionID(t *testing.T) {
 	c := elton.NewContext(nil, req)
 	assert.Equal(cookie.Value, GetSessionID(c))
 }
+
+func TestImpersonator(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	assert.Empty(GetImpersonator(ctx))
+
+	ctx = SetImpersonator(ctx, "treexie")
+	assert.Equal("treexie", GetImpersonator(ctx))
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id的参数，参考RFC 9106的推荐配置
+const (
+	passwordHashPrefix  = "$argon2id$"
+	passwordHashTime    = 3
+	passwordHashMemory  = 64 * 1024
+	passwordHashThreads = 4
+	passwordHashKeyLen  = 32
+	passwordSaltLen     = 16
+)
+
+var errPasswordHashInvalid = errors.New("password hash is invalid")
+
+type passwordHashParams struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// HashPassword 使用argon2id生成密码的hash，
+// 格式为$argon2id$v=19$m=65536,t=3,p=4$salt$key
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, passwordHashTime, passwordHashMemory, passwordHashThreads, passwordHashKeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		passwordHashPrefix,
+		argon2.Version,
+		passwordHashMemory,
+		passwordHashTime,
+		passwordHashThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// IsPasswordHashed 判断是否已使用argon2id生成的hash
+func IsPasswordHashed(hash string) bool {
+	return strings.HasPrefix(hash, passwordHashPrefix)
+}
+
+// parsePasswordHash 解析hash中的参数
+func parsePasswordHash(hash string) (*passwordHashParams, error) {
+	// 以$分隔后为："", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	arr := strings.Split(hash, "$")
+	if len(arr) != 6 || !IsPasswordHashed(hash) {
+		return nil, errPasswordHashInvalid
+	}
+	version := 0
+	_, err := fmt.Sscanf(arr[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, errPasswordHashInvalid
+	}
+	params := passwordHashParams{}
+	_, err = fmt.Sscanf(arr[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return nil, errPasswordHashInvalid
+	}
+	params.salt, err = base64.RawStdEncoding.DecodeString(arr[4])
+	if err != nil {
+		return nil, errPasswordHashInvalid
+	}
+	params.key, err = base64.RawStdEncoding.DecodeString(arr[5])
+	if err != nil || len(params.key) == 0 {
+		return nil, errPasswordHashInvalid
+	}
+	return &params, nil
+}
+
+// VerifyPassword 校验密码与hash是否匹配
+func VerifyPassword(hash, password string) (bool, error) {
+	params, err := parsePasswordHash(hash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// PasswordNeedsRehash 判断hash是否需要重新生成，
+// 非argon2id或参数与当前配置不一致时需要重新生成
+func PasswordNeedsRehash(hash string) bool {
+	params, err := parsePasswordHash(hash)
+	if err != nil {
+		return true
+	}
+	return params.time != passwordHashTime ||
+		params.memory != passwordHashMemory ||
+		params.threads != passwordHashThreads ||
+		len(params.key) != passwordHashKeyLen
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHash(t *testing.T) {
+	assert := assert.New(t)
+
+	password := Sha256("password")
+	hash, err := HashPassword(password)
+	assert.Nil(err)
+	assert.True(IsPasswordHashed(hash))
+	assert.True(strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$"))
+	assert.False(PasswordNeedsRehash(hash))
+
+	// 相同的密码每次生成的hash不同
+	hash1, err := HashPassword(password)
+	assert.Nil(err)
+	assert.NotEqual(hash, hash1)
+
+	ok, err := VerifyPassword(hash, password)
+	assert.Nil(err)
+	assert.True(ok)
+	ok, err = VerifyPassword(hash1, password)
+	assert.Nil(err)
+	assert.True(ok)
+
+	ok, err = VerifyPassword(hash, Sha256("Password"))
+	assert.Nil(err)
+	assert.False(ok)
+
+	// 旧的sha256密码
+	assert.False(IsPasswordHashed(password))
+	assert.True(PasswordNeedsRehash(password))
+	_, err = VerifyPassword(password, password)
+	assert.Equal(errPasswordHashInvalid, err)
+
+	// 参数不一致需要重新生成
+	assert.True(PasswordNeedsRehash(strings.Replace(hash, "t=3", "t=1", 1)))
+}
@@ -17,6 +17,7 @@ package util
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	crand "crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -63,6 +64,26 @@ func RandomString(n int) string {
 	return randomString(letterBytes, n)
 }
 
+// SecureRandomString 使用crypto/rand创建指定长度的字符串，
+// 用于密钥、恢复码等需要不可预测的值，系统随机数不可用时panic
+func SecureRandomString(n int) string {
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		_, err := io.ReadFull(crand.Reader, buf)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range buf {
+			// 超出字母范围的丢弃，保证每个字母的概率一致
+			if idx := int(v & letterIdxMask); idx < len(letterBytes) && len(b) < n {
+				b = append(b, letterBytes[idx])
+			}
+		}
+	}
+	return string(b)
+}
+
 // RandomDigit 创建指定长度的数字字符串
 func RandomDigit(n int) string {
 	return randomString(digitBytes, n)
@@ -81,6 +102,13 @@ func Sha256(str string) string {
 	return base64.StdEncoding.EncodeToString(hashBytes)
 }
 
+// HmacSha256 使用key对字符串做hmac-sha256签名，返回url safe的base64字符串
+func HmacSha256(key, str string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(str))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 // ContainsAny 判断该字符串数据是否包含其中任意一个字符串
 func ContainsAny(targets []string, checkArr []string) bool {
 	for _, item := range targets {
@@ -27,6 +27,10 @@ func TestRandomString(t *testing.T) {
 
 	reg := regexp.MustCompile(`\d{10}`)
 	assert.True(reg.MatchString(RandomDigit(10)))
+
+	reg = regexp.MustCompile(`^[a-zA-Z]{40}$`)
+	assert.True(reg.MatchString(SecureRandomString(40)))
+	assert.NotEqual(SecureRandomString(40), SecureRandomString(40))
 }
 
 func TestGenXID(t *testing.T) {
@@ -39,6 +43,11 @@ func TestSha256(t *testing.T) {
 	assert.Equal("ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", Sha256("abc"))
 }
 
+func TestHmacSha256(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("nBluMtwBdfhvSxy4konWYZ3mvuaZ5MN45oMJ7Zehpqs", HmacSha256("key", "abc"))
+}
+
 func TestContainsAny(t *testing.T) {
 	assert := assert.New(t)
 	assert.True(ContainsAny([]string{
@@ -0,0 +1,108 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP的参数，与常用的验证器App（Google Authenticator等）默认值一致
+const (
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSecretLen = 20
+	// 允许前后偏差的周期数，避免客户端时间不准确
+	totpSkew = 1
+)
+
+// TOTPPeriod TOTP验证码的有效周期
+const TOTPPeriod = totpPeriod * time.Second
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成TOTP的密钥(base32)
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretLen)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPStep 获取时间对应的TOTP周期
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// generateTOTPCode 根据密钥与周期生成验证码(RFC 6238)
+func generateTOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// GenerateTOTPCode 生成当前时间的TOTP验证码
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	return generateTOTPCode(secret, TOTPStep(t))
+}
+
+// ValidateTOTPCode 校验TOTP验证码，返回匹配的周期，不匹配则返回0
+func ValidateTOTPCode(secret, code string, t time.Time) (int64, error) {
+	if len(code) != totpDigits {
+		return 0, nil
+	}
+	current := TOTPStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := generateTOTPCode(secret, step)
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, nil
+}
+
+// TOTPURI 生成验证器App使用的otpauth地址
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", totpDigits))
+	query.Set("period", fmt.Sprintf("%d", totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
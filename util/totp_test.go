@@ -0,0 +1,68 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	assert := assert.New(t)
+
+	// RFC 6238 附录B中的测试数据(SHA1)，密钥为"12345678901234567890"
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		result, err := GenerateTOTPCode(secret, time.Unix(unix, 0))
+		assert.Nil(err)
+		assert.Equal(code, result)
+	}
+
+	secret, err := GenerateTOTPSecret()
+	assert.Nil(err)
+	assert.Equal(32, len(secret))
+
+	now := time.Now()
+	code, err := GenerateTOTPCode(secret, now)
+	assert.Nil(err)
+	step, err := ValidateTOTPCode(secret, code, now)
+	assert.Nil(err)
+	assert.Equal(TOTPStep(now), step)
+
+	// 允许前后一个周期
+	step, err = ValidateTOTPCode(secret, code, now.Add(30*time.Second))
+	assert.Nil(err)
+	assert.Equal(TOTPStep(now), step)
+	step, err = ValidateTOTPCode(secret, code, now.Add(2*time.Minute))
+	assert.Nil(err)
+	assert.Equal(int64(0), step)
+
+	step, err = ValidateTOTPCode(secret, "12345", now)
+	assert.Nil(err)
+	assert.Equal(int64(0), step)
+
+	uri := TOTPURI("forest", "tree xie", secret)
+	assert.True(strings.HasPrefix(uri, "otpauth://totp/forest:tree%20xie?"))
+	assert.Contains(uri, "secret="+secret)
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// ZipJSON 将数据转换为json后打包为zip，key为zip中的文件名
+func ZipJSON(files map[string]any) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	// 按文件名排序，保证生成的zip一致
+	sort.Strings(names)
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(files[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
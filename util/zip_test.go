@@ -0,0 +1,49 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	buf, err := ZipJSON(map[string]any{
+		"profile.json": map[string]string{
+			"account": "treexie",
+		},
+		"logins.json": []int{1, 2},
+	})
+	assert.Nil(err)
+
+	r, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	assert.Nil(err)
+	assert.Equal(2, len(r.File))
+	assert.Equal("logins.json", r.File[0].Name)
+	assert.Equal("profile.json", r.File[1].Name)
+
+	f, err := r.File[1].Open()
+	assert.Nil(err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	assert.Nil(err)
+	assert.Equal("{\n  \"account\": \"treexie\"\n}\n", string(data))
+}
@@ -14,9 +14,26 @@
 
 package validate
 
+import "github.com/vicanso/forest/cs"
+
 func init() {
-	buckets := []string{
-		"files",
-	}
-	Add("xFileBucket", newIsInString(buckets))
+	Add("xFileBucket", newIsInString(cs.FileBuckets))
+	// 文件名，不允许包括路径分隔符
+	AddAlias("xFilename", "ascii,min=1,max=100,excludesall=/\\")
+	// 预签名地址有效期（秒），最长1小时
+	AddAlias("xFilePresignedTTL", "min=60,max=3600")
+	// 文件类型，如image/png
+	AddAlias("xFileContentType", "ascii,min=3,max=100,contains=/")
+	// 分块上传的分块大小，5MB至100MB(minio要求除最后一块外不能小于5MB)
+	AddAlias("xFileChunkSize", "min=5242880,max=104857600")
+	// 上传会话id
+	AddAlias("xFileUploadID", "alphanum,len=20")
+	// 图片处理的宽高
+	AddAlias("xImageSize", "min=1,max=4096")
+	// 图片缩放方式
+	AddAlias("xImageFit", "oneof=cover contain fill")
+	// 图片转换类型
+	AddAlias("xImageType", "oneof=jpeg png webp")
+	// 图片质量
+	AddAlias("xImageQuality", "min=1,max=100")
 }
@@ -0,0 +1,24 @@
+// Copyright 2021 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+func init() {
+	// 角色名称，与用户角色一致
+	AddAlias("xRoleName", "alphanum,min=1,max=10")
+	// 角色说明
+	AddAlias("xRoleDescription", "min=1,max=50")
+	// 角色权限，如user:read
+	AddAlias("xRolePermission", "ascii,min=1,max=50")
+}
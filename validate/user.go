@@ -27,6 +27,20 @@ func init() {
 	AddAlias("xUserRole", "ascii,min=1,max=10")
 	// 用户分组
 	AddAlias("xUserGroup", "ascii,min=1,max=10")
+	// 用户分组说明
+	AddAlias("xUserGroupDescription", "min=1,max=50")
+	// 两步验证码，验证器App生成的验证码或恢复码
+	AddAlias("xUserTOTPCode", "alphanum,min=6,max=10")
+	// 找回密码与邮箱验证的一次性令牌
+	AddAlias("xUserAccountToken", "ascii,min=1,max=100")
+	// 用户session id
+	AddAlias("xUserSessionID", "alphanum,len=20")
+	// bearer token认证的token
+	AddAlias("xUserAuthToken", "ascii,min=1,max=2000")
+	// 单点登录回调的授权码
+	AddAlias("xUserOIDCCode", "printascii,min=1,max=2000")
+	// 单点登录的认证状态
+	AddAlias("xUserOIDCState", "alpha,len=32")
 	// 用户行为分类
 	// TODO 是否调整为支持配置的方式
 	Add("xUserActionCategory", newIsInString([]string{
@@ -15,6 +15,7 @@ export enum ConfigCategory {
   Email = "email",
   HTTPServerInterceptor = "httpServerInterceptor",
   HTTPRequestInterceptor = "httpRequestInterceptor",
+  FilePolicy = "filePolicy",
 }
 
 export enum ConfigStatus {
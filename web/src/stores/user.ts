@@ -13,6 +13,7 @@ import request from "../helpers/request";
 
 const hash = "JT";
 
+// 客户端对密码做sha256，避免明文密码提交至服务端
 function generatePassword(pass: string): string {
   return sha256(hash + sha256(pass + hash));
 }
@@ -57,15 +58,15 @@ export const useUserStore = defineStore("user", {
       }
       try {
         this.processing = true;
-        const resp = await request.get<{
-          token: string;
-        }>(USERS_LOGIN);
-        const { token } = resp.data;
+        // 初始化此次登录的session
+        await request.get(USERS_LOGIN);
         const { data } = await request.post(
           USERS_INNER_LOGIN,
           {
             account: params.account,
-            password: sha256(generatePassword(params.password) + token),
+            // 服务端保存的是密码的argon2id hash，提交的sha256后的密码每次均相同，
+            // 因此不再有登录挑战值，防重放依赖于HTTPS
+            password: generatePassword(params.password),
           },
           {
             headers: {